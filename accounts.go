@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"strings"
 	"time"
+	"unicode"
 
+	log "git.sr.ht/~mariusor/lw"
 	vocab "github.com/go-ap/activitypub"
 	"github.com/go-ap/client/credentials"
 	"github.com/go-ap/errors"
@@ -331,6 +333,36 @@ func accountsFromRequestHandle(r *http.Request) (AccountCollection, error) {
 	return repo.accounts(r.Context(), AccountByHandleCheck(handle))
 }
 
+// recipientHandles returns the handles in the "to" value of a private message form,
+// which can be separated by commas or spaces, and can start with "~" or "@"
+func recipientHandles(to string) []string {
+	handles := make([]string, 0)
+	for _, h := range strings.FieldsFunc(to, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		if h = strings.TrimLeft(h, "~@"); h != "" && !stringInSlice(handles)(h) {
+			handles = append(handles, h)
+		}
+	}
+	return handles
+}
+
+// accountsFromRequestRecipients loads the additional recipients of a private message
+func accountsFromRequestRecipients(r *http.Request) AccountCollection {
+	repo := ContextRepository(r.Context())
+	if repo == nil {
+		return nil
+	}
+	result := make(AccountCollection, 0)
+	for _, handle := range recipientHandles(r.PostFormValue("to")) {
+		accounts, err := repo.accounts(r.Context(), AccountByHandleCheck(handle))
+		if err != nil {
+			repo.errFn(log.Ctx{"err": err.Error(), "handle": handle})("unable to load message recipient")
+			continue
+		}
+		result = append(result, accounts...)
+	}
+	return result
+}
+
 type AccountPtrCollection []*Account
 
 func reparentAccounts(allAccounts *AccountPtrCollection) {
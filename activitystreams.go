@@ -0,0 +1,80 @@
+package brutalinks
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	j "github.com/go-ap/jsonld"
+)
+
+const (
+	MimeTypeActivityJSON = "application/activity+json"
+	MimeTypeLDJSON       = "application/ld+json"
+)
+
+// wantsActivityPub returns true if the request prefers an ActivityStreams document over HTML.
+func wantsActivityPub(r *http.Request) bool {
+	switch acceptedMediaType(r, MimeTypeHTML, MimeTypeActivityJSON, MimeTypeLDJSON) {
+	case MimeTypeActivityJSON:
+		return true
+	case MimeTypeLDJSON:
+		// a JSON-LD request with a profile other than the ActivityStreams one is not for us
+		for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || mt != MimeTypeLDJSON {
+				continue
+			}
+			if p, ok := params["profile"]; ok && p != vocab.ActivityBaseURI.String() {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// activityPubObject returns the ActivityPub object of the item or account loaded for the current
+// request, and if it can be served as is. Private and federated objects, or the ones we have only
+// the IRI for, need to be fetched from their canonical location.
+func activityPubObject(r *http.Request) (vocab.Item, bool) {
+	if it := ContextItem(r.Context()); it.IsValid() {
+		return it.Pub, it.IsLocal() && !it.Private()
+	}
+	if auth, err := ContextAuthors(r.Context()).First(); err == nil && auth.IsValid() {
+		return auth.Pub, auth.IsLocal()
+	}
+	return nil, false
+}
+
+// ActivityPubMw serves the ActivityStreams representation of items and accounts, when requested by
+// the Accept header, so their permalinks can be resolved by other fediverse software.
+func (h *handler) ActivityPubMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !wantsActivityPub(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pub, serve := activityPubObject(r)
+		if vocab.IsNil(pub) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Vary", "Accept")
+		if !serve || pub.IsLink() {
+			http.Redirect(w, r, pub.GetLink().String(), http.StatusSeeOther)
+			return
+		}
+		data, err := j.WithContext(j.IRI(vocab.ActivityBaseURI), j.IRI(vocab.SecurityContextURI)).Marshal(pub)
+		if err != nil {
+			h.errFn(log.Ctx{"err": err.Error(), "iri": pub.GetLink()})("unable to marshal ActivityPub object")
+			http.Redirect(w, r, pub.GetLink().String(), http.StatusSeeOther)
+			return
+		}
+		w.Header().Set("Content-Type", j.ContentType)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(data)
+	})
+}
@@ -0,0 +1,100 @@
+package brutalinks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"git.sr.ht/~mariusor/brutalinks/internal/config"
+	vocab "github.com/go-ap/activitypub"
+	j "github.com/go-ap/jsonld"
+	"github.com/google/uuid"
+)
+
+func TestWantsActivityPub(t *testing.T) {
+	tests := map[string]bool{
+		"":                          false,
+		"text/html":                 false,
+		"application/json":          false,
+		"application/activity+json": true,
+		"application/ld+json":       true,
+		`application/ld+json; profile="https://www.w3.org/ns/activitystreams"`:            true,
+		`application/ld+json; profile="https://example.com/other"`:                        false,
+		"text/html, application/activity+json;q=0.9":                                      false,
+		"text/html;q=0.5, application/activity+json":                                      true,
+		`application/ld+json; profile="https://www.w3.org/ns/activitystreams", text/html`: true,
+	}
+	for accept, want := range tests {
+		t.Run(accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", accept)
+			if got := wantsActivityPub(r); got != want {
+				t.Errorf("wantsActivityPub(%q) = %t, want %t", accept, got, want)
+			}
+		})
+	}
+}
+
+func TestActivityPubMw(t *testing.T) {
+	Instance = new(Application)
+	Instance.BaseURL = url.URL{Scheme: "https", Host: "brutalinks.git"}
+	Instance.Conf = &config.Configuration{HostName: "brutalinks.git"}
+
+	local := &Item{
+		Hash:     Hash(uuid.New()),
+		Metadata: &ItemMetadata{ID: "https://brutalinks.git/objects/1"},
+		Pub:      &vocab.Object{ID: "https://brutalinks.git/objects/1", Type: vocab.NoteType},
+	}
+	private := &Item{
+		Hash:     Hash(uuid.New()),
+		Metadata: &ItemMetadata{ID: "https://brutalinks.git/objects/2"},
+		Pub:      &vocab.Object{ID: "https://brutalinks.git/objects/2", Type: vocab.NoteType},
+	}
+	private.MakePrivate()
+	remote := &Item{
+		Hash:     Hash(uuid.New()),
+		Metadata: &ItemMetadata{ID: "https://example.com/objects/3"},
+		Pub:      &vocab.Object{ID: "https://example.com/objects/3", Type: vocab.NoteType},
+	}
+
+	tests := []struct {
+		name       string
+		item       *Item
+		accept     string
+		wantStatus int
+		wantType   string
+		wantLoc    string
+	}{
+		{name: "html", item: local, accept: MimeTypeHTML, wantStatus: http.StatusTeapot},
+		{name: "local item", item: local, accept: MimeTypeActivityJSON, wantStatus: http.StatusOK, wantType: j.ContentType},
+		{name: "private item", item: private, accept: MimeTypeActivityJSON, wantStatus: http.StatusSeeOther, wantLoc: "https://brutalinks.git/objects/2"},
+		{name: "remote item", item: remote, accept: MimeTypeActivityJSON, wantStatus: http.StatusSeeOther, wantLoc: "https://example.com/objects/3"},
+		{name: "nothing loaded", accept: MimeTypeActivityJSON, wantStatus: http.StatusTeapot},
+	}
+	h := &handler{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			if tt.item != nil {
+				r = r.WithContext(context.WithValue(r.Context(), ContentCtxtKey, tt.item))
+			}
+			w := httptest.NewRecorder()
+			h.ActivityPubMw(next).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("ActivityPubMw() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantType != "" && w.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("ActivityPubMw() content type = %q, want %q", w.Header().Get("Content-Type"), tt.wantType)
+			}
+			if tt.wantLoc != "" && w.Header().Get("Location") != tt.wantLoc {
+				t.Errorf("ActivityPubMw() location = %q, want %q", w.Header().Get("Location"), tt.wantLoc)
+			}
+		})
+	}
+}
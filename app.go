@@ -78,6 +78,7 @@ func New(c *config.Configuration, l log.Logger, host string, port int, ver strin
 
 func (a *Application) Reload() error {
 	a.Conf = config.Load(a.Conf.Env, a.Conf.TimeOut)
+	loadRankingConfig(a.Conf)
 	a.front.storage.cache.remove()
 	return nil
 }
@@ -101,6 +102,7 @@ func (a *Application) init(c *config.Configuration, l log.Logger, host string, p
 	if port != config.DefaultListenPort {
 		c.ListenPort = port
 	}
+	loadRankingConfig(c)
 	if err := a.Front(); err != nil {
 		return err
 	}
@@ -136,14 +138,19 @@ func (a *Application) Routes() {
 	}
 	a.Mux = r
 	// Frontend
+	a.front.stats = NodeInfoResolverNew(a.front.storage, a.Conf.StatsRefreshInterval)
+	a.front.storage.ranks = rankIndexNew(a.front.storage, a.Conf.RankIndexRefreshInterval)
+	a.front.storage.digests = digestSenderNew(a.front.storage, DigestCheckInterval)
+	a.front.storage.relay = groupRelayNew(a.front.storage, GroupInboxCheckInterval)
 	r.With(a.front.Repository).Route("/", a.front.Routes(a.Conf))
 
 	// .well-known
 	cfg := NodeInfoConfig()
-	ni := nodeinfo.NewService(cfg, NodeInfoResolverNew(a.front.storage))
+	ni := nodeinfo.NewService(cfg, a.front.stats)
 	// Web-Finger
 	r.Route("/.well-known", func(r chi.Router) {
 		r.Get("/host-meta", a.front.HandleHostMeta)
+		r.Get("/webfinger", a.front.HandleWebFinger)
 		r.Get("/nodeinfo", ni.NodeInfoDiscover)
 		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
 			errors.HandleError(errors.NotFoundf("%s", r.RequestURI)).ServeHTTP(w, r)
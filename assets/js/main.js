@@ -82,4 +82,49 @@ OnReady( function() {
             }
         });
     });
+    let data = $("#submit-data")[0];
+    let title = $("#submit-title")[0];
+    if (data !== undefined && title !== undefined) {
+        addEvent(data, "change", function() {
+            let link = data.value.trim();
+            if (title.value.trim().length > 0 || !/^https?:\/\/\S+$/.test(link)) { return; }
+            fetch("/submit/preview?url=" + encodeURIComponent(link), {headers: {"Accept": "application/json"}})
+                .then(function (res) { return res.ok ? res.json() : {}; })
+                .then(function (preview) {
+                    if (preview.title && title.value.trim().length == 0) {
+                        title.value = preview.title;
+                    }
+                })
+                .catch(function () {});
+        });
+    }
+    let poll = $("section.poll")[0];
+    if (poll !== undefined && $("section.poll ol")[0] !== undefined && $("section.poll time")[0] !== undefined) {
+        let refresh = window.setInterval(function () {
+            fetch(window.location.pathname, {headers: {"Accept": "application/json"}})
+                .then(function (res) { return res.ok ? res.json() : {}; })
+                .then(function (page) {
+                    if (!page.item || !page.item.poll) { return; }
+                    let total = 0;
+                    page.item.poll.options.forEach(function (o) { total += o.votes; });
+                    page.item.poll.options.forEach(function (o) {
+                        poll.querySelectorAll("li").forEach(function (li) {
+                            if (li.getAttribute("data-name") != o.name) { return; }
+                            let meter = li.querySelector("meter");
+                            meter.max = total;
+                            meter.value = o.votes;
+                            meter.textContent = o.votes;
+                            li.querySelector(".percent").textContent = (total > 0 ? Math.floor(o.votes * 100 / total) : 0) + "%";
+                        });
+                    });
+                    let count = poll.querySelector("data.total");
+                    count.value = total;
+                    count.textContent = total;
+                    if (page.item.poll.closed || new Date(page.item.poll.endTime) < new Date()) {
+                        window.clearInterval(refresh);
+                    }
+                })
+                .catch(function () {});
+        }, 30000);
+    }
 });
@@ -0,0 +1,438 @@
+package brutalinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// AttachmentMaxCount is the maximum number of files that can be uploaded with a submission
+	AttachmentMaxCount = 4
+	// attachmentFormMemory is the part of a multipart form we keep in memory, the rest goes to temporary files
+	attachmentFormMemory = 8 << 20
+	// attachmentField is the name of the submission form input for uploads
+	attachmentField = "attachment"
+)
+
+// attachmentTypes maps the media types we accept for uploads, as detected from their content,
+// to the media type we store them with.
+var attachmentTypes = map[string]string{
+	"image/jpeg":      "image/jpeg",
+	"image/png":       "image/png",
+	"image/gif":       "image/gif",
+	"image/webp":      "image/webp",
+	"video/mp4":       "video/mp4",
+	"video/webm":      "video/webm",
+	"audio/mpeg":      "audio/mpeg",
+	"audio/wave":      "audio/wav",
+	"application/ogg": "audio/ogg",
+}
+
+// Attachment is a media file published together with an item
+type Attachment struct {
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mimeType"`
+	// IRI is the ID of the object holding the file, for the attachments uploaded to this instance
+	IRI string `json:"iri,omitempty"`
+	// URI is the location of the file
+	URI string `json:"uri,omitempty"`
+	// data is the content of an uploaded file, until it gets saved to storage
+	data []byte
+}
+
+type AttachmentCollection []Attachment
+
+func (a Attachment) IsValid() bool {
+	return (len(a.data) > 0 || a.URI != "") && isMediaType(a.MimeType)
+}
+
+func isMediaType(mime string) bool {
+	return isImage(mime) || isVideo(mime) || isAudio(mime)
+}
+
+func attachmentObjectType(mime string) vocab.ActivityVocabularyType {
+	switch {
+	case isImage(mime):
+		return vocab.ImageType
+	case isVideo(mime):
+		return vocab.VideoType
+	case isAudio(mime):
+		return vocab.AudioType
+	}
+	return vocab.DocumentType
+}
+
+// AP returns the ActivityPub object we store in the "attachment" property of the item,
+// which references the object holding the file
+func (a Attachment) AP() vocab.Item {
+	o := vocab.Object{
+		ID:        vocab.IRI(a.IRI),
+		Type:      attachmentObjectType(a.MimeType),
+		MediaType: vocab.MimeType(a.MimeType),
+	}
+	if a.Name != "" {
+		o.Name = vocab.DefaultNaturalLanguage(a.Name)
+	}
+	if a.URI != "" {
+		o.URL = vocab.IRI(a.URI)
+	}
+	return &o
+}
+
+// object returns the ActivityPub object which holds the content of the uploaded file
+func (a Attachment) object(author vocab.Item) *vocab.Object {
+	return &vocab.Object{
+		Type:         attachmentObjectType(a.MimeType),
+		MediaType:    vocab.MimeType(a.MimeType),
+		Content:      vocab.DefaultNaturalLanguage(base64.StdEncoding.EncodeToString(a.data)),
+		AttributedTo: author.GetLink(),
+		To:           vocab.ItemCollection{author.GetLink()},
+	}
+}
+
+func (a *Attachment) FromActivityPub(it vocab.Item) error {
+	if vocab.IsNil(it) {
+		return errors.Newf("nil attachment received")
+	}
+	return vocab.OnObject(it, func(o *vocab.Object) error {
+		a.MimeType = string(o.MediaType)
+		a.Name = o.Name.First().String()
+		a.IRI = o.ID.String()
+		if o.URL != nil {
+			a.URI = o.URL.GetLink().String()
+		}
+		if !a.IsValid() {
+			return errors.NotValidf("unsupported attachment %s", a.MimeType)
+		}
+		return nil
+	})
+}
+
+func (c *AttachmentCollection) FromActivityPub(att vocab.Item) error {
+	if att == nil {
+		return errors.Newf("empty collection")
+	}
+	appendAttachment := func(it vocab.Item) error {
+		a := Attachment{}
+		if err := a.FromActivityPub(it); err != nil {
+			return err
+		}
+		*c = append(*c, a)
+		return nil
+	}
+	if att.IsCollection() {
+		return vocab.OnCollectionIntf(att, func(c vocab.CollectionInterface) error {
+			for _, it := range c.Collection() {
+				_ = appendAttachment(it)
+			}
+			return nil
+		})
+	}
+	return appendAttachment(att)
+}
+
+func (c AttachmentCollection) AP() vocab.ItemCollection {
+	col := make(vocab.ItemCollection, 0, len(c))
+	for _, a := range c {
+		col = append(col, a.AP())
+	}
+	return col
+}
+
+// LimitRequestBodyMw bounds the size of the submissions to what the maximum number of attachments can use,
+// and parses the multipart forms before the CSRF validation reads them.
+func (v *view) LimitRequestBodyMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// we allow for another megabyte for the rest of the form
+		r.Body = http.MaxBytesReader(w, r.Body, AttachmentMaxCount*Instance.Conf.AttachmentMaxSize+(1<<20))
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+			if err := r.ParseMultipartForm(attachmentFormMemory); err != nil {
+				v.HandleErrors(w, r, errors.NewBadRequest(err, "unable to load the submitted form"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// attachmentURL returns the location where we serve the file held by the object with iri
+func attachmentURL(iri vocab.IRI) string {
+	return fmt.Sprintf("%s/media/%s", Instance.BaseURL.String(), HashFromIRI(iri))
+}
+
+// saveAttachments stores each file uploaded with it as its own object, addressed only to its author,
+// and replaces the content of the attachments with references to those objects.
+func (r *repository) saveAttachments(ctx context.Context, it *Item, author vocab.Item) error {
+	if !it.HasMetadata() {
+		return nil
+	}
+	for i, a := range it.Metadata.Attachments {
+		if len(a.data) == 0 {
+			continue
+		}
+		act := &vocab.Activity{
+			Type:   vocab.CreateType,
+			To:     vocab.ItemCollection{author.GetLink()},
+			Actor:  author.GetLink(),
+			Object: a.object(author),
+		}
+		_, ob, err := r.ToOutbox(ctx, it.SubmittedBy.Credentials(), act)
+		if err != nil {
+			return errors.Annotatef(err, "unable to save attachment %s", a.Name)
+		}
+		if vocab.IsNil(ob) {
+			return errors.Newf("unable to save attachment %s", a.Name)
+		}
+		a.IRI = ob.GetLink().String()
+		a.URI = attachmentURL(ob.GetLink())
+		a.data = nil
+		it.Metadata.Attachments[i] = a
+	}
+	return nil
+}
+
+// LoadAttachment returns the media type and the content of the uploaded file with hash h
+func (r *repository) LoadAttachment(h Hash) (string, []byte, error) {
+	if !h.IsValid() {
+		return "", nil, errors.NotFoundf("invalid attachment")
+	}
+	res, err := r.b.Search(
+		filters.HasType(vocab.ImageType, vocab.VideoType, vocab.AudioType),
+		filters.IRILike(h.String()),
+		filters.WithMaxCount(1),
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, li := range res {
+		ob, ok := li.(vocab.Item)
+		if !ok || vocab.IsNil(ob) {
+			continue
+		}
+		var (
+			typ string
+			raw []byte
+		)
+		err = vocab.OnObject(ob, func(o *vocab.Object) error {
+			typ = string(o.MediaType)
+			if !stringInSlice(attachmentMediaTypes())(typ) || len(o.Content) == 0 {
+				return errors.NotFoundf("%s is not an attachment", h)
+			}
+			raw, err = base64.StdEncoding.DecodeString(o.Content.First().String())
+			return err
+		})
+		return typ, raw, err
+	}
+	return "", nil, errors.NotFoundf("attachment %s", h)
+}
+
+// attachmentMediaTypes returns the media types we store the uploaded files with
+func attachmentMediaTypes() []string {
+	types := make([]string, 0, len(attachmentTypes))
+	for _, typ := range attachmentTypes {
+		types = append(types, typ)
+	}
+	return types
+}
+
+// HandleAttachment serves GET /media/{hash} requests with the content of the uploaded files
+func (h *handler) HandleAttachment(w http.ResponseWriter, r *http.Request) {
+	typ, raw, err := h.storage.LoadAttachment(HashFromString(chi.URLParam(r, "hash")))
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotFound(err, "not found"))
+		return
+	}
+	w.Header().Set("Content-Type", typ)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(raw))
+}
+
+// attachmentsFromRequest loads the files uploaded with the submission form.
+// The media type of the files is detected from their content, and the images are stripped of their metadata.
+func attachmentsFromRequest(r *http.Request, maxSize int64) (AttachmentCollection, error) {
+	if r.MultipartForm == nil || r.MultipartForm.File == nil {
+		return nil, nil
+	}
+	files := r.MultipartForm.File[attachmentField]
+	if len(files) > AttachmentMaxCount {
+		return nil, errors.BadRequestf("too many attachments, the maximum is %d", AttachmentMaxCount)
+	}
+	attachments := make(AttachmentCollection, 0, len(files))
+	for _, fh := range files {
+		if fh.Size > maxSize {
+			return nil, errors.BadRequestf("%s is larger than the maximum of %d bytes", fh.Filename, maxSize)
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, errors.NewBadRequest(err, "unable to load %s", fh.Filename)
+		}
+		raw, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+		_ = f.Close()
+		if err != nil {
+			return nil, errors.NewBadRequest(err, "unable to load %s", fh.Filename)
+		}
+		if len(raw) == 0 {
+			// browsers send an empty part for file inputs with nothing selected
+			continue
+		}
+		if int64(len(raw)) > maxSize {
+			return nil, errors.BadRequestf("%s is larger than the maximum of %d bytes", fh.Filename, maxSize)
+		}
+		detected, _, _ := mime.ParseMediaType(http.DetectContentType(raw))
+		typ, ok := attachmentTypes[detected]
+		if !ok {
+			return nil, errors.BadRequestf("%s has an unsupported file type %s", fh.Filename, detected)
+		}
+		if raw, err = stripMetadata(typ, raw); err != nil {
+			return nil, errors.NewBadRequest(err, "%s is not a valid %s file", fh.Filename, typ)
+		}
+		attachments = append(attachments, Attachment{Name: fh.Filename, MimeType: typ, data: raw})
+	}
+	return attachments, nil
+}
+
+// stripMetadata removes the EXIF, XMP and text metadata from the images, which can contain the location
+// where the picture was taken, or details about the device of the author.
+func stripMetadata(typ string, b []byte) ([]byte, error) {
+	switch typ {
+	case "image/jpeg":
+		return stripJPEGMetadata(b)
+	case "image/png":
+		return stripPNGMetadata(b)
+	case "image/webp":
+		return stripWebPMetadata(b)
+	}
+	return b, nil
+}
+
+var errInvalidImage = errors.NotValidf("invalid image")
+
+// stripJPEGMetadata drops the APP1 (EXIF and XMP), APP13 (IPTC) and comment segments of the JPEG image
+func stripJPEGMetadata(b []byte) ([]byte, error) {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil, errInvalidImage
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(b)))
+	out.Write(b[:2])
+	for i := 2; i < len(b); {
+		if b[i] != 0xFF || i+1 >= len(b) {
+			return nil, errInvalidImage
+		}
+		marker := b[i+1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8):
+			out.Write(b[i : i+2])
+			i += 2
+			continue
+		case marker == 0xD9:
+			out.Write(b[i : i+2])
+			return out.Bytes(), nil
+		}
+		if i+4 > len(b) {
+			return nil, errInvalidImage
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:i+4]))
+		if end > len(b) {
+			return nil, errInvalidImage
+		}
+		if marker == 0xDA {
+			// the start of scan segment is followed by the entropy coded data, until the end of the image
+			out.Write(b[i:])
+			return out.Bytes(), nil
+		}
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(b[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are the ancillary PNG chunks that don't affect how the image is displayed
+var pngMetadataChunks = []string{"eXIf", "tEXt", "zTXt", "iTXt", "tIME"}
+
+// stripPNGMetadata drops the EXIF, text and time chunks of the PNG image
+func stripPNGMetadata(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, pngSignature) {
+		return nil, errInvalidImage
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(b)))
+	out.Write(pngSignature)
+	for i := len(pngSignature); i < len(b); {
+		if i+8 > len(b) {
+			return nil, errInvalidImage
+		}
+		// each chunk has a length, a type, the data and a CRC
+		end := i + 12 + int(binary.BigEndian.Uint32(b[i:i+4]))
+		if end > len(b) || end < i {
+			return nil, errInvalidImage
+		}
+		if typ := string(b[i+4 : i+8]); !stringInSlice(pngMetadataChunks)(typ) {
+			out.Write(b[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+const (
+	webPFlagEXIF = 0x08
+	webPFlagXMP  = 0x04
+)
+
+// stripWebPMetadata drops the EXIF and XMP chunks of the WebP image, and updates the flags and the file size to match
+func stripWebPMetadata(b []byte) ([]byte, error) {
+	if len(b) < 12 || string(b[:4]) != "RIFF" || string(b[8:12]) != "WEBP" {
+		return nil, errInvalidImage
+	}
+	out := make([]byte, 0, len(b))
+	out = append(out, b[:12]...)
+	for i := 12; i < len(b); {
+		if i+8 > len(b) {
+			return nil, errInvalidImage
+		}
+		size := int(binary.LittleEndian.Uint32(b[i+4 : i+8]))
+		// the chunks are padded to an even size
+		end := i + 8 + size + size%2
+		if end > len(b) || end < i {
+			return nil, errInvalidImage
+		}
+		switch string(b[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, b[i:end]...)
+			if size > 0 {
+				out[start+8] &^= webPFlagEXIF | webPFlagXMP
+			}
+		default:
+			out = append(out, b[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
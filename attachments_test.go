@@ -0,0 +1,147 @@
+package brutalinks
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	img "image"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"reflect"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/uuid"
+)
+
+func testImage() img.Image {
+	return img.NewGray(img.Rect(0, 0, 4, 4))
+}
+
+func jpegWithExif(t *testing.T) []byte {
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatalf("unable to encode JPEG: %s", err)
+	}
+	exif := append([]byte("Exif\x00\x00"), []byte("GPS secret")...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(exif)+2))
+	seg = append(seg, exif...)
+
+	b := buf.Bytes()
+	return append(append(append([]byte{}, b[:2]...), seg...), b[2:]...)
+}
+
+func pngWithText(t *testing.T) []byte {
+	buf := bytes.Buffer{}
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatalf("unable to encode PNG: %s", err)
+	}
+	data := []byte("Comment\x00GPS secret")
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, "tEXt"...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	b := buf.Bytes()
+	// the IHDR chunk needs to be the first one, it's 25 bytes long, after the 8 bytes signature
+	return append(append(append([]byte{}, b[:33]...), chunk...), b[33:]...)
+}
+
+func TestStripMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     string
+		data    []byte
+		wantErr bool
+	}{
+		{
+			name: "jpeg",
+			typ:  "image/jpeg",
+			data: jpegWithExif(t),
+		},
+		{
+			name: "png",
+			typ:  "image/png",
+			data: pngWithText(t),
+		},
+		{
+			name:    "invalid png",
+			typ:     "image/png",
+			data:    []byte("GPS secret"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripMetadata(tt.typ, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("stripMetadata() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if bytes.Contains(got, []byte("GPS secret")) {
+				t.Errorf("stripMetadata() kept the metadata")
+			}
+			if _, _, err := img.Decode(bytes.NewReader(got)); err != nil {
+				t.Errorf("stripMetadata() returned an invalid image: %s", err)
+			}
+		})
+	}
+}
+
+func TestAttachmentAP(t *testing.T) {
+	Instance = new(Application)
+	Instance.BaseURL = url.URL{Scheme: "https", Host: "brutalinks.git"}
+
+	author := vocab.IRI("https://fedbox.git/actors/jdoe")
+	stored := vocab.IRI("https://fedbox.git/objects/" + Hash(uuid.New()).String())
+	a := Attachment{Name: "cat.png", MimeType: "image/png", data: []byte("meow")}
+
+	ob := a.object(author)
+	if ob.Type != vocab.ImageType || ob.MediaType != "image/png" {
+		t.Errorf("object() = %s %s, want an image/png Image", ob.Type, ob.MediaType)
+	}
+	if got := ob.Content.First().String(); got != base64.StdEncoding.EncodeToString(a.data) {
+		t.Errorf("object() content = %q, want the encoded file", got)
+	}
+	if len(ob.To) != 1 || !ob.To.Contains(author) {
+		t.Errorf("object() recipients = %v, want only the author", ob.To)
+	}
+
+	a.IRI = stored.String()
+	a.URI = attachmentURL(stored)
+	a.data = nil
+	if want := "https://brutalinks.git/media/" + HashFromIRI(stored).String(); a.URI != want {
+		t.Errorf("attachmentURL() = %s, want %s", a.URI, want)
+	}
+
+	ref := a.AP()
+	err := vocab.OnObject(ref, func(o *vocab.Object) error {
+		if len(o.Content) > 0 {
+			t.Errorf("AP() embeds the content of the file")
+		}
+		if !o.ID.Equals(stored, false) || o.URL.GetLink().String() != a.URI {
+			t.Errorf("AP() = %s %s, want a reference to %s", o.ID, o.URL, stored)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("AP() returned an invalid object: %s", err)
+	}
+
+	got := Attachment{}
+	if err = got.FromActivityPub(ref); err != nil {
+		t.Fatalf("FromActivityPub() error = %s", err)
+	}
+	if !reflect.DeepEqual(got, a) {
+		t.Errorf("FromActivityPub() = %+v, want %+v", got, a)
+	}
+	if err = (&Attachment{}).FromActivityPub(&vocab.Object{Type: vocab.ImageType, MediaType: "image/png"}); err == nil {
+		t.Errorf("FromActivityPub() accepted an attachment without a location")
+	}
+}
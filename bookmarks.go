@@ -0,0 +1,257 @@
+package brutalinks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// bookmarksCollection is the name of the private collection of an actor, which holds the items they saved
+	bookmarksCollection = "bookmarks"
+
+	actionSave   = "save"
+	actionUnsave = "unsave"
+)
+
+// bookmarksIRI returns the IRI of the collection with the items saved by the a account
+func bookmarksIRI(a *Account) vocab.IRI {
+	if a == nil || vocab.IsNil(a.Pub) {
+		return ""
+	}
+	return a.Pub.GetLink().AddPath(bookmarksCollection)
+}
+
+// bookmarkedIRIs returns the objects that the Add and Remove activities in acts leave in the col collection,
+// the most recently saved first.
+func bookmarkedIRIs(col vocab.IRI, acts ...vocab.Item) vocab.IRIs {
+	activities := make([]*vocab.Activity, 0, len(acts))
+	for _, it := range acts {
+		_ = vocab.OnActivity(it, func(act *vocab.Activity) error {
+			if act.Type != vocab.AddType && act.Type != vocab.RemoveType {
+				return nil
+			}
+			if vocab.IsNil(act.Object) || act.Target == nil || !act.Target.GetLink().Equals(col, false) {
+				return nil
+			}
+			activities = append(activities, act)
+			return nil
+		})
+	}
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].Published.Before(activities[j].Published)
+	})
+
+	saved := make(map[vocab.IRI]time.Time)
+	for _, act := range activities {
+		iri := act.Object.GetLink()
+		if act.Type == vocab.RemoveType {
+			delete(saved, iri)
+			continue
+		}
+		saved[iri] = act.Published
+	}
+	iris := make(vocab.IRIs, 0, len(saved))
+	for iri := range saved {
+		iris = append(iris, iri)
+	}
+	sort.SliceStable(iris, func(i, j int) bool {
+		if saved[iris[i]].Equal(saved[iris[j]]) {
+			return iris[i] < iris[j]
+		}
+		return saved[iris[i]].After(saved[iris[j]])
+	})
+	return iris
+}
+
+// savedItems returns a function which tells if the by account has an item in its bookmarks.
+// The bookmarks are loaded from the outbox of the account only once, for all the items of a page.
+func savedItems(by *Account) func(*Item) bool {
+	var (
+		once  sync.Once
+		saved map[vocab.IRI]struct{}
+	)
+	return func(i *Item) bool {
+		if !by.IsLogged() || !by.HasMetadata() || i == nil || vocab.IsNil(i.Pub) {
+			return false
+		}
+		once.Do(func() {
+			iris := bookmarkedIRIs(bookmarksIRI(by), by.Metadata.Outbox...)
+			saved = make(map[vocab.IRI]struct{}, len(iris))
+			for _, iri := range iris {
+				saved[iri] = struct{}{}
+			}
+		})
+		_, ok := saved[i.Pub.GetLink()]
+		return ok
+	}
+}
+
+// loadBookmarks returns the IRIs of the items the a account saved
+func (r *repository) loadBookmarks(ctx context.Context, a *Account) (vocab.IRIs, error) {
+	if !a.IsLogged() || vocab.IsNil(a.Pub) {
+		return nil, errors.Unauthorizedf("invalid account")
+	}
+	res, err := r.b.Search(
+		filters.HasType(vocab.AddType, vocab.RemoveType),
+		filters.SameAttributedTo(a.Pub.GetLink()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	acts := make(vocab.ItemCollection, 0, len(res))
+	for _, li := range res {
+		if it, ok := li.(vocab.Item); ok && !vocab.IsNil(it) {
+			acts = append(acts, it)
+		}
+	}
+	return bookmarkedIRIs(bookmarksIRI(a), acts...), nil
+}
+
+// SaveBookmark adds the item to the bookmarks collection of the a account, or removes it when save is false.
+// The activities are addressed only to the account, so nobody else can see what it saved.
+func (r *repository) SaveBookmark(ctx context.Context, a Account, it Item, save bool) error {
+	if !accountValidForC2S(&a) {
+		return errors.Unauthorizedf("invalid account %s", a.Handle)
+	}
+	if vocab.IsNil(it.Pub) {
+		return errors.NotFoundf("invalid item")
+	}
+	if save {
+		if err := r.createBookmarks(ctx, a); err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "account": a.Handle})("unable to create the bookmarks collection")
+			return err
+		}
+	}
+	actor := r.loadAPPerson(a).GetLink()
+
+	act := &vocab.Activity{
+		Type:      vocab.AddType,
+		Actor:     actor,
+		To:        vocab.ItemCollection{actor},
+		Object:    it.Pub.GetLink(),
+		Target:    bookmarksIRI(&a),
+		Published: time.Now().UTC(),
+	}
+	if !save {
+		act.Type = vocab.RemoveType
+	}
+	i, ob, err := r.ToOutbox(ctx, a.Credentials(), act)
+	if err != nil {
+		r.errFn(log.Ctx{"err": err.Error(), "item": it.Pub.GetLink(), "type": act.Type})("unable to save bookmark")
+		return err
+	}
+	r.cache.removeRelated(i, ob, act)
+	return nil
+}
+
+// createBookmarks creates the private collection for the items saved by the a account, and adds it
+// to the streams of its actor, if it doesn't have it already
+func (r *repository) createBookmarks(ctx context.Context, a Account) error {
+	actor := r.loadAPPerson(a)
+	col := bookmarksIRI(&a)
+	if actor.Streams.Contains(col) {
+		return nil
+	}
+	bookmarks := &vocab.OrderedCollection{
+		ID:           col,
+		Type:         vocab.OrderedCollectionType,
+		AttributedTo: actor.GetLink(),
+		To:           vocab.ItemCollection{actor.GetLink()},
+		Published:    time.Now().UTC(),
+	}
+	create := wrapItemInCreate(bookmarks, actor)
+	create.To = vocab.ItemCollection{actor.GetLink()}
+	if _, _, err := r.ToOutbox(ctx, a.Credentials(), create); err != nil && !errors.IsConflict(err) {
+		return err
+	}
+
+	actor.Streams = append(actor.Streams, col)
+	update := &vocab.Activity{
+		Type:   vocab.UpdateType,
+		Actor:  actor.GetLink(),
+		To:     vocab.ItemCollection{actor.GetLink()},
+		Object: actor,
+	}
+	i, ob, err := r.ToOutbox(ctx, a.Credentials(), update)
+	if err != nil {
+		return err
+	}
+	r.cache.removeRelated(i, ob, update)
+	return nil
+}
+
+// HandleBookmark serves the POST /{hash}/save and /{hash}/unsave requests
+func (h *handler) HandleBookmark(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+
+	it, err := ItemFromContext(r.Context(), h.storage, chi.URLParam(r, "hash"))
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotFound(err, "Item not found"))
+		return
+	}
+	url := ItemPermaLink(&it)
+	if back := r.Header.Get("Referer"); !strings.Contains(back, url) && strings.Contains(back, Instance.BaseURL.String()) {
+		url = fmt.Sprintf("%s#li-%s", back, it.Hash)
+	}
+
+	save := path.Base(r.URL.Path) == actionSave
+	if err = h.storage.SaveBookmark(r.Context(), *acc, it, save); err != nil {
+		h.v.addFlashMessage(Error, w, r, "Unable to update your saved items.")
+	} else if save {
+		h.v.addFlashMessage(Success, w, r, "The item has been saved.")
+	} else {
+		h.v.addFlashMessage(Success, w, r, "The item has been removed from your saved items.")
+	}
+	acc.Metadata.InvalidateOutbox()
+	h.v.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// LoadSavedMw loads the current page of the items in the bookmarks of the logged account,
+// the most recently saved first
+func LoadSavedMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acc := loggedAccount(r)
+		if m := ContextListingModel(r.Context()); m != nil {
+			m.Title = "Saved items"
+			m.ShowText = true
+			m.sortFn = keepOrder
+		}
+		repo := ContextRepository(r.Context())
+		iris, err := repo.loadBookmarks(r.Context(), acc)
+		if err != nil {
+			repo.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to load saved items")
+		}
+		q := r.URL.Query()
+		page, prev, nxt, ok := pageIRIs(iris, q.Get(keyAfter), q.Get(keyBefore), MaxContentItems)
+		if !ok {
+			ctxtErr(next, w, r, errors.NotFoundf("%s", strings.TrimLeft(r.URL.Path, "/")))
+			return
+		}
+		d := ContextDependentLoads(r.Context())
+		if d == nil {
+			d = &deps{}
+		}
+		c, err := repo.loadIRIs(r.Context(), *d, page)
+		if err != nil {
+			ctxtErr(next, w, r, errors.NotFoundf("%s", strings.TrimLeft(r.URL.Path, "/")))
+			return
+		}
+		c.after, c.before = nxt, prev
+		c.items = reparentRenderables(inIRIsOrder(c.items, page))
+
+		ctx := context.WithValue(r.Context(), CursorCtxtKey, &c)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
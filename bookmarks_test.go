@@ -0,0 +1,109 @@
+package brutalinks
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/uuid"
+)
+
+func TestBookmarkedIRIs(t *testing.T) {
+	col := vocab.IRI("https://example.com/actors/jdoe/bookmarks")
+	other := vocab.IRI("https://example.com/actors/jdoe/featured")
+	first := vocab.IRI("https://example.com/objects/1")
+	second := vocab.IRI("https://example.com/objects/2")
+
+	now := time.Now()
+	act := func(typ vocab.ActivityVocabularyType, ob, target vocab.IRI, ago time.Duration) vocab.Item {
+		return &vocab.Activity{Type: typ, Object: ob, Target: target, Published: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name string
+		acts []vocab.Item
+		want vocab.IRIs
+	}{
+		{name: "empty", acts: nil, want: vocab.IRIs{}},
+		{
+			name: "most recent first",
+			acts: []vocab.Item{act(vocab.AddType, first, col, 2*time.Hour), act(vocab.AddType, second, col, time.Hour)},
+			want: vocab.IRIs{second, first},
+		},
+		{
+			name: "removed",
+			acts: []vocab.Item{act(vocab.RemoveType, first, col, time.Hour), act(vocab.AddType, first, col, 2*time.Hour)},
+			want: vocab.IRIs{},
+		},
+		{
+			name: "saved again",
+			acts: []vocab.Item{
+				act(vocab.AddType, first, col, 3*time.Hour),
+				act(vocab.RemoveType, first, col, 2*time.Hour),
+				act(vocab.AddType, first, col, time.Hour),
+			},
+			want: vocab.IRIs{first},
+		},
+		{
+			name: "other collection",
+			acts: []vocab.Item{act(vocab.AddType, first, other, time.Hour), act(vocab.LikeType, second, col, time.Hour)},
+			want: vocab.IRIs{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bookmarkedIRIs(col, tt.acts...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bookmarkedIRIs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSavedItems(t *testing.T) {
+	actor := &vocab.Actor{ID: "https://example.com/actors/jdoe", Type: vocab.PersonType}
+	acc := &Account{Hash: Hash(uuid.New()), Handle: "jdoe", Pub: actor, Metadata: &AccountMetadata{}}
+	col := bookmarksIRI(acc)
+
+	saved := &Item{Pub: &vocab.Object{ID: "https://example.com/objects/1"}}
+	other := &Item{Pub: &vocab.Object{ID: "https://example.com/objects/2"}}
+	acc.Metadata.Outbox = vocab.ItemCollection{
+		&vocab.Activity{Type: vocab.AddType, Object: saved.Pub.GetLink(), Target: col, Published: time.Now()},
+	}
+
+	isSaved := savedItems(acc)
+	if !isSaved(saved) {
+		t.Errorf("savedItems() doesn't find the saved item")
+	}
+	if isSaved(other) {
+		t.Errorf("savedItems() finds an item that was not saved")
+	}
+
+	// the bookmarks are loaded once, for all the items on the page
+	acc.Metadata.Outbox = append(acc.Metadata.Outbox,
+		&vocab.Activity{Type: vocab.AddType, Object: other.Pub.GetLink(), Target: col, Published: time.Now()})
+	if isSaved(other) {
+		t.Errorf("savedItems() loaded the bookmarks again")
+	}
+	if !savedItems(acc)(other) {
+		t.Errorf("savedItems() for a new page doesn't find the newly saved item")
+	}
+	if savedItems(&AnonymousAccount)(saved) {
+		t.Errorf("savedItems() finds saved items for the anonymous account")
+	}
+}
+
+func TestSavedPages(t *testing.T) {
+	iris := make(vocab.IRIs, 0, MaxContentItems+5)
+	for i := 0; i < MaxContentItems+5; i++ {
+		iris = append(iris, vocab.IRI("https://example.com/objects/"+Hash(uuid.New()).String()))
+	}
+	first, prev, next, ok := pageIRIs(iris, "", "", MaxContentItems)
+	if !ok || len(first) != MaxContentItems || prev != "" || next != iris[MaxContentItems-1] {
+		t.Fatalf("pageIRIs() first page = %d items, %q, %q", len(first), prev, next)
+	}
+	second, prev, next, ok := pageIRIs(iris, IRIRef(next).String(), "", MaxContentItems)
+	if !ok || len(second) != 5 || prev != iris[MaxContentItems] || next != "" {
+		t.Fatalf("pageIRIs() second page = %d items, %q, %q", len(second), prev, next)
+	}
+}
@@ -0,0 +1,219 @@
+package brutalinks
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	"gitlab.com/golang-commonmark/puny"
+)
+
+// trackingParams are query parameters that only identify where a link has been shared from
+var trackingParams = []string{
+	"fbclid", "gclid", "dclid", "msclkid", "yclid", "igshid", "mc_cid", "mc_eid", "_hsenc", "_hsmi",
+	"ref_src", "ref_url",
+}
+
+func isTrackingParam(k string) bool {
+	k = strings.ToLower(k)
+	return strings.HasPrefix(k, "utm_") || stringInSlice(trackingParams)(k)
+}
+
+// hostAliases maps the alternative hosts of some sites to their canonical one
+var hostAliases = map[string]string{
+	"old." + redditDomain:     redditDomain,
+	"new." + redditDomain:     redditDomain,
+	"np." + redditDomain:      redditDomain,
+	"m." + redditDomain:       redditDomain,
+	"mobile." + twitterDomain: twitterDomain,
+	"x.com":                   twitterDomain,
+	"m.youtube.com":           "youtube.com",
+}
+
+// canonicalHost returns the lower case, punycode encoded, host name with the known aliases replaced.
+func canonicalHost(host string) string {
+	host = strings.ToLower(puny.ToASCII(strings.TrimSuffix(host, ".")))
+	if h, ok := hostAliases[strings.TrimPrefix(host, "www.")]; ok {
+		return h
+	}
+	return host
+}
+
+// withoutParams returns a rule removing the query parameters a site adds to its share links
+func withoutParams(params ...string) func(u *url.URL) {
+	return func(u *url.URL) {
+		q := u.Query()
+		for _, p := range params {
+			q.Del(p)
+		}
+		u.RawQuery = q.Encode()
+	}
+}
+
+// domainRules hold the cleanups specific to some sites, which are applied after the generic ones
+var domainRules = map[string]func(u *url.URL){
+	redditDomain:  withoutParams("share_id", "rdt", "correlation_id", "ref", "ref_source", "_branch_match_id", "_branch_referrer"),
+	twitterDomain: withoutParams("s", "t"),
+	"youtu.be": func(u *url.URL) {
+		id := strings.Trim(u.Path, "/")
+		if id == "" {
+			return
+		}
+		q := u.Query()
+		q.Set("v", id)
+		u.Host = "youtube.com"
+		u.Path = "/watch"
+		u.RawQuery = q.Encode()
+	},
+}
+
+// CanonicalURL returns the form of the s URL we use for storing and comparing links.
+// It removes the fragment and the tracking query parameters, normalises the host, and applies the
+// cleanups specific to some sites.
+func CanonicalURL(s string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return s, err
+	}
+	if u.Host == "" {
+		return s, errors.Newf("invalid URL %q", s)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := u.Hostname(), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	u.Host = canonicalHost(host)
+	if port != "" {
+		u.Host += ":" + port
+	}
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	q := u.Query()
+	for k := range q {
+		if isTrackingParam(k) {
+			q.Del(k)
+		}
+	}
+	// Encode sorts the parameters by key
+	u.RawQuery = q.Encode()
+
+	if rule, ok := domainRules[strings.TrimPrefix(u.Hostname(), "www.")]; ok {
+		rule(u)
+	}
+	return u.String(), nil
+}
+
+// linkKey returns the value we compare to decide if two URLs point to the same resource.
+// Besides the canonical form, it ignores the "www." prefix of the host, which is most of the time optional.
+func linkKey(s string) (string, error) {
+	c, err := CanonicalURL(s)
+	if err != nil {
+		return c, err
+	}
+	u, _ := url.Parse(c)
+	u.Host = strings.TrimPrefix(u.Host, "www.")
+	return u.String(), nil
+}
+
+// sameLink matches the objects whose URL has the link key it holds
+type sameLink string
+
+func (s sameLink) Match(it vocab.Item) bool {
+	match := false
+	_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+		if vocab.IsNil(ob.URL) {
+			return nil
+		}
+		k, err := linkKey(ob.URL.GetLink().String())
+		match = err == nil && k == string(s)
+		return nil
+	})
+	return match
+}
+
+var _ filters.Check = sameLink("")
+
+// sameLinkChecks loads the links with the same key as the u URL.
+// The stored links might not be in their canonical form, so we compare their keys instead of the URLs.
+func sameLinkChecks(u string) filters.Check {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return filters.HasType(vocab.PageType)
+	}
+	// we narrow the search to the most distinctive part of the URL first
+	like := pu.Host
+	parts := strings.Split(pu.Path, "/")
+	for _, vv := range pu.Query() {
+		parts = append(parts, vv...)
+	}
+	longest := ""
+	for _, p := range parts {
+		if len(p) > len(longest) {
+			longest = p
+		}
+	}
+	if longest != "" {
+		like = longest
+	}
+	return filters.All(
+		filters.HasType(vocab.PageType),
+		filters.Recipients(vocab.PublicNS),
+		filters.NilInReplyTo,
+		filters.URLLike(like),
+		sameLink(u),
+		filters.WithMaxCount(MaxContentItems),
+	)
+}
+
+// findSubmittedLink returns the most recent public item linking to the same URL as it
+func (r *repository) findSubmittedLink(ctx context.Context, it Item) (*Item, error) {
+	key, err := linkKey(it.Data)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.b.Search(sameLinkChecks(key))
+	if err != nil {
+		return nil, err
+	}
+	var found *Item
+	for _, li := range res {
+		ob, ok := li.(vocab.Item)
+		if !ok || vocab.IsNil(ob) {
+			continue
+		}
+		ex := Item{}
+		if err := ex.FromActivityPub(ob); err != nil || ex.Deleted() || !ex.IsLink() {
+			continue
+		}
+		if k, err := linkKey(ex.Data); err != nil || k != key {
+			continue
+		}
+		if found == nil || ex.SubmittedAt.After(found.SubmittedAt) {
+			found = &ex
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	items, err := r.loadItemsAuthors(ctx, *found)
+	if err != nil {
+		r.errFn(log.Ctx{"err": err.Error()})("unable to load submitted link author")
+		return found, nil
+	}
+	return &items[0], nil
+}
+
+// repostAllowed returns true if the previous submission of the same link is older than the grace period,
+// and the user explicitly asked to post it again.
+func repostAllowed(existing *Item, repost bool, grace time.Duration) bool {
+	return repost && time.Since(existing.SubmittedAt) > grace
+}
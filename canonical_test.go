@@ -0,0 +1,117 @@
+package brutalinks
+
+import (
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "not an URL",
+			url:     "lorem ipsum",
+			want:    "lorem ipsum",
+			wantErr: true,
+		},
+		{
+			name: "tracking parameters",
+			url:  "https://example.com/article?utm_source=feed&id=2&fbclid=xyz&UTM_Medium=rss",
+			want: "https://example.com/article?id=2",
+		},
+		{
+			name: "host and fragment",
+			url:  "HTTPS://WWW.Example.COM:443/Path#comments",
+			want: "https://www.example.com/Path",
+		},
+		{
+			name: "punycode host",
+			url:  "http://bücher.example/",
+			want: "http://xn--bcher-kva.example/",
+		},
+		{
+			name: "sorted query",
+			url:  "http://example.com/?b=2&a=1",
+			want: "http://example.com/?a=1&b=2",
+		},
+		{
+			name: "reddit variants",
+			url:  "https://old.reddit.com/r/golang/comments/abc/title/?share_id=123",
+			want: "https://reddit.com/r/golang/comments/abc/title/",
+		},
+		{
+			name: "twitter variants",
+			url:  "https://x.com/someone/status/1?s=20&t=abc",
+			want: "https://twitter.com/someone/status/1",
+		},
+		{
+			name: "reddit query",
+			url:  "https://www.reddit.com/r/golang/comments/abc/title/def/?context=3&utm_source=share&rdt=456",
+			want: "https://www.reddit.com/r/golang/comments/abc/title/def/?context=3",
+		},
+		{
+			name: "twitter query",
+			url:  "https://twitter.com/search?q=golang&s=20",
+			want: "https://twitter.com/search?q=golang",
+		},
+		{
+			name: "youtube short links",
+			url:  "https://youtu.be/dQw4w9WgXcQ?t=42",
+			want: "https://youtube.com/watch?t=42&v=dQw4w9WgXcQ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CanonicalURL(%q) error = %v, wantErr %t", tt.url, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CanonicalURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkKey(t *testing.T) {
+	same := [][2]string{
+		{"https://www.example.com/a?utm_campaign=x", "https://example.com/a"},
+		{"https://old.reddit.com/r/golang/", "https://www.reddit.com/r/golang/"},
+	}
+	for _, urls := range same {
+		k1, _ := linkKey(urls[0])
+		k2, _ := linkKey(urls[1])
+		if k1 != k2 {
+			t.Errorf("linkKey(%q) = %q, different than linkKey(%q) = %q", urls[0], k1, urls[1], k2)
+		}
+	}
+}
+
+func TestSameLink(t *testing.T) {
+	key, _ := linkKey("https://example.com")
+	tests := map[string]struct {
+		url  vocab.IRI
+		want bool
+	}{
+		"same host":            {url: "https://www.example.com/", want: true},
+		"same host with query": {url: "https://example.com/?utm_source=feed", want: true},
+		"page of the host":     {url: "https://example.com/about", want: false},
+		"other host":           {url: "https://example.org/", want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ob := &vocab.Object{Type: vocab.PageType, URL: tt.url}
+			if got := sameLink(key).Match(ob); got != tt.want {
+				t.Errorf("sameLink(%q).Match(%q) = %t, want %t", key, tt.url, got, tt.want)
+			}
+		})
+	}
+	if sameLink(key).Match(&vocab.Object{Type: vocab.PageType}) {
+		t.Errorf("sameLink(%q) matched an object without URL", key)
+	}
+}
@@ -0,0 +1,241 @@
+package brutalinks
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+// Conversation is a thread of private items exchanged by the same participants
+type Conversation struct {
+	// Key identifies the conversation by the IRI of the item that started the thread and the IRIs of its participants
+	Key string
+	// Participants are the accounts in the conversation, except the one reading it
+	Participants AccountPtrCollection
+	// Items are the private items of the conversation, oldest first
+	Items  ItemCollection
+	Unread bool
+}
+
+// First returns the item which started the conversation
+func (c Conversation) First() *Item {
+	if len(c.Items) == 0 {
+		return nil
+	}
+	return &c.Items[0]
+}
+
+// Last returns the latest item of the conversation
+func (c Conversation) Last() *Item {
+	if len(c.Items) == 0 {
+		return nil
+	}
+	return &c.Items[len(c.Items)-1]
+}
+
+func accountIRI(a *Account) vocab.IRI {
+	if a == nil {
+		return ""
+	}
+	if !vocab.IsNil(a.Pub) {
+		return a.Pub.GetLink()
+	}
+	if a.HasMetadata() {
+		return vocab.IRI(a.Metadata.ID)
+	}
+	return ""
+}
+
+// conversationRoot returns the IRI of the item that started the thread of the it item
+func conversationRoot(it Item) vocab.IRI {
+	if it.OP != nil && !vocab.IsNil(it.OP.AP()) {
+		return it.OP.AP().GetLink()
+	}
+	if it.Parent != nil && !vocab.IsNil(it.Parent.AP()) {
+		return it.Parent.AP().GetLink()
+	}
+	if !vocab.IsNil(it.Pub) {
+		return it.Pub.GetLink()
+	}
+	return ""
+}
+
+// conversationParticipants returns the author and the recipients of the it item, except the ones in ignore
+func conversationParticipants(it Item, ignore vocab.IRIs) map[vocab.IRI]Account {
+	participants := make(map[vocab.IRI]Account)
+	add := func(a Account) {
+		if iri := accountIRI(&a); iri != "" && !ignore.Contains(iri) {
+			participants[iri] = a
+		}
+	}
+	if it.SubmittedBy != nil {
+		add(*it.SubmittedBy)
+	}
+	if it.HasMetadata() {
+		for _, rec := range it.Metadata.To {
+			add(rec)
+		}
+		for _, rec := range it.Metadata.CC {
+			add(rec)
+		}
+	}
+	return participants
+}
+
+// groupConversations groups the private items by the thread they belong to and by their participants.
+// The accounts map is used for loading the participants, and the items published by other accounts after readAt
+// mark their conversation as unread. The conversations with the newest items are first.
+func groupConversations(items ItemCollection, self *Account, readAt time.Time, accounts map[vocab.IRI]Account, ignore vocab.IRIs) []Conversation {
+	selfIRI := accountIRI(self)
+	byKey := make(map[string]*Conversation)
+	keys := make([]string, 0)
+	for _, it := range items {
+		if !it.Private() {
+			continue
+		}
+		participants := conversationParticipants(it, ignore)
+		iris := make([]string, 0, len(participants))
+		for iri := range participants {
+			iris = append(iris, iri.String())
+		}
+		sort.Strings(iris)
+		key := conversationRoot(it).String() + " " + strings.Join(iris, " ")
+
+		c, ok := byKey[key]
+		if !ok {
+			c = &Conversation{Key: key}
+			for _, iri := range iris {
+				if vocab.IRI(iri).Equals(selfIRI, false) {
+					continue
+				}
+				acc, ok := accounts[vocab.IRI(iri)]
+				if !ok {
+					acc = participants[vocab.IRI(iri)]
+				}
+				c.Participants = append(c.Participants, &acc)
+			}
+			byKey[key] = c
+			keys = append(keys, key)
+		}
+		c.Items = append(c.Items, it)
+		if it.SubmittedAt.After(readAt) && !accountIRI(it.SubmittedBy).Equals(selfIRI, false) {
+			c.Unread = true
+		}
+	}
+
+	conversations := make([]Conversation, 0, len(keys))
+	for _, key := range keys {
+		c := byKey[key]
+		sort.SliceStable(c.Items, func(i, j int) bool {
+			return c.Items[i].SubmittedAt.Before(c.Items[j].SubmittedAt)
+		})
+		conversations = append(conversations, *c)
+	}
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return conversations[i].Last().SubmittedAt.After(conversations[j].Last().SubmittedAt)
+	})
+	return conversations
+}
+
+// loadConversations returns the conversations of the a account, from the private items in its inbox and outbox
+func (r *repository) loadConversations(ctx context.Context, a *Account, readAt time.Time) ([]Conversation, error) {
+	if !a.IsLogged() || vocab.IsNil(a.Pub) {
+		return nil, errors.Unauthorizedf("invalid account")
+	}
+
+	items := make(ItemCollection, 0)
+	seen := make(map[vocab.IRI]bool)
+	for _, col := range []vocab.IRI{vocab.Inbox.Of(a.Pub).GetLink(), vocab.Outbox.Of(a.Pub).GetLink()} {
+		res, err := r.b.SearchInCollection(col)
+		if err != nil {
+			return nil, err
+		}
+		for _, li := range res {
+			act, ok := li.(vocab.Item)
+			if !ok || vocab.IsNil(act) || act.GetType() != vocab.CreateType {
+				continue
+			}
+			it := Item{}
+			if err := it.FromActivityPub(act); err != nil || !it.IsValid() || !it.Private() || it.Deleted() || isPollAnswer(it) {
+				continue
+			}
+			if iri := it.Pub.GetLink(); !seen[iri] {
+				seen[iri] = true
+				items = append(items, it)
+			}
+		}
+	}
+	items, err := r.loadItemsAuthors(ctx, items...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the instance actor is in the audience of all the items, it's not a participant
+	ignore := vocab.IRIs{r.app.Pub.GetLink()}
+	iris := make(vocab.IRIs, 0)
+	for _, it := range items {
+		for iri := range conversationParticipants(it, ignore) {
+			_ = iris.Append(iri)
+		}
+	}
+	accounts, err := r.loadAccountsByIRI(iris)
+	if err != nil {
+		return nil, err
+	}
+	conversations := groupConversations(items, a, readAt, accounts, ignore)
+	if len(conversations) > MaxContentItems {
+		conversations = conversations[:MaxContentItems]
+	}
+	return conversations, nil
+}
+
+type conversationsModel struct {
+	Title         template.HTML
+	Conversations []Conversation
+}
+
+func (m *conversationsModel) SetTitle(s string) {
+	m.Title = template.HTML(s)
+}
+
+func (conversationsModel) Template() string {
+	return "conversations"
+}
+
+func (*conversationsModel) SetCursor(c *Cursor) {}
+
+// ConversationsModelMw loads the private conversations of the logged account
+func ConversationsModelMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acc := loggedAccount(r)
+		repo := ContextRepository(r.Context())
+		conversations, err := repo.loadConversations(r.Context(), acc, accountSettings(r, acc).ConversationsReadAt)
+		if err != nil {
+			ctxtErr(next, w, r, err)
+			return
+		}
+		m := &conversationsModel{Title: "Conversations", Conversations: conversations}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ModelCtxtKey, m)))
+	})
+}
+
+// HandleConversationsRead marks all the conversations of the logged account as read
+func (h *handler) HandleConversationsRead(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	_, err := h.storage.settings.Update(acc, func(st *AccountSettings) bool {
+		st.ConversationsReadAt = time.Now().UTC()
+		return true
+	})
+	if err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to save conversations state")
+		h.v.addFlashMessage(Error, w, r, "Unable to mark the conversations as read.")
+	}
+	h.v.Redirect(w, r, "/conversations", http.StatusSeeOther)
+}
@@ -0,0 +1,101 @@
+package brutalinks
+
+import (
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+)
+
+func TestGroupConversations(t *testing.T) {
+	alice := &Account{Handle: "alice", Pub: vocab.IRI("https://example.com/actors/alice")}
+	bob := &Account{Handle: "bob", Pub: vocab.IRI("https://example.com/actors/bob")}
+	carol := &Account{Handle: "carol", Pub: vocab.IRI("https://example.com/actors/carol")}
+	app := vocab.IRI("https://example.com/actors/app")
+	now := time.Now().UTC()
+
+	message := func(id string, by *Account, at time.Time, parent *Item, to ...*Account) Item {
+		it := Item{Pub: vocab.IRI("https://example.com/objects/" + id), SubmittedBy: by, SubmittedAt: at, Metadata: &ItemMetadata{}}
+		it.MakePrivate()
+		for _, rec := range to {
+			it.Metadata.To = append(it.Metadata.To, *rec)
+		}
+		it.Metadata.CC = AccountCollection{{Pub: app}}
+		if parent != nil {
+			it.Parent = parent
+			it.OP = parent
+		}
+		return it
+	}
+	first := message("1", alice, now.Add(-3*time.Hour), nil, bob)
+	group := message("2", alice, now.Add(-2*time.Hour), nil, bob, carol)
+	public := Item{Pub: vocab.IRI("https://example.com/objects/3"), SubmittedBy: bob, SubmittedAt: now}
+
+	tests := []struct {
+		name    string
+		items   ItemCollection
+		readAt  time.Time
+		want    []int
+		unread  []bool
+		handles [][]string
+	}{
+		{
+			name:  "empty",
+			items: ItemCollection{},
+			want:  []int{},
+		},
+		{
+			name:  "public items are ignored",
+			items: ItemCollection{public},
+			want:  []int{},
+		},
+		{
+			name:    "reply in the same conversation",
+			items:   ItemCollection{message("4", bob, now.Add(-time.Hour), &first, alice), first},
+			readAt:  now.Add(-2 * time.Hour),
+			want:    []int{2},
+			unread:  []bool{true},
+			handles: [][]string{{"bob"}},
+		},
+		{
+			name:    "read reply",
+			items:   ItemCollection{first, message("4", bob, now.Add(-time.Hour), &first, alice)},
+			readAt:  now,
+			want:    []int{2},
+			unread:  []bool{false},
+			handles: [][]string{{"bob"}},
+		},
+		{
+			name:    "different participants",
+			items:   ItemCollection{first, group, message("5", carol, now.Add(-time.Hour), &group, alice, bob)},
+			readAt:  now.Add(-4 * time.Hour),
+			want:    []int{2, 1},
+			unread:  []bool{true, false},
+			handles: [][]string{{"bob", "carol"}, {"bob"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := groupConversations(tt.items, alice, tt.readAt, nil, vocab.IRIs{app})
+			if len(got) != len(tt.want) {
+				t.Fatalf("groupConversations() returned %d conversations, want %d", len(got), len(tt.want))
+			}
+			for i, c := range got {
+				if len(c.Items) != tt.want[i] {
+					t.Errorf("conversation %d has %d items, want %d", i, len(c.Items), tt.want[i])
+				}
+				if c.Unread != tt.unread[i] {
+					t.Errorf("conversation %d unread = %t, want %t", i, c.Unread, tt.unread[i])
+				}
+				if len(c.Participants) != len(tt.handles[i]) {
+					t.Fatalf("conversation %d has %d participants, want %d", i, len(c.Participants), len(tt.handles[i]))
+				}
+				for j, p := range c.Participants {
+					if p.Handle != tt.handles[i][j] {
+						t.Errorf("conversation %d participant %d is %s, want %s", i, j, p.Handle, tt.handles[i][j])
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package brutalinks
 
 import (
+	"bytes"
 	"encoding/base64"
 	"net/url"
 	"path/filepath"
@@ -259,6 +260,20 @@ func (a *Account) FromActivityPub(it vocab.Item) error {
 	return nil
 }
 
+func FromQuestion(i *Item, q *vocab.Question) error {
+	err := vocab.OnObject(q, func(a *vocab.Object) error {
+		return FromArticle(i, a)
+	})
+	if err != nil {
+		return err
+	}
+	p := Poll{}
+	if err = p.FromActivityPub(q); err == nil && len(p.Options) > 0 {
+		i.Metadata.Poll = &p
+	}
+	return nil
+}
+
 func FromObjectWithBinaryData(i *Item, a *vocab.Object) error {
 	err := FromArticle(i, a)
 	if err != nil {
@@ -343,6 +358,26 @@ func FromTag(t *Tag, a *vocab.Object) error {
 	return nil
 }
 
+// sensitiveObject adds the "sensitive" property to the JSON document of the object it wraps
+type sensitiveObject struct {
+	vocab.Item
+}
+
+func (s sensitiveObject) MarshalJSON() ([]byte, error) {
+	raw, err := vocab.MarshalJSON(s.Item)
+	if err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) < 2 || raw[len(raw)-1] != '}' {
+		return nil, errors.Newf("unable to mark %s as sensitive", s.GetLink())
+	}
+	if len(bytes.TrimSpace(raw[1:len(raw)-1])) == 0 {
+		return []byte(`{"sensitive":true}`), nil
+	}
+	return append(raw[:len(raw)-1], `,"sensitive":true}`...), nil
+}
+
 var LocalHTMLPolicy = BlueMondayPolicy()
 
 func BlueMondayPolicy() *bluemonday.Policy {
@@ -367,12 +402,39 @@ func BlueMondayPolicy() *bluemonday.Policy {
 	return p
 }
 
+// pageLink returns the link of a Page object that Lemmy and kbin use for link submissions,
+// which is the href of its first Link attachment, instead of its URL property.
+func pageLink(a *vocab.Object) vocab.IRI {
+	if a.Type != vocab.PageType || vocab.IsNil(a.Attachment) {
+		return ""
+	}
+	attachments := vocab.ItemCollection{a.Attachment}
+	if vocab.IsItemCollection(a.Attachment) {
+		_ = vocab.OnCollectionIntf(a.Attachment, func(col vocab.CollectionInterface) error {
+			attachments = col.Collection()
+			return nil
+		})
+	}
+	for _, att := range attachments {
+		if vocab.IsNil(att) || att.GetType() != vocab.LinkType {
+			continue
+		}
+		if l, err := vocab.ToLink(att); err == nil && len(l.Href) > 0 {
+			return l.Href
+		}
+	}
+	return ""
+}
+
 func FromArticle(i *Item, a *vocab.Object) error {
 	_ = i.Hash.FromActivityPub(a)
 	if len(a.Name) > 0 {
 		i.Title = a.Name.First().String()
 	}
-	if len(a.Content) > 0 {
+	if href := pageLink(a); len(href) > 0 {
+		i.Data = href.String()
+		i.MimeType = MimeTypeURL
+	} else if len(a.Content) > 0 {
 		i.MimeType = MimeTypeHTML
 		if len(a.MediaType) > 0 {
 			i.MimeType = string(a.MediaType)
@@ -387,6 +449,7 @@ func FromArticle(i *Item, a *vocab.Object) error {
 	if i.Metadata == nil {
 		i.Metadata = &ItemMetadata{}
 	}
+	loadLanguageVariants(i, a)
 
 	if a.AttributedTo != nil {
 		auth := Account{Metadata: &AccountMetadata{}}
@@ -406,6 +469,18 @@ func FromArticle(i *Item, a *vocab.Object) error {
 			return iconMetadataFromObject(&i.Metadata.Icon, o)
 		})
 	}
+	if a.Preview != nil && i.IsLink() {
+		p := LinkPreview{URL: i.Data}
+		if err := p.FromActivityPub(a.Preview); err == nil && p.IsValid() {
+			i.Metadata.Preview = &p
+		}
+	}
+	if a.Attachment != nil {
+		att := AttachmentCollection{}
+		if err := att.FromActivityPub(a.Attachment); err == nil && len(att) > 0 {
+			i.Metadata.Attachments = att
+		}
+	}
 	if a.Context != nil {
 		op := Item{}
 		_ = op.FromActivityPub(a.Context)
@@ -621,6 +696,10 @@ func (i *Item) FromActivityPub(it vocab.Item) error {
 		return vocab.OnObject(it, func(a *vocab.Object) error {
 			return FromArticle(i, a)
 		})
+	case vocab.QuestionType:
+		return vocab.OnQuestion(it, func(q *vocab.Question) error {
+			return FromQuestion(i, q)
+		})
 	case vocab.ImageType, vocab.VideoType, vocab.AudioType:
 		return vocab.OnObject(it, func(a *vocab.Object) error {
 			return FromObjectWithBinaryData(i, a)
@@ -691,6 +770,33 @@ func (v *Vote) FromActivityPub(it vocab.Item) error {
 		return errors.Newf("unable to load from IRI")
 	}
 	switch it.GetType() {
+	case vocab.AnnounceType:
+		// the vote is the announced activity
+		return vocab.OnActivity(it, func(act *vocab.Activity) error {
+			if vocab.IsNil(act.Object) {
+				return errors.Newf("nil announced activity")
+			}
+			if typ := act.Object.GetType(); typ != vocab.UndoType && !ValidAppreciationTypes.Match(typ) {
+				return errors.Newf("invalid announced activity type %q", typ)
+			}
+			// the votes of the local accounts are never received through a remote group
+			var actor vocab.Item
+			_ = vocab.OnActivity(act.Object, func(voteAct *vocab.Activity) error {
+				actor = voteAct.Actor
+				return nil
+			})
+			if vocab.IsNil(actor) || HostIsLocal(actor.GetLink().String()) {
+				return errors.Newf("invalid actor for announced activity")
+			}
+			if vocab.IsNil(act.Actor) {
+				return errors.Newf("nil actor for announce")
+			}
+			if err := v.FromActivityPub(act.Object); err != nil {
+				return err
+			}
+			v.Metadata.AnnouncedBy = act.Actor.GetLink().String()
+			return nil
+		})
 	case vocab.UndoType, vocab.LikeType, vocab.DislikeType:
 		fromAct := func(act vocab.Activity, v *Vote) {
 			on := Item{}
@@ -0,0 +1,126 @@
+package brutalinks
+
+import (
+	"encoding/json"
+	"testing"
+
+	"git.sr.ht/~mariusor/brutalinks/internal/config"
+	vocab "github.com/go-ap/activitypub"
+)
+
+func TestPageLink(t *testing.T) {
+	link := &vocab.Link{Type: vocab.LinkType, Href: "https://example.com/article"}
+	tests := map[string]struct {
+		ob   *vocab.Object
+		want vocab.IRI
+	}{
+		"page without attachment": {
+			ob: &vocab.Object{Type: vocab.PageType},
+		},
+		"page with link attachment": {
+			ob:   &vocab.Object{Type: vocab.PageType, Attachment: link},
+			want: "https://example.com/article",
+		},
+		"page with link in attachments": {
+			ob: &vocab.Object{Type: vocab.PageType, Attachment: vocab.ItemCollection{
+				&vocab.Object{Type: vocab.ImageType, URL: vocab.IRI("https://example.com/image.png")},
+				link,
+			}},
+			want: "https://example.com/article",
+		},
+		"note with link attachment": {
+			ob: &vocab.Object{Type: vocab.NoteType, Attachment: link},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := pageLink(tt.ob); got != tt.want {
+				t.Errorf("pageLink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoteFromAnnounce(t *testing.T) {
+	Instance = new(Application)
+	Instance.Conf = &config.Configuration{HostName: "brutalinks.git", APIURL: "https://fedbox.git"}
+
+	like := &vocab.Activity{
+		ID:     "https://lemmy.example.com/activities/like/1",
+		Type:   vocab.DislikeType,
+		Actor:  vocab.IRI("https://lemmy.example.com/u/jdoe"),
+		Object: vocab.IRI("https://lemmy.example.com/post/1"),
+	}
+	announce := &vocab.Activity{
+		ID:     "https://lemmy.example.com/activities/announce/1",
+		Type:   vocab.AnnounceType,
+		Actor:  vocab.IRI("https://lemmy.example.com/c/golang"),
+		Object: like,
+	}
+
+	v := Vote{}
+	if err := v.FromActivityPub(announce); err != nil {
+		t.Fatalf("unable to load vote from announce: %s", err)
+	}
+	if v.Weight != -1 {
+		t.Errorf("vote weight = %d, want -1", v.Weight)
+	}
+	if v.Metadata == nil || v.Metadata.IRI != like.ID.String() {
+		t.Errorf("vote was not loaded from the announced activity")
+	}
+	if v.Metadata.AnnouncedBy != announce.Actor.GetLink().String() {
+		t.Errorf("vote announced by = %q, want %q", v.Metadata.AnnouncedBy, announce.Actor.GetLink())
+	}
+
+	announce.Object = &vocab.Activity{
+		ID:     "https://lemmy.example.com/activities/undo/1",
+		Type:   vocab.UndoType,
+		Actor:  like.Actor,
+		Object: like,
+	}
+	undo := Vote{}
+	if err := undo.FromActivityPub(announce); err != nil {
+		t.Fatalf("unable to load vote from announced undo: %s", err)
+	}
+	if undo.Weight != 0 || undo.Metadata == nil || undo.Metadata.OriginalIRI != like.ID.String() {
+		t.Errorf("announced undo was not loaded as the undo of %s", like.ID)
+	}
+
+	announce.Object = vocab.IRI("https://lemmy.example.com/post/1")
+	if err := (&Vote{}).FromActivityPub(announce); err == nil {
+		t.Errorf("expected an error for an announce which is not a vote")
+	}
+
+	announce.Object = &vocab.Activity{
+		ID:     "https://lemmy.example.com/activities/like/2",
+		Type:   vocab.LikeType,
+		Actor:  vocab.IRI("https://fedbox.git/actors/jdoe"),
+		Object: vocab.IRI("https://lemmy.example.com/post/1"),
+	}
+	if err := (&Vote{}).FromActivityPub(announce); err == nil {
+		t.Errorf("expected an error for an announced vote of a local actor")
+	}
+}
+
+func TestSensitiveObjectMarshalJSON(t *testing.T) {
+	ob := &vocab.Object{ID: "https://fedbox.git/objects/1", Type: vocab.NoteType, Summary: vocab.DefaultNaturalLanguage("spoilers")}
+	act := &vocab.Activity{Type: vocab.CreateType, Actor: vocab.IRI("https://fedbox.git/actors/jdoe"), Object: sensitiveObject{ob}}
+
+	raw, err := vocab.MarshalJSON(act)
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %s", err)
+	}
+	doc := struct {
+		Object struct {
+			ID        string `json:"id"`
+			Summary   string `json:"summary"`
+			Sensitive bool   `json:"sensitive"`
+		} `json:"object"`
+	}{}
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("MarshalJSON() returned invalid JSON %s: %s", raw, err)
+	}
+	if !doc.Object.Sensitive || doc.Object.ID != ob.ID.String() || doc.Object.Summary != "spoilers" {
+		t.Errorf("MarshalJSON() = %s, want the object marked as sensitive", raw)
+	}
+}
@@ -1,6 +1,7 @@
 package brutalinks
 
 import (
+	"slices"
 	"sort"
 	"time"
 
@@ -12,6 +13,8 @@ type Cursor struct {
 	before vocab.IRI
 	items  RenderableList
 	total  uint
+	// ranked is the name of the ranking the items are already ordered by
+	ranked string
 }
 
 var emptyCursor = Cursor{}
@@ -87,7 +90,16 @@ func ByDate(r RenderableList) []Renderable {
 	return rl
 }
 
-func ByScore(r RenderableList) []Renderable {
+// ByOldest orders ascending by the submission date
+func ByOldest(r RenderableList) []Renderable {
+	rl := ByDate(r)
+	slices.Reverse(rl)
+	return rl
+}
+
+// byItemScore orders the items in the list descending by the value of scoreFn,
+// falling back to the date order for equal scores and for the other renderable types.
+func byItemScore(r RenderableList, scoreFn func(*Item) float64) []Renderable {
 	if !Instance.Conf.VotingEnabled {
 		return ByDate(r)
 	}
@@ -96,27 +108,53 @@ func ByScore(r RenderableList) []Renderable {
 		rl = append(rl, rr)
 	}
 	sort.SliceStable(rl, func(i, j int) bool {
-		var hi, hj float64
-
 		ri := rl[i]
 		ii, oki := ri.(*Item)
 
 		rj := rl[j]
 		ij, okj := rj.(*Item)
-		if oki {
-			hi = Hacker(int64(ii.Votes.Score()), time.Now().Sub(ii.SubmittedAt))
-		}
-		if okj {
-			hj = Hacker(int64(ij.Votes.Score()), time.Now().Sub(ij.SubmittedAt))
-		}
-		if oki && okj && hi+hj > 0 {
-			return hi >= hj
+		if oki && okj {
+			if hi, hj := scoreFn(ii), scoreFn(ij); hi != hj {
+				return hi > hj
+			}
 		}
 		return ri.Date().After(rj.Date())
 	})
 	return rl
 }
 
+func voteSplit(votes VoteCollection) (int64, int64) {
+	return int64(votes.Ups()), int64(votes.Downs())
+}
+
+// ByScore orders by the HackerNews hot score
+func ByScore(r RenderableList) []Renderable {
+	return byItemScore(r, func(it *Item) float64 {
+		return Hacker(int64(it.Votes.Score()), time.Now().Sub(it.SubmittedAt))
+	})
+}
+
+// ByTopScore orders by the net score of the votes
+func ByTopScore(r RenderableList) []Renderable {
+	return byItemScore(r, func(it *Item) float64 {
+		return float64(it.Votes.Score())
+	})
+}
+
+// ByControversy orders by the number of votes and how evenly they are split
+func ByControversy(r RenderableList) []Renderable {
+	return byItemScore(r, func(it *Item) float64 {
+		return Controversy(voteSplit(it.Votes))
+	})
+}
+
+// ByWilsonScore orders by the lower bound of the Wilson score confidence interval
+func ByWilsonScore(r RenderableList) []Renderable {
+	return byItemScore(r, func(it *Item) float64 {
+		return Wilson(voteSplit(it.Votes))
+	})
+}
+
 func lastUpdatedInThread(it Renderable) time.Time {
 	maxDate := it.Date()
 	ob, ok := it.(*Item)
@@ -143,3 +181,99 @@ func ByRecentActivity(r RenderableList) []Renderable {
 	})
 	return rl
 }
+
+// pageIRIs returns count of the iris following the after reference, or preceding the before one,
+// together with the bounds for the previous and next pages.
+// It returns false if the references can't be found in iris.
+func pageIRIs(iris vocab.IRIs, after, before string, count int) (vocab.IRIs, vocab.IRI, vocab.IRI, bool) {
+	indexOf := func(ref string) int {
+		for i, iri := range iris {
+			if IRIRef(iri).String() == ref {
+				return i
+			}
+		}
+		return -1
+	}
+	start := 0
+	if after != "" {
+		if start = indexOf(after) + 1; start == 0 {
+			return nil, "", "", false
+		}
+	}
+	if before != "" {
+		end := indexOf(before)
+		if end < 0 {
+			return nil, "", "", false
+		}
+		if start = end - count; start < 0 {
+			start = 0
+		}
+	}
+	end := start + count
+	if end > len(iris) {
+		end = len(iris)
+	}
+	page := iris[start:end]
+
+	var prev, next vocab.IRI
+	if start > 0 && len(page) > 0 {
+		prev = page[0]
+	}
+	if end < len(iris) && len(page) > 0 {
+		next = page[len(page)-1]
+	}
+	return page, prev, next, true
+}
+
+type SortFn func(RenderableList) []Renderable
+
+// keepOrder leaves the items in the order they were loaded in
+func keepOrder(r RenderableList) []Renderable {
+	return r
+}
+
+const (
+	SortHot    = "hot"
+	SortTop    = "top"
+	SortWilson = "wilson"
+	SortNew    = "new"
+	SortActive = "active"
+
+	SortControversial = "controversial"
+	SortBest          = "best"
+	SortOld           = "old"
+)
+
+// sortOptions is the order in which the rankings are offered to users
+var sortOptions = []string{SortHot, SortTop, SortWilson, SortControversial, SortNew, SortActive}
+
+// threadSortOptions are the rankings offered for the replies of an item
+var threadSortOptions = []string{SortBest, SortNew, SortOld, SortControversial}
+
+var rankings = map[string]SortFn{
+	SortHot:    ByScore,
+	SortTop:    ByTopScore,
+	SortWilson: ByWilsonScore,
+	SortNew:    ByDate,
+	SortActive: ByRecentActivity,
+
+	SortControversial: ByControversy,
+	SortBest:          ByWilsonScore,
+	SortOld:           ByOldest,
+}
+
+// RegisterRanking adds a new sort function to the rankings users can choose from
+func RegisterRanking(name string, fn SortFn) {
+	if _, ok := rankings[name]; !ok {
+		sortOptions = append(sortOptions, name)
+	}
+	rankings[name] = fn
+}
+
+// ranking returns the sort function registered under name, or the date sort if there's none
+func ranking(name string) (string, SortFn) {
+	if fn, ok := rankings[name]; ok {
+		return name, fn
+	}
+	return SortNew, ByDate
+}
@@ -0,0 +1,211 @@
+package brutalinks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+)
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+
+	// DigestCheckInterval is how often we look for the accounts that are due a digest email
+	DigestCheckInterval = time.Hour
+	// DigestTopThreads is the number of top threads in a digest
+	DigestTopThreads = 10
+)
+
+var digestIntervals = map[string]time.Duration{
+	DigestDaily:  24 * time.Hour,
+	DigestWeekly: 7 * 24 * time.Hour,
+}
+
+// digestDue returns true if the account wants digests, and its digest interval passed since it received the last one
+func (s AccountSettings) digestDue(now time.Time) bool {
+	dur, ok := digestIntervals[s.Digest]
+	if !ok || !(s.WantsEmail(EmailDigestReplies) || s.WantsEmail(EmailDigestThreads)) {
+		return false
+	}
+	return now.Sub(s.DigestSentAt) >= dur
+}
+
+// digestSender emails the digests to the accounts which chose to receive them
+type digestSender struct {
+	r       *repository
+	stop    chan struct{}
+	stopped sync.Once
+}
+
+// digestSenderNew starts checking every interval for the accounts that are due a digest.
+// If there's no email configured, or the interval is not greater than zero, it returns nil.
+func digestSenderNew(r *repository, interval time.Duration) *digestSender {
+	if r == nil || r.mail == nil || interval <= 0 {
+		return nil
+	}
+	ds := &digestSender{r: r, stop: make(chan struct{})}
+	go ds.run(interval)
+	return ds
+}
+
+func (ds *digestSender) run(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			ds.send(now.UTC())
+		case <-ds.stop:
+			return
+		}
+	}
+}
+
+// Stop ends the background sending of the digests
+func (ds *digestSender) Stop() {
+	if ds == nil {
+		return
+	}
+	ds.stopped.Do(func() { close(ds.stop) })
+}
+
+// send emails the digests to the accounts that are due one
+func (ds *digestSender) send(now time.Time) {
+	r := ds.r
+	hashes, err := r.settings.Hashes()
+	if err != nil {
+		r.errFn(log.Ctx{"err": err.Error()})("unable to load the accounts with settings")
+		return
+	}
+	ctx := context.Background()
+	top := make(map[string]ItemCollection)
+	for _, h := range hashes {
+		acc, err := r.LoadAccount(ctx, actors.IRI(r.fedbox.Service()).AddPath(h.String()))
+		if err != nil || !acc.IsLogged() {
+			continue
+		}
+		st, err := r.settings.Load(acc)
+		if err != nil || !st.digestDue(now) {
+			continue
+		}
+		since := now.Add(-digestIntervals[st.Digest])
+		if st.DigestSentAt.After(since) {
+			since = st.DigestSentAt
+		}
+
+		var replies []Notification
+		if st.WantsEmail(EmailDigestReplies) {
+			// the replies the account has already read are left out, even if they are newer than the previous digest
+			readAt := since
+			if st.NotificationsReadAt.After(readAt) {
+				readAt = st.NotificationsReadAt
+			}
+			notifications, err := r.loadNotifications(ctx, acc, readAt)
+			if err != nil {
+				r.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to load digest replies")
+			}
+			for _, n := range notifications {
+				if n.Unread && (n.IsReply() || n.IsMention()) {
+					replies = append(replies, n)
+				}
+			}
+		}
+		var threads ItemCollection
+		if st.WantsEmail(EmailDigestThreads) {
+			if _, ok := top[st.Digest]; !ok {
+				if top[st.Digest], err = r.loadTopItems(ctx, now.Add(-digestIntervals[st.Digest]), DigestTopThreads); err != nil {
+					r.errFn(log.Ctx{"err": err.Error()})("unable to load digest threads")
+				}
+			}
+			threads = top[st.Digest]
+		}
+
+		if len(replies) > 0 || len(threads) > 0 {
+			subject, body := digestMessage(r.SelfURL, acc, st.Digest, replies, threads)
+			if err = r.mail.Send(st.Email, subject, body); err != nil {
+				r.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to send digest email")
+				continue
+			}
+		}
+		// the account could have changed its settings while we were sending the digest, so we save only the time
+		_, err = r.settings.Update(acc, func(st *AccountSettings) bool {
+			st.DigestSentAt = now
+			return true
+		})
+		if err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to save digest state")
+		}
+	}
+}
+
+// loadTopItems returns the count top level items with the best scores, from the ones published after since
+func (r *repository) loadTopItems(ctx context.Context, since time.Time, count int) (ItemCollection, error) {
+	res, err := r.b.Search(append(rankCandidateChecks(), filters.WithMaxCount(RankIndexSize))...)
+	if err != nil {
+		return nil, err
+	}
+	items := make(ItemCollection, 0, len(res))
+	for _, li := range res {
+		it, ok := li.(vocab.Item)
+		if !ok || vocab.IsNil(it) {
+			continue
+		}
+		i := Item{}
+		if err := i.FromActivityPub(it); err != nil || i.Deleted() || i.SubmittedAt.Before(since) {
+			continue
+		}
+		items = append(items, i)
+	}
+	if items, err = r.loadItemsVotes(ctx, items...); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		si, sj := items[i].Votes.Score(), items[j].Votes.Score()
+		return si > sj || (si == sj && items[i].SubmittedAt.After(items[j].SubmittedAt))
+	})
+	if len(items) > count {
+		items = items[:count]
+	}
+	return items, nil
+}
+
+// digestMessage returns the subject and the body of the digest email for the a account
+func digestMessage(baseURL string, a *Account, interval string, replies []Notification, threads ItemCollection) (string, string) {
+	link := func(it *Item) string {
+		l := ItemPermaLink(it)
+		if strings.HasPrefix(l, "/") {
+			l = baseURL + l
+		}
+		return l
+	}
+	body := strings.Builder{}
+	fmt.Fprintf(&body, "Hello %s,\n\nThis is your %s digest from %s.\n", a.Handle, interval, baseURL)
+	if len(replies) > 0 {
+		body.WriteString("\nReplies and mentions:\n\n")
+		for _, n := range replies {
+			action := "replied to you"
+			if n.IsMention() {
+				action = "mentioned you"
+			}
+			fmt.Fprintf(&body, "* %s %s: %s\n", n.Actor.Handle, action, link(n.Item))
+		}
+	}
+	if len(threads) > 0 {
+		body.WriteString("\nTop threads:\n\n")
+		for i := range threads {
+			it := &threads[i]
+			fmt.Fprintf(&body, "* %s (%d points): %s\n", it.Title, it.Votes.Score(), link(it))
+		}
+	}
+	fmt.Fprintf(&body, "\nYou can choose which emails you receive in your settings: %s/settings\n", baseURL)
+
+	subject := fmt.Sprintf("Your %s digest from %s", interval, strings.TrimPrefix(strings.TrimPrefix(baseURL, "https://"), "http://"))
+	return subject, body.String()
+}
@@ -0,0 +1,106 @@
+package brutalinks
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDigestDue(t *testing.T) {
+	now := time.Now().UTC()
+	confirmed := AccountSettings{Email: "jdoe@example.com", EmailConfirmed: true}
+	tests := []struct {
+		name     string
+		settings func(AccountSettings) AccountSettings
+		want     bool
+	}{
+		{
+			name:     "no digest interval",
+			settings: func(s AccountSettings) AccountSettings { s.Emails = []string{EmailDigestReplies}; return s },
+			want:     false,
+		},
+		{
+			name: "no digest emails chosen",
+			settings: func(s AccountSettings) AccountSettings {
+				s.Digest, s.Emails = DigestDaily, []string{EmailPasswordReset}
+				return s
+			},
+			want: false,
+		},
+		{
+			name: "never sent",
+			settings: func(s AccountSettings) AccountSettings {
+				s.Digest, s.Emails = DigestDaily, []string{EmailDigestReplies}
+				return s
+			},
+			want: true,
+		},
+		{
+			name: "daily sent yesterday",
+			settings: func(s AccountSettings) AccountSettings {
+				s.Digest, s.Emails, s.DigestSentAt = DigestDaily, []string{EmailDigestThreads}, now.Add(-25*time.Hour)
+				return s
+			},
+			want: true,
+		},
+		{
+			name: "weekly sent yesterday",
+			settings: func(s AccountSettings) AccountSettings {
+				s.Digest, s.Emails, s.DigestSentAt = DigestWeekly, []string{EmailDigestThreads}, now.Add(-25*time.Hour)
+				return s
+			},
+			want: false,
+		},
+		{
+			name: "email not confirmed",
+			settings: func(s AccountSettings) AccountSettings {
+				s.Digest, s.Emails, s.EmailConfirmed = DigestDaily, []string{EmailDigestReplies}, false
+				return s
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.settings(confirmed).digestDue(now); got != tt.want {
+				t.Errorf("digestDue() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestMessage(t *testing.T) {
+	baseURL := "https://example.com"
+	jdoe := &Account{Handle: "jdoe"}
+	alice := &Account{Handle: "alice"}
+	reply := &Item{Hash: Hash(uuid.New()), SubmittedBy: alice}
+	mention := &Item{Hash: Hash(uuid.New()), SubmittedBy: alice}
+	thread := Item{Hash: Hash(uuid.New()), Title: "Top thread", SubmittedBy: jdoe}
+
+	replies := []Notification{
+		{Type: NotificationReply, Actor: alice, Item: reply},
+		{Type: NotificationMention, Actor: alice, Item: mention},
+	}
+	subject, body := digestMessage(baseURL, jdoe, DigestWeekly, replies, ItemCollection{thread})
+	if subject != "Your weekly digest from example.com" {
+		t.Errorf("digestMessage() subject = %q", subject)
+	}
+	for _, want := range []string{
+		"Hello jdoe,",
+		"alice replied to you: " + baseURL + "/~alice/" + reply.Hash.String(),
+		"alice mentioned you: " + baseURL + "/~alice/" + mention.Hash.String(),
+		"Top thread (0 points): " + baseURL + "/~jdoe/" + thread.Hash.String(),
+		baseURL + "/settings",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("digestMessage() body doesn't contain %q:\n%s", want, body)
+		}
+	}
+
+	_, body = digestMessage(baseURL, jdoe, DigestDaily, nil, ItemCollection{thread})
+	if strings.Contains(body, "Replies and mentions") {
+		t.Errorf("digestMessage() body contains the replies section without replies:\n%s", body)
+	}
+}
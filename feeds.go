@@ -0,0 +1,500 @@
+package brutalinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"html/template"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "git.sr.ht/~mariusor/lw"
+	"github.com/go-chi/chi/v5"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+type feedType string
+
+const (
+	feedNone feedType = ""
+	feedRSS  feedType = "rss"
+	feedAtom feedType = "atom"
+
+	MimeTypeRSS  = "application/rss+xml"
+	MimeTypeAtom = "application/atom+xml"
+
+	feedTitleMaxLen = 80
+)
+
+var feedMimeTypes = map[feedType]string{
+	feedRSS:  MimeTypeRSS,
+	feedAtom: MimeTypeAtom,
+}
+
+func ContextFeedType(ctx context.Context) feedType {
+	if f, ok := ctx.Value(FeedCtxtKey).(feedType); ok {
+		return f
+	}
+	return feedNone
+}
+
+// acceptedMediaType returns the media type from offers that the request's Accept header
+// prefers the most, or an empty string if none of them is explicitly accepted.
+// Wildcard ranges are ignored, ties are broken by the order in which they appear in the header.
+func acceptedMediaType(r *http.Request, offers ...string) string {
+	best := ""
+	bestQ := 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || strings.Contains(mt, "*") {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		for _, o := range offers {
+			if strings.EqualFold(mt, o) {
+				best = o
+				bestQ = q
+				break
+			}
+		}
+	}
+	return best
+}
+
+func feedTypeFromAccept(r *http.Request) feedType {
+	switch acceptedMediaType(r, MimeTypeHTML, MimeTypeRSS, MimeTypeAtom) {
+	case MimeTypeRSS:
+		return feedRSS
+	case MimeTypeAtom:
+		return feedAtom
+	}
+	return feedNone
+}
+
+// feedPaths are the listings which have feeds
+var feedPaths = []*regexp.Regexp{
+	regexp.MustCompile(`^/$`),
+	regexp.MustCompile(`^/~[^/]+$`),
+	regexp.MustCompile(`^/g/[^/]+$`),
+	regexp.MustCompile(`^/d/[^/]+(/top/[^/]+)?$`),
+	regexp.MustCompile(`^/top(/[^/]+)?$`),
+	regexp.MustCompile(`^/t/[^/]+(/top/[^/]+)?$`),
+	regexp.MustCompile(`^/(self|federated|followed)$`),
+}
+
+func isFeedPath(p string) bool {
+	for _, re := range feedPaths {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedMw checks if the request asks for an RSS or Atom feed, either by a ".rss"/".atom"
+// suffix on the path of a listing, or through the Accept header.
+// The suffix is stripped from the routing path, so it needs to run before the routes get matched.
+func FeedMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p string
+		rctx := chi.RouteContext(r.Context())
+		if rctx != nil && rctx.RoutePath != "" {
+			p = rctx.RoutePath
+		} else {
+			p = r.URL.Path
+		}
+
+		typ := feedNone
+		switch ext := path.Ext(p); {
+		case (ext == ".rss" || ext == ".atom") && isFeedPath(listingPath(p)):
+			typ = feedType(ext[1:])
+			p = listingPath(p)
+			if rctx != nil {
+				rctx.RoutePath = p
+			} else {
+				r.URL.Path = p
+			}
+		default:
+			typ = feedTypeFromAccept(r)
+		}
+		if typ == feedNone {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), FeedCtxtKey, typ)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Feed renders the listing model as an RSS or Atom feed when the request asked for one,
+// and marks the listing as having feeds otherwise.
+func (h *handler) Feed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := ContextListingModel(r.Context())
+		if m == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m.feeds = true
+		typ := ContextFeedType(r.Context())
+		if typ == feedNone {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cursor := ContextCursor(r.Context()); cursor != nil {
+			m.SetCursor(cursor)
+		}
+		if err := h.v.RenderFeed(r, w, typ, m); err != nil {
+			h.v.HandleErrors(w, r, err)
+		}
+	})
+}
+
+func hasFeeds(m any) bool {
+	l, ok := m.(*listingModel)
+	return ok && l.feeds
+}
+
+// feedLink returns the path of the typ feed corresponding to the current page
+func feedLink(r *http.Request, typ string) string {
+	p := strings.TrimSuffix(r.URL.Path, path.Ext(r.URL.Path))
+	p = strings.TrimRight(p, "/")
+	if p == "" {
+		p = "/index"
+	}
+	return p + "." + typ
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomPerson     `xml:"author"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Generator string      `xml:"generator,omitempty"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Comments    string   `xml:"comments,omitempty"`
+	GUID        rssGUID  `xml:"guid"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description,omitempty"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	Generator     string     `xml:"generator,omitempty"`
+	LastBuildDate string     `xml:"lastBuildDate"`
+	Links         []atomLink `xml:"atom:link"`
+	Items         []rssItem  `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// feedEntry holds the values that both feed formats need for an item
+type feedEntry struct {
+	id        string
+	title     string
+	link      string
+	permaLink string
+	author    atomPerson
+	published time.Time
+	updated   time.Time
+	tags      []string
+	content   string
+}
+
+func absURL(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return strings.TrimRight(Instance.BaseURL.String(), "/") + p
+	}
+	return p
+}
+
+// listingPath returns the path of the HTML listing for a feed path
+func listingPath(p string) string {
+	p = strings.TrimSuffix(p, path.Ext(p))
+	if p == "/index" || p == "" {
+		p = "/"
+	}
+	return p
+}
+
+func feedItemTitle(it *Item) string {
+	if len(it.Title) > 0 {
+		return it.Title
+	}
+	t := strings.Join(strings.Fields(bluemonday.StrictPolicy().Sanitize(it.Data)), " ")
+	if utf8.RuneCountInString(t) > feedTitleMaxLen {
+		t = string([]rune(t)[:feedTitleMaxLen]) + "…"
+	}
+	if len(t) == 0 {
+		t = "Untitled"
+	}
+	return t
+}
+
+// feedItemContent returns the HTML content of it, replaceTags sorts the tags, so it works on a copy of the item
+func feedItemContent(it *Item) string {
+	c := *it
+	m := ItemMetadata{}
+	if it.HasMetadata() {
+		m = *it.Metadata
+	}
+	m.Tags = slices.Clone(m.Tags)
+	m.Mentions = slices.Clone(m.Mentions)
+	c.Metadata = &m
+	switch c.MimeType {
+	case MimeTypeMarkdown:
+		return string(Markdown(replaceTags(MimeTypeMarkdown, &c)))
+	case MimeTypeHTML:
+		return replaceTags(MimeTypeHTML, &c)
+	case MimeTypeText:
+		return "<p>" + template.HTMLEscapeString(c.Data) + "</p>"
+	}
+	return ""
+}
+
+func feedEntries(m *listingModel) []feedEntry {
+	var list []Renderable
+	if m.sortFn != nil {
+		list = m.Sorted()
+	} else {
+		list = m.children
+	}
+	entries := make([]feedEntry, 0, len(list))
+	for _, ren := range list {
+		it, ok := ren.(*Item)
+		if !ok || !it.IsValid() || it.Deleted() || it.Private() {
+			continue
+		}
+		e := feedEntry{
+			title:     feedItemTitle(it),
+			permaLink: absURL(ItemPermaLink(it)),
+			published: it.SubmittedAt.UTC(),
+			updated:   it.UpdatedAt.UTC(),
+			content:   feedItemContent(it),
+		}
+		e.id = e.permaLink
+		e.link = e.permaLink
+		if it.IsLink() {
+			e.link = it.Data
+		}
+		if e.updated.IsZero() || e.updated.Before(e.published) {
+			e.updated = e.published
+		}
+		if it.SubmittedBy != nil {
+			e.author = atomPerson{Name: ShowAccountHandle(it.SubmittedBy), URI: absURL(AccountPermaLink(it.SubmittedBy))}
+		} else {
+			e.author = atomPerson{Name: Anonymous}
+		}
+		if it.HasMetadata() {
+			if len(it.Metadata.ID) > 0 {
+				e.id = it.Metadata.ID
+			}
+			for _, t := range it.Metadata.Tags {
+				e.tags = append(e.tags, strings.TrimPrefix(t.Name, "#"))
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func lastUpdated(entries []feedEntry) time.Time {
+	if len(entries) == 0 {
+		return time.Now().UTC()
+	}
+	last := entries[0].updated
+	for _, e := range entries[1:] {
+		if e.updated.After(last) {
+			last = e.updated
+		}
+	}
+	return last
+}
+
+func pageLinks(r *http.Request, m *listingModel) []atomLink {
+	self := absURL(r.URL.Path)
+	links := []atomLink{{Rel: "self", Type: feedMimeTypes[ContextFeedType(r.Context())], Href: self}}
+	if r.URL.RawQuery != "" {
+		links[0].Href += "?" + r.URL.RawQuery
+	}
+	if next := m.NextPage(); next != "" {
+		links = append(links, atomLink{Rel: "next", Href: self + string(pageLinkWithQuery(r, nextPageLink(next)))})
+	}
+	if prev := m.PrevPage(); prev != "" {
+		links = append(links, atomLink{Rel: "previous", Href: self + string(pageLinkWithQuery(r, prevPageLink(prev)))})
+	}
+	return links
+}
+
+func (v *view) atomFeed(r *http.Request, m *listingModel) atomFeed {
+	entries := feedEntries(m)
+	f := atomFeed{
+		ID:        absURL(r.URL.Path),
+		Title:     feedTitle(v, m),
+		Updated:   lastUpdated(entries).Format(time.RFC3339),
+		Generator: v.c.Name,
+		Links:     pageLinks(r, m),
+		Entries:   make([]atomEntry, 0, len(entries)),
+	}
+	f.Links = append(f.Links, atomLink{Rel: "alternate", Type: MimeTypeHTML, Href: absURL(listingPath(r.URL.Path))})
+	for _, e := range entries {
+		ae := atomEntry{
+			ID:        e.id,
+			Title:     e.title,
+			Published: e.published.Format(time.RFC3339),
+			Updated:   e.updated.Format(time.RFC3339),
+			Author:    e.author,
+			Links:     []atomLink{{Rel: "alternate", Href: e.link}},
+		}
+		if e.link != e.permaLink {
+			ae.Links = append(ae.Links, atomLink{Rel: "replies", Type: MimeTypeHTML, Href: e.permaLink})
+		}
+		for _, t := range e.tags {
+			ae.Categories = append(ae.Categories, atomCategory{Term: t})
+		}
+		if len(e.content) > 0 {
+			ae.Content = &atomText{Type: "html", Body: e.content}
+		}
+		f.Entries = append(f.Entries, ae)
+	}
+	return f
+}
+
+func (v *view) rssFeed(r *http.Request, m *listingModel) rssFeed {
+	entries := feedEntries(m)
+	f := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         feedTitle(v, m),
+			Link:          absURL(listingPath(r.URL.Path)),
+			Description:   feedTitle(v, m),
+			Generator:     v.c.Name,
+			LastBuildDate: lastUpdated(entries).Format(time.RFC1123Z),
+			Links:         pageLinks(r, m),
+			Items:         make([]rssItem, 0, len(entries)),
+		},
+	}
+	for _, e := range entries {
+		ri := rssItem{
+			Title:       e.title,
+			Link:        e.link,
+			GUID:        rssGUID{IsPermaLink: e.id == e.permaLink, Value: e.id},
+			Creator:     e.author.Name,
+			PubDate:     e.published.Format(time.RFC1123Z),
+			Categories:  e.tags,
+			Description: e.content,
+		}
+		if e.link != e.permaLink {
+			ri.Comments = e.permaLink
+		}
+		f.Channel.Items = append(f.Channel.Items, ri)
+	}
+	return f
+}
+
+func feedTitle(v *view, m *listingModel) string {
+	t := string(m.Title)
+	if len(t) == 0 {
+		return v.c.Name
+	}
+	if len(v.c.Name) > 0 {
+		t = v.c.Name + ": " + t
+	}
+	return t
+}
+
+// RenderFeed outputs the items of the listing model as an RSS 2.0 or Atom feed
+func (v *view) RenderFeed(r *http.Request, w http.ResponseWriter, typ feedType, m *listingModel) error {
+	var doc any
+	switch typ {
+	case feedRSS:
+		doc = v.rssFeed(r, m)
+	case feedAtom:
+		doc = v.atomFeed(r, m)
+	default:
+		return nil
+	}
+
+	wrt := bytes.Buffer{}
+	wrt.WriteString(xml.Header)
+	enc := xml.NewEncoder(&wrt)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		v.errFn(log.Ctx{"err": err, "type": typ})("failed to render feed")
+		return err
+	}
+	w.Header().Set("Content-Type", feedMimeTypes[typ]+"; charset=utf-8")
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+	_, _ = wrt.WriteTo(w)
+	return nil
+}
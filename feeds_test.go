@@ -0,0 +1,123 @@
+package brutalinks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptedMediaType(t *testing.T) {
+	tests := map[string]feedType{
+		"":                                      feedNone,
+		"*/*":                                   feedNone,
+		"text/html":                             feedNone,
+		"application/rss+xml":                   feedRSS,
+		"application/atom+xml":                  feedAtom,
+		"text/html, application/rss+xml;q=0.9":  feedNone,
+		"text/html;q=0.5, application/atom+xml": feedAtom,
+		"application/rss+xml, application/atom+xml":                 feedRSS,
+		"application/rss+xml;q=invalid, application/atom+xml;q=0.1": feedAtom,
+	}
+	for accept, want := range tests {
+		t.Run(accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", accept)
+			if got := feedTypeFromAccept(r); got != want {
+				t.Errorf("feedTypeFromAccept(%q) = %q, want %q", accept, got, want)
+			}
+		})
+	}
+}
+
+func TestFeedMw(t *testing.T) {
+	tests := []struct {
+		path     string
+		accept   string
+		wantPath string
+		wantType feedType
+	}{
+		{path: "/", wantPath: "/", wantType: feedNone},
+		{path: "/index.rss", wantPath: "/", wantType: feedRSS},
+		{path: "/~jdoe.atom", wantPath: "/~jdoe", wantType: feedAtom},
+		{path: "/t/golang.rss", wantPath: "/t/golang", wantType: feedRSS},
+		{path: "/t/golang/top/week.atom", wantPath: "/t/golang/top/week", wantType: feedAtom},
+		{path: "/~jdoe/4f449c81-1dbb-dead-beef-5a83926a0fbf.rss", wantPath: "/~jdoe/4f449c81-1dbb-dead-beef-5a83926a0fbf.rss", wantType: feedNone},
+		{path: "/css/main.atom", wantPath: "/css/main.atom", wantType: feedNone},
+		{path: "/self", accept: MimeTypeAtom, wantPath: "/self", wantType: feedAtom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var gotPath string
+			var gotType feedType
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotType = ContextFeedType(r.Context())
+			})
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			FeedMw(next).ServeHTTP(httptest.NewRecorder(), r)
+			if gotPath != tt.wantPath {
+				t.Errorf("FeedMw() path = %q, want %q", gotPath, tt.wantPath)
+			}
+			if gotType != tt.wantType {
+				t.Errorf("FeedMw() feed type = %q, want %q", gotType, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestFeedLink(t *testing.T) {
+	tests := map[string]string{
+		"/":          "/index.rss",
+		"/~jdoe":     "/~jdoe.rss",
+		"/t/golang/": "/t/golang.rss",
+		"/self.atom": "/self.rss",
+	}
+	for p, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, p, nil)
+		if got := feedLink(r, "rss"); got != want {
+			t.Errorf("feedLink(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestFeedItemTitle(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	tests := []struct {
+		name string
+		it   Item
+		want string
+	}{
+		{name: "title", it: Item{Title: "Some title", Data: "<p>content</p>"}, want: "Some title"},
+		{name: "content", it: Item{Data: "<p>some\n  reply</p>"}, want: "some reply"},
+		{name: "empty", it: Item{}, want: "Untitled"},
+		{name: "long content", it: Item{Data: long}, want: strings.TrimSpace(long)[:feedTitleMaxLen] + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feedItemTitle(&tt.it); got != tt.want {
+				t.Errorf("feedItemTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeedItemContent(t *testing.T) {
+	Instance = new(Application)
+	it := Item{MimeType: MimeTypeHTML, Data: "<p>#go and #golang</p>"}
+	if got := feedItemContent(&it); got != it.Data {
+		t.Errorf("feedItemContent() = %q, want %q", got, it.Data)
+	}
+	if it.Metadata != nil {
+		t.Errorf("feedItemContent() changed the metadata of the item")
+	}
+
+	it.Metadata = &ItemMetadata{Tags: TagCollection{{Name: "#go", URL: "/t/go"}, {Name: "#golang", URL: "/t/golang"}}}
+	_ = feedItemContent(&it)
+	if it.Metadata.Tags[0].Name != "#go" {
+		t.Errorf("feedItemContent() changed the order of the tags of the item")
+	}
+}
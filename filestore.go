@@ -0,0 +1,47 @@
+package brutalinks
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// storageDir returns the folder of the storage at path, where we keep the JSON files of the application
+func storageDir(path string) string {
+	if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+		return filepath.Dir(path)
+	}
+	return path
+}
+
+// loadJSONFile decodes the file at path into v, a file that doesn't exist leaves v unchanged
+func loadJSONFile(path string, v any) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// saveJSONFile encodes v in the file at path.
+// It writes a temporary file first, so a failed write doesn't lose the previous content.
+func saveJSONFile(path string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,37 @@
+package brutalinks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONFile(t *testing.T) {
+	dir := t.TempDir()
+	storage := filepath.Join(dir, "storage.bdb")
+	if err := os.WriteFile(storage, nil, 0600); err != nil {
+		t.Fatalf("unable to create storage file: %s", err)
+	}
+	if got := storageDir(storage); got != dir {
+		t.Errorf("storageDir() = %s, want the folder of the storage file %s", got, dir)
+	}
+	if got := storageDir(dir); got != dir {
+		t.Errorf("storageDir() = %s, want %s", got, dir)
+	}
+
+	path := filepath.Join(dir, "test", "values.json")
+	values := []string{"default"}
+	if err := loadJSONFile(path, &values); err != nil || len(values) != 1 || values[0] != "default" {
+		t.Errorf("loadJSONFile() must leave the values unchanged when the file doesn't exist, got %v, %v", values, err)
+	}
+	if err := saveJSONFile(path, []string{"one", "two"}); err != nil {
+		t.Fatalf("unable to save file: %s", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("saveJSONFile() left the temporary file behind")
+	}
+	values = nil
+	if err := loadJSONFile(path, &values); err != nil || len(values) != 2 || values[1] != "two" {
+		t.Errorf("loadJSONFile() = %v, %v, want the saved values", values, err)
+	}
+}
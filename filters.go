@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	vocab "github.com/go-ap/activitypub"
 	"github.com/go-ap/errors"
@@ -21,6 +22,11 @@ func AuthorChecks(next http.Handler) http.Handler {
 		auth := ContextAuthors(r.Context())
 		checks := defaultChecks(r)
 		for _, a := range auth {
+			if a.IsGroup() {
+				// a group doesn't author its threads, they are addressed to it
+				checks = append(checks, filters.Recipients(a.AP().GetLink()))
+				continue
+			}
 			checks = append(checks, filters.SameAttributedTo(a.AP().GetLink()))
 		}
 		ctx := context.WithValue(r.Context(), FilterCtxtKey, filters.All(checks...))
@@ -38,6 +44,14 @@ func DefaultChecks(next http.Handler) http.Handler {
 	})
 }
 
+// TopLevelChecks loads the top level public items, without setting a listing title
+func TopLevelChecks(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), FilterCtxtKey, filters.All(topLevelChecks(r)...))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // ContextActivityChecks loads the filters we use for generating storage queries from the HTTP request
 func ContextActivityChecks(ctx context.Context) filters.Check {
 	if f, ok := ctx.Value(FilterCtxtKey).(filters.Check); ok {
@@ -112,6 +126,20 @@ func (c cursorRef) String() string {
 
 var _ filters.Check = cursorRef(0)
 
+// publishedAfter matches the objects and activities published after the time it holds
+type publishedAfter time.Time
+
+func (p publishedAfter) Match(it vocab.Item) bool {
+	published := time.Time{}
+	_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+		published = ob.Published
+		return nil
+	})
+	return published.After(time.Time(p))
+}
+
+var _ filters.Check = publishedAfter{}
+
 func RefValue(r uint64) cursorRef {
 	return cursorRef(r)
 }
@@ -144,6 +172,9 @@ func FromURL(u url.URL) filters.Checks {
 }
 
 func requestChecks(r *http.Request) filters.Checks {
+	if d := ContextDependentLoads(r.Context()); d != nil && d.Window {
+		return windowChecks(r.URL.Query(), d.Since)
+	}
 	return append(FromURL(*r.URL), filters.WithMaxCount(MaxContentItems))
 }
 
@@ -216,6 +247,58 @@ func TagChecks(next http.Handler) http.Handler {
 	})
 }
 
+// topWindowSize is the number of items we load, and rank, for the top listings
+const topWindowSize = 10 * MaxContentItems
+
+var topWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+// TopWindowMw sets up the loading of all the items published in the time window from the "window" URL parameter,
+// so LoadTopMw can rank them together. It needs to run before the middlewares building the storage checks.
+func TopWindowMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dur, ok := topWindows[topWindow(r)]
+		if !ok {
+			ctxtErr(next, w, r, errors.NotFoundf("invalid time window %q", topWindow(r)))
+			return
+		}
+		d, needsSave := depsSetterFunc(r, func(d *deps) {
+			d.Window = true
+			if dur > 0 {
+				d.Since = time.Now().UTC().Add(-dur)
+			}
+		})
+		if needsSave {
+			r = r.WithContext(context.WithValue(r.Context(), DependenciesCtxtKey, d))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func topWindow(r *http.Request) string {
+	if window := chi.URLParam(r, "window"); window != "" {
+		return window
+	}
+	return "day"
+}
+
+// windowChecks returns the checks for loading the items of a top listing, which need to be ranked
+// all together before being paged, so they ignore the pagination cursors.
+func windowChecks(q url.Values, since time.Time) filters.Checks {
+	q.Del(keyAfter)
+	q.Del(keyBefore)
+	checks := append(filters.FromValues(q), filters.WithMaxCount(topWindowSize))
+	if !since.IsZero() {
+		checks = append(checks, publishedAfter(since))
+	}
+	return checks
+}
+
 func ItemChecks(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		hash := chi.URLParam(r, "hash")
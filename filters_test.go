@@ -0,0 +1,79 @@
+package brutalinks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPublishedAfter(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name string
+		it   vocab.Item
+		want bool
+	}{
+		{name: "object after", it: &vocab.Object{ID: "https://brutalinks.git/objects/1", Published: now.Add(time.Minute)}, want: true},
+		{name: "object before", it: &vocab.Object{ID: "https://brutalinks.git/objects/2", Published: now.Add(-time.Minute)}},
+		{name: "object at", it: &vocab.Object{ID: "https://brutalinks.git/objects/3", Published: now}},
+		{name: "activity after", it: &vocab.Activity{ID: "https://brutalinks.git/activities/1", Type: vocab.CreateType, Published: now.Add(time.Minute)}, want: true},
+		{name: "no date", it: &vocab.Object{ID: "https://brutalinks.git/objects/4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := publishedAfter(now).Match(tt.it); got != tt.want {
+				t.Errorf("publishedAfter.Match() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopWindowMw(t *testing.T) {
+	tests := []struct {
+		window     string
+		wantWindow bool
+		wantSince  time.Duration
+	}{
+		{window: "", wantWindow: true, wantSince: 24 * time.Hour},
+		{window: "week", wantWindow: true, wantSince: 7 * 24 * time.Hour},
+		{window: "all", wantWindow: true},
+		{window: "century"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			var got *deps
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ContextDependentLoads(r.Context())
+			})
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("window", tt.window)
+			r := httptest.NewRequest(http.MethodGet, "/top/"+tt.window, nil)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			TopWindowMw(next).ServeHTTP(httptest.NewRecorder(), r)
+			if !tt.wantWindow {
+				if got != nil && got.Window {
+					t.Errorf("TopWindowMw() set up the loading of an invalid window")
+				}
+				return
+			}
+			if got == nil || !got.Window {
+				t.Fatalf("TopWindowMw() did not set up the window loading: %+v", got)
+			}
+			if tt.wantSince == 0 {
+				if !got.Since.IsZero() {
+					t.Errorf("TopWindowMw() since = %s, want none", got.Since)
+				}
+				return
+			}
+			if since := time.Since(got.Since); since < tt.wantSince || since > tt.wantSince+time.Minute {
+				t.Errorf("TopWindowMw() since %s ago, want %s", since, tt.wantSince)
+			}
+		})
+	}
+}
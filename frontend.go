@@ -27,10 +27,14 @@ type handler struct {
 	conf    appConfig
 	v       *view
 	storage *repository
+	stats   *NodeInfoResolver
+	preview *previewFetcher
+	limits  *rateLimiter
 	logger  log.Logger
 }
 
 func (h *handler) Close() error {
+	h.stats.Stop()
 	return h.storage.Close()
 }
 
@@ -66,6 +70,8 @@ func (h *handler) init(c appConfig) error {
 	}
 
 	h.conf = c
+	h.preview = previewFetcherNew(fmt.Sprintf("%s (+https://github.com/mariusor/brutalinks@%s)", c.HostName, c.Version))
+	h.limits = rateLimiterNew(PreviewRateLimit, PreviewRateInterval)
 
 	if err = ConnectFedBOX(h, h.conf); err != nil {
 		h.conf.MaintenanceMode = true
@@ -337,6 +343,11 @@ func (h *handler) HandleAbout(w http.ResponseWriter, r *http.Request) {
 		h.logger.WithContext(log.Ctx{"err": err}).Errorf("unable to load service actor for FedBOX")
 	}
 	m.Desc.Description = info.Description
+	m.Desc.Title = h.conf.Name
+	m.Desc.Email = h.conf.AdminContact
+	m.Desc.URI = h.conf.BaseURL
+	m.Desc.Version = h.conf.Version
+	m.Desc.Stats = h.stats.Stats()
 
 	_ = h.v.RenderTemplate(r, w, m.Template(), m)
 }
@@ -0,0 +1,730 @@
+package brutalinks
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	"github.com/go-chi/chi/v5"
+)
+
+var validGroupName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,31}$`)
+
+// GroupInboxCheckInterval is how often we look in the inboxes of the groups for the activities of remote actors
+const GroupInboxCheckInterval = time.Minute
+
+// Group is a community, with its own listing, rules and moderators.
+// It is represented by a Group actor, which announces the submissions addressed to it to its followers.
+type Group struct {
+	Account    *Account
+	Rules      string
+	Moderators AccountPtrCollection
+	// Banned are the accounts whose items the group doesn't show or announce
+	Banned AccountPtrCollection
+	// Removed are the items which don't show in the group listing anymore
+	Removed   vocab.IRIs
+	CreatedAt time.Time
+}
+
+// Name returns the name of the group, which is also the handle of its actor
+func (g Group) Name() string {
+	if g.Account == nil {
+		return ""
+	}
+	return g.Account.Handle
+}
+
+// ModeratedBy returns true if the a account can change the description, the rules and the moderators of the group
+func (g Group) ModeratedBy(a *Account) bool {
+	if !a.IsLogged() {
+		return false
+	}
+	if a.IsOperator() {
+		return true
+	}
+	for _, m := range g.Moderators {
+		if m.Hash == a.Hash {
+			return true
+		}
+	}
+	return false
+}
+
+// groupInfo is what we keep about a group, besides its actor
+type groupInfo struct {
+	Name string `json:"name"`
+	IRI  string `json:"iri"`
+	// Rules are shown on the group page, in markdown
+	Rules string `json:"rules,omitempty"`
+	// Moderators are the IRIs of the accounts moderating the group
+	Moderators []string `json:"moderators"`
+	// Banned are the IRIs of the accounts the moderators banned from the group
+	Banned []string `json:"banned,omitempty"`
+	// Removed are the IRIs of the items the moderators removed from the group
+	Removed   []string  `json:"removed,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// InboxHandled are the IRIs of the activities from the inbox of the group actor that the group announced or accepted
+	InboxHandled []string `json:"inboxHandled,omitempty"`
+}
+
+// bans returns true if the moderators banned the actor with iri from the group
+func (g groupInfo) bans(iri vocab.IRI) bool {
+	return iri != "" && stringInSlice(g.Banned)(iri.String())
+}
+
+// removes returns true if the moderators removed the item with iri from the group
+func (g groupInfo) removes(iri vocab.IRI) bool {
+	return iri != "" && stringInSlice(g.Removed)(iri.String())
+}
+
+// handled returns true if the group already announced or accepted the activity with iri from its inbox
+func (g groupInfo) handled(iri vocab.IRI) bool {
+	return iri != "" && stringInSlice(g.InboxHandled)(iri.String())
+}
+
+// groupStore keeps the groups of the instance in a JSON file
+type groupStore struct {
+	m      sync.RWMutex
+	path   string
+	groups []groupInfo
+}
+
+// groupStoreNew returns a store saving the groups in a "groups.json" file next to the storage at path
+func groupStoreNew(path string) *groupStore {
+	s := &groupStore{path: filepath.Join(storageDir(path), "groups.json")}
+	_ = loadJSONFile(s.path, &s.groups)
+	return s
+}
+
+// save needs to be called with the lock held
+func (s *groupStore) save() error {
+	return saveJSONFile(s.path, s.groups)
+}
+
+// List returns all the groups of the instance
+func (s *groupStore) List() []groupInfo {
+	if s == nil {
+		return nil
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return append([]groupInfo(nil), s.groups...)
+}
+
+// Get returns the group with name
+func (s *groupStore) Get(name string) (groupInfo, bool) {
+	for _, g := range s.List() {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return groupInfo{}, false
+}
+
+// ByIRI returns the group with the iri actor
+func (s *groupStore) ByIRI(iri vocab.IRI) (groupInfo, bool) {
+	for _, g := range s.List() {
+		if iri.Equals(vocab.IRI(g.IRI), false) {
+			return g, true
+		}
+	}
+	return groupInfo{}, false
+}
+
+// Save adds the g group, or replaces the existing one with the same name
+func (s *groupStore) Save(g groupInfo) error {
+	if s == nil {
+		return errors.NotImplementedf("groups are not available")
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for i, ex := range s.groups {
+		if ex.Name == g.Name {
+			s.groups[i] = g
+			return s.save()
+		}
+	}
+	s.groups = append(s.groups, g)
+	return s.save()
+}
+
+// update changes the group with name using fn, while holding the lock,
+// so concurrent changes of the same group don't overwrite each other
+func (s *groupStore) update(name string, fn func(*groupInfo)) error {
+	if s == nil {
+		return errors.NotImplementedf("groups are not available")
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for i := range s.groups {
+		if s.groups[i].Name == name {
+			fn(&s.groups[i])
+			return s.save()
+		}
+	}
+	return errors.NotFoundf("group %s not found", name)
+}
+
+// groupModeratorIRIs loads the local accounts with the handles, and returns their IRIs
+func (r *repository) groupModeratorIRIs(ctx context.Context, handles []string) ([]string, error) {
+	iris := make([]string, 0, len(handles))
+	for _, handle := range handles {
+		acc, err := r.account(ctx, AccountByHandleCheck(handle))
+		if err != nil || !acc.IsLocal() {
+			return nil, errors.NotFoundf("unable to find moderator %s", handle)
+		}
+		if iri := accountIRI(acc).String(); !stringInSlice(iris)(iri) {
+			iris = append(iris, iri)
+		}
+	}
+	return iris, nil
+}
+
+// CreateGroup creates a new group actor, moderated by the by account and the accounts with the moderators handles.
+// Only the operators and the moderators of the instance can create groups.
+func (r *repository) CreateGroup(ctx context.Context, by *Account, name, description, rules string, moderators []string) (Group, error) {
+	if !by.IsModerator() {
+		return Group{}, errors.Forbiddenf("only moderators can create groups")
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !validGroupName.MatchString(name) {
+		return Group{}, errors.BadRequestf("the group name needs to have between 2 and 32 letters, digits, dashes or underscores")
+	}
+	if _, ok := r.groups.Get(name); ok {
+		return Group{}, errors.Conflictf("group %s already exists", name)
+	}
+	if ex, _ := r.accounts(ctx, AccountByHandleCheck(name)); len(ex) > 0 {
+		return Group{}, errors.Conflictf("an account named %s already exists", name)
+	}
+	mods, err := r.groupModeratorIRIs(ctx, append([]string{by.Handle}, moderators...))
+	if err != nil {
+		return Group{}, err
+	}
+
+	a := Account{
+		Handle:    name,
+		Flags:     FlagsGroup,
+		CreatedBy: r.app,
+		Pub:       &vocab.Actor{Type: vocab.GroupType},
+		Metadata:  &AccountMetadata{Blurb: description},
+	}
+	if a, err = r.SaveAccount(ctx, a); err != nil {
+		return Group{}, err
+	}
+	info := groupInfo{
+		Name:       name,
+		IRI:        accountIRI(&a).String(),
+		Rules:      rules,
+		Moderators: mods,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err = r.groups.Save(info); err != nil {
+		return Group{}, err
+	}
+	return r.loadGroup(ctx, name)
+}
+
+// groupBannedIRIs loads the accounts with the handles, and returns their IRIs
+func (r *repository) groupBannedIRIs(ctx context.Context, handles []string) ([]string, error) {
+	iris := make([]string, 0, len(handles))
+	for _, handle := range handles {
+		acc, err := r.account(ctx, AccountByHandleCheck(handle))
+		if err != nil || !acc.IsValid() {
+			return nil, errors.NotFoundf("unable to find account %s", handle)
+		}
+		if iri := accountIRI(acc).String(); !stringInSlice(iris)(iri) {
+			iris = append(iris, iri)
+		}
+	}
+	return iris, nil
+}
+
+// UpdateGroup changes the description, the rules, the moderators and the banned accounts of the g group
+func (r *repository) UpdateGroup(ctx context.Context, g Group, description, rules string, moderators, banned []string) (Group, error) {
+	if _, ok := r.groups.Get(g.Name()); !ok {
+		return g, errors.NotFoundf("group %s not found", g.Name())
+	}
+	mods, err := r.groupModeratorIRIs(ctx, moderators)
+	if err != nil {
+		return g, err
+	}
+	if len(mods) == 0 {
+		return g, errors.BadRequestf("a group needs at least one moderator")
+	}
+	bans, err := r.groupBannedIRIs(ctx, banned)
+	if err != nil {
+		return g, err
+	}
+	for _, b := range bans {
+		if stringInSlice(mods)(b) {
+			return g, errors.BadRequestf("a moderator can't be banned from the group")
+		}
+	}
+	if description != g.Account.Metadata.Blurb {
+		a := *g.Account
+		a.Metadata.Blurb = description
+		a.CreatedBy = r.app
+		if p, ok := a.Pub.(*vocab.Actor); ok {
+			// the summary is loaded from the blurb only when it's empty
+			p.Summary = nil
+		}
+		if _, err = r.SaveAccount(ctx, a); err != nil {
+			return g, err
+		}
+	}
+	err = r.groups.update(g.Name(), func(info *groupInfo) {
+		info.Rules = rules
+		info.Moderators = mods
+		info.Banned = bans
+	})
+	if err != nil {
+		return g, err
+	}
+	return r.loadGroup(ctx, g.Name())
+}
+
+// loadGroup returns the group with name, with its actor and its moderators
+func (r *repository) loadGroup(ctx context.Context, name string) (Group, error) {
+	info, ok := r.groups.Get(name)
+	if !ok {
+		return Group{}, errors.NotFoundf("group %s not found", name)
+	}
+	acc, err := r.LoadAccount(ctx, vocab.IRI(info.IRI))
+	if err != nil {
+		return Group{}, err
+	}
+	g := Group{Account: acc, Rules: info.Rules, CreatedAt: info.CreatedAt}
+	for _, rm := range info.Removed {
+		g.Removed = append(g.Removed, vocab.IRI(rm))
+	}
+
+	iris := make(vocab.IRIs, 0, len(info.Moderators)+len(info.Banned))
+	for _, m := range append(info.Moderators, info.Banned...) {
+		iris = append(iris, vocab.IRI(m))
+	}
+	accounts, err := r.loadAccountsByIRI(iris)
+	if err != nil {
+		return g, err
+	}
+	for i, iri := range iris {
+		acc, ok := accounts[iri]
+		if !ok {
+			continue
+		}
+		if i < len(info.Moderators) {
+			g.Moderators = append(g.Moderators, &acc)
+		} else {
+			g.Banned = append(g.Banned, &acc)
+		}
+	}
+	return g, nil
+}
+
+// RemoveFromGroup hides the it item from the g group, together with the replies to it
+func (r *repository) RemoveFromGroup(g Group, it Item) error {
+	if vocab.IsNil(it.Pub) {
+		return errors.NotValidf("invalid item")
+	}
+	iri := it.Pub.GetLink()
+	return r.groups.update(g.Name(), func(info *groupInfo) {
+		if !info.removes(iri) {
+			info.Removed = append(info.Removed, iri.String())
+		}
+	})
+}
+
+// itemGroups returns the local groups the it item, or the items it replies to, are addressed to.
+// It leaves out the groups which banned the author of the item, or removed the items it replies to.
+func (r *repository) itemGroups(it Item) []groupInfo {
+	thread := []*Item{&it}
+	for _, p := range []Renderable{it.Parent, it.OP} {
+		if pi, ok := p.(*Item); ok && pi != nil {
+			thread = append(thread, pi)
+		}
+	}
+	accepts := func(g groupInfo) bool {
+		if it.SubmittedBy != nil && g.bans(accountIRI(it.SubmittedBy)) {
+			return false
+		}
+		for _, i := range thread[1:] {
+			if !vocab.IsNil(i.Pub) && g.removes(i.Pub.GetLink()) {
+				return false
+			}
+		}
+		return true
+	}
+
+	groups := make([]groupInfo, 0)
+	for _, i := range thread {
+		if !i.HasMetadata() {
+			continue
+		}
+		for _, rec := range i.Metadata.To {
+			g, ok := r.groups.ByIRI(accountIRI(&rec))
+			if !ok || !accepts(g) {
+				continue
+			}
+			found := false
+			for _, ex := range groups {
+				found = found || ex.Name == g.Name
+			}
+			if !found {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return groups
+}
+
+// announceInGroups makes the groups announce the act activity to their followers, as described by FEP-1b12
+func (r *repository) announceInGroups(ctx context.Context, groups []groupInfo, act vocab.IRI) {
+	for _, g := range groups {
+		if err := r.announceInGroup(ctx, g, act); err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "group": g.Name, "activity": act})("unable to announce activity to group")
+		}
+	}
+}
+
+// announceInGroup makes the g group announce the act activity to its followers
+func (r *repository) announceInGroup(ctx context.Context, g groupInfo, act vocab.IRI) error {
+	group := vocab.IRI(g.IRI)
+	announce := &vocab.Activity{
+		Type:   vocab.AnnounceType,
+		Actor:  group,
+		Object: act,
+		To:     vocab.ItemCollection{vocab.PublicNS},
+		CC:     vocab.ItemCollection{vocab.Followers.IRI(group)},
+	}
+	// the group actors are created by the application, so we operate on them as the application
+	i, it, err := r.ToOutbox(ctx, r.app.Credentials(), announce)
+	if err != nil {
+		return err
+	}
+	r.cache.removeRelated(i, it, announce)
+	return nil
+}
+
+// acceptGroupFollow makes the group actor accept the follow activity of the er actor
+func (r *repository) acceptGroupFollow(ctx context.Context, g groupInfo, er vocab.IRI, follow vocab.IRI) error {
+	if g.bans(er) {
+		return errors.Forbiddenf("%s is banned from group %s", er, g.Name)
+	}
+	accept := &vocab.Activity{
+		Type:   vocab.AcceptType,
+		Actor:  vocab.IRI(g.IRI),
+		Object: follow,
+		To:     vocab.ItemCollection{er},
+	}
+	i, it, err := r.ToOutbox(ctx, r.app.Credentials(), accept)
+	if err != nil && !errors.IsConflict(err) {
+		return err
+	}
+	r.cache.removeRelated(i, it, accept)
+	return nil
+}
+
+// groupInboxActivities returns the activities of remote actors from the inbox of the g group, that it didn't handle yet:
+// the creates of the public objects addressed to the group, which it announces, and the follows of the group, which
+// it accepts.
+func groupInboxActivities(g groupInfo, inbox vocab.ItemCollection) ([]*vocab.Activity, []*vocab.Activity) {
+	group := vocab.IRI(g.IRI)
+	creates := make([]*vocab.Activity, 0)
+	follows := make([]*vocab.Activity, 0)
+	for _, it := range inbox {
+		if vocab.IsNil(it) {
+			continue
+		}
+		_ = vocab.OnActivity(it, func(act *vocab.Activity) error {
+			if act.Actor == nil || vocab.IsNil(act.Object) || g.handled(act.GetLink()) {
+				return nil
+			}
+			actor := act.Actor.GetLink()
+			if HostIsLocal(actor.String()) || g.bans(actor) {
+				return nil
+			}
+			switch act.Type {
+			case vocab.FollowType:
+				if act.Object.GetLink().Equals(group, false) {
+					follows = append(follows, act)
+				}
+			case vocab.CreateType:
+				_ = vocab.OnObject(act.Object, func(ob *vocab.Object) error {
+					rec := make(vocab.ItemCollection, 0, len(ob.To)+len(ob.CC)+len(ob.Audience))
+					rec = append(append(append(rec, ob.To...), ob.CC...), ob.Audience...)
+					if !rec.Contains(vocab.PublicNS) || !rec.Contains(group) || g.removes(ob.GetLink()) {
+						return nil
+					}
+					if ob.InReplyTo != nil && g.removes(ob.InReplyTo.GetLink()) {
+						return nil
+					}
+					creates = append(creates, act)
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+	return creates, follows
+}
+
+// groupRelay periodically handles what remote actors send to the inboxes of the groups
+type groupRelay struct {
+	r       *repository
+	stop    chan struct{}
+	stopped sync.Once
+}
+
+// groupRelayNew starts checking the inboxes of the groups every interval.
+// If the interval is not greater than zero, it returns nil.
+func groupRelayNew(r *repository, interval time.Duration) *groupRelay {
+	if r == nil || interval <= 0 {
+		return nil
+	}
+	gr := &groupRelay{r: r, stop: make(chan struct{})}
+	go gr.run(interval)
+	return gr
+}
+
+func (gr *groupRelay) run(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			gr.relay(context.Background())
+		case <-gr.stop:
+			return
+		}
+	}
+}
+
+// Stop ends the background checks of the group inboxes
+func (gr *groupRelay) Stop() {
+	if gr == nil {
+		return
+	}
+	gr.stopped.Do(func() { close(gr.stop) })
+}
+
+// relay handles the new activities from the inboxes of all the groups
+func (gr *groupRelay) relay(ctx context.Context) {
+	r := gr.r
+	for _, g := range r.groups.List() {
+		res, err := r.b.SearchInCollection(vocab.Inbox.IRI(vocab.IRI(g.IRI)))
+		if err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "group": g.Name})("unable to load group inbox")
+			continue
+		}
+		inbox := make(vocab.ItemCollection, 0, len(res))
+		for _, li := range res {
+			if it, ok := li.(vocab.Item); ok {
+				inbox = append(inbox, it)
+			}
+		}
+		creates, follows := groupInboxActivities(g, inbox)
+		// the activities that fail are not marked as handled, so the next check tries them again
+		handled := make([]string, 0, len(creates)+len(follows))
+		for _, follow := range follows {
+			if err = r.acceptGroupFollow(ctx, g, follow.Actor.GetLink(), follow.GetLink()); err != nil {
+				r.errFn(log.Ctx{"err": err.Error(), "follower": follow.Actor.GetLink(), "group": g.Name})("unable to accept group follow")
+				continue
+			}
+			handled = append(handled, follow.GetLink().String())
+		}
+		for _, create := range creates {
+			if err = r.announceInGroup(ctx, g, create.GetLink()); err != nil {
+				r.errFn(log.Ctx{"err": err.Error(), "group": g.Name, "activity": create.GetLink()})("unable to announce activity to group")
+				continue
+			}
+			handled = append(handled, create.GetLink().String())
+		}
+		if len(handled) == 0 {
+			continue
+		}
+		err = r.groups.update(g.Name, func(info *groupInfo) {
+			info.InboxHandled = append(info.InboxHandled, handled...)
+		})
+		if err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "group": g.Name})("unable to save group inbox state")
+		}
+	}
+}
+
+// LoadGroupMw loads the group with the name from the URL
+func (h *handler) LoadGroupMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g, err := h.storage.loadGroup(r.Context(), chi.URLParam(r, "name"))
+		if err != nil {
+			h.ErrorHandler(err).ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), GroupCtxtKey, &g)))
+	})
+}
+
+// GroupChecks loads the top level items addressed to the group
+func GroupChecks(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := ContextGroup(r.Context())
+		if g == nil {
+			ctxtErr(next, w, r, errors.NotFoundf("group not found"))
+			return
+		}
+		m := ContextListingModel(r.Context())
+		m.tpl = "group"
+		m.Group = g
+		m.ShowText = true
+		m.Title = htmlf("g/%s", g.Name())
+
+		checks := append(topLevelChecks(r), filters.Recipients(g.Account.AP().GetLink()))
+		for _, iri := range g.Removed {
+			checks = append(checks, filters.Not(filters.SameIRI(iri)))
+		}
+		for _, b := range g.Banned {
+			checks = append(checks, filters.Not(filters.SameAttributedTo(b.AP().GetLink())))
+		}
+		ctx := context.WithValue(r.Context(), FilterCtxtKey, filters.All(checks...))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type groupsModel struct {
+	Title  template.HTML
+	Groups []Group
+}
+
+func (m *groupsModel) SetTitle(s string) {
+	m.Title = template.HTML(s)
+}
+
+func (groupsModel) Template() string {
+	return "groups"
+}
+
+func (*groupsModel) SetCursor(c *Cursor) {}
+
+// GroupsModelMw loads all the groups of the instance
+func GroupsModelMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo := ContextRepository(r.Context())
+		m := &groupsModel{Title: "Groups"}
+		for _, info := range repo.groups.List() {
+			g, err := repo.loadGroup(r.Context(), info.Name)
+			if err != nil {
+				repo.errFn(log.Ctx{"err": err.Error(), "group": info.Name})("unable to load group")
+				continue
+			}
+			m.Groups = append(m.Groups, g)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ModelCtxtKey, m)))
+	})
+}
+
+// groupFromRequest returns the description, the rules, the moderator handles and the banned handles from the group form
+func groupFromRequest(r *http.Request) (string, string, []string, []string) {
+	return strings.TrimSpace(r.PostFormValue("description")), strings.TrimSpace(r.PostFormValue("rules")),
+		recipientHandles(r.PostFormValue("moderators")), recipientHandles(r.PostFormValue("banned"))
+}
+
+// HandleGroupCreate serves the POST /g requests
+func (h *handler) HandleGroupCreate(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	description, rules, moderators, _ := groupFromRequest(r)
+	g, err := h.storage.CreateGroup(r.Context(), acc, r.PostFormValue("name"), description, rules, moderators)
+	if err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to create group")
+		h.v.addFlashMessage(Error, w, r, err.Error())
+		h.v.Redirect(w, r, "/g", http.StatusSeeOther)
+		return
+	}
+	h.v.Redirect(w, r, GroupLink(g), http.StatusSeeOther)
+}
+
+// HandleGroupUpdate serves the POST /g/{name} requests
+func (h *handler) HandleGroupUpdate(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	g := ContextGroup(r.Context())
+	if g == nil || !g.ModeratedBy(acc) {
+		h.v.HandleErrors(w, r, errors.Forbiddenf("only the moderators can change the group"))
+		return
+	}
+	description, rules, moderators, banned := groupFromRequest(r)
+	if _, err := h.storage.UpdateGroup(r.Context(), *g, description, rules, moderators, banned); err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "group": g.Name()})("unable to update group")
+		h.v.addFlashMessage(Error, w, r, err.Error())
+	} else {
+		h.v.addFlashMessage(Success, w, r, "The group has been updated.")
+	}
+	h.v.Redirect(w, r, GroupLink(*g), http.StatusSeeOther)
+}
+
+// HandleGroupRemove serves the POST /~{handle}/{hash}/g/{name}/rm requests, which remove the item from the group
+func (h *handler) HandleGroupRemove(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	g := ContextGroup(r.Context())
+	if g == nil || !g.ModeratedBy(acc) {
+		h.v.HandleErrors(w, r, errors.Forbiddenf("only the moderators can remove items from the group"))
+		return
+	}
+	it := ContextItem(r.Context())
+	if it == nil {
+		h.v.HandleErrors(w, r, errors.NotFoundf("item not found"))
+		return
+	}
+	if err := h.storage.RemoveFromGroup(*g, *it); err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "group": g.Name(), "item": it.Hash})("unable to remove item from group")
+		h.v.addFlashMessage(Error, w, r, "Unable to remove the item from the group.")
+	} else {
+		h.v.addFlashMessage(Success, w, r, fmt.Sprintf("The item has been removed from g/%s.", g.Name()))
+	}
+	h.v.Redirect(w, r, GroupLink(*g), http.StatusSeeOther)
+}
+
+// moderatedGroups returns a function which returns the groups the it item is in, that the by account moderates
+func moderatedGroups(repo *repository, by *Account) func(*Item) []string {
+	var (
+		once      sync.Once
+		moderated []groupInfo
+	)
+	return func(it *Item) []string {
+		if repo == nil || !by.IsLogged() || it == nil || vocab.IsNil(it.Pub) || !it.HasMetadata() {
+			return nil
+		}
+		once.Do(func() {
+			byIRI := accountIRI(by).String()
+			for _, g := range repo.groups.List() {
+				if by.IsOperator() || stringInSlice(g.Moderators)(byIRI) {
+					moderated = append(moderated, g)
+				}
+			}
+		})
+		names := make([]string, 0)
+		for _, g := range moderated {
+			if g.removes(it.Pub.GetLink()) {
+				continue
+			}
+			for _, rec := range it.Metadata.To {
+				if accountIRI(&rec).Equals(vocab.IRI(g.IRI), false) {
+					names = append(names, g.Name)
+					break
+				}
+			}
+		}
+		return names
+	}
+}
+
+// GroupLink returns the local URL of the g group listing
+func GroupLink(g Group) string {
+	return "/g/" + g.Name()
+}
@@ -0,0 +1,149 @@
+package brutalinks
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/brutalinks/internal/config"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+func TestValidGroupName(t *testing.T) {
+	tests := map[string]bool{
+		"golang":                            true,
+		"go-lang_101":                       true,
+		"g":                                 false,
+		"-golang":                           false,
+		"GoLang":                            false,
+		"go lang":                           false,
+		"":                                  false,
+		"abcdefghijklmnopqrstuvwxyz0123456": false,
+	}
+	for name, want := range tests {
+		if got := validGroupName.MatchString(name); got != want {
+			t.Errorf("validGroupName(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
+
+func TestGroupStore(t *testing.T) {
+	path := t.TempDir()
+	s := groupStoreNew(path)
+	g := groupInfo{Name: "golang", IRI: "https://example.com/actors/golang", Moderators: []string{"https://example.com/actors/jdoe"}}
+	if err := s.Save(g); err != nil {
+		t.Fatalf("unable to save group: %s", err)
+	}
+	g.Rules = "Be nice."
+	g.Banned = []string{"https://example.com/actors/spammer"}
+	if err := s.Save(g); err != nil {
+		t.Fatalf("unable to update group: %s", err)
+	}
+
+	// a new store loads the groups saved by the previous one
+	s = groupStoreNew(path)
+	if l := s.List(); len(l) != 1 {
+		t.Fatalf("expected one group, got %d", len(l))
+	}
+	if got, ok := s.Get("golang"); !ok || got.Rules != g.Rules || !got.bans("https://example.com/actors/spammer") {
+		t.Errorf("unable to load the updated group, got %v", got)
+	}
+	if _, ok := s.ByIRI(vocab.IRI("https://example.com/actors/golang")); !ok {
+		t.Errorf("unable to load the group by its IRI")
+	}
+	if _, ok := s.Get("rust"); ok {
+		t.Errorf("loaded a group that doesn't exist")
+	}
+
+	var wg sync.WaitGroup
+	for _, iri := range []string{"https://example.com/objects/1", "https://example.com/objects/2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = s.update("golang", func(g *groupInfo) { g.Removed = append(g.Removed, iri) })
+		}()
+	}
+	wg.Wait()
+	if got, _ := s.Get("golang"); len(got.Removed) != 2 {
+		t.Errorf("update() lost one of the concurrent changes, removed = %v", got.Removed)
+	}
+	if err := s.update("rust", func(*groupInfo) {}); !errors.IsNotFound(err) {
+		t.Errorf("update() error = %v for a group that doesn't exist, want not found", err)
+	}
+}
+
+func TestGroupInfoModeration(t *testing.T) {
+	g := groupInfo{
+		Name:    "golang",
+		Banned:  []string{"https://example.com/actors/spammer"},
+		Removed: []string{"https://example.com/objects/spam"},
+	}
+	if !g.bans("https://example.com/actors/spammer") || g.bans("https://example.com/actors/jdoe") || g.bans("") {
+		t.Errorf("bans() doesn't match the banned accounts")
+	}
+	if !g.removes("https://example.com/objects/spam") || g.removes("https://example.com/objects/ham") || g.removes("") {
+		t.Errorf("removes() doesn't match the removed items")
+	}
+}
+
+func TestGroupInboxActivities(t *testing.T) {
+	Instance = new(Application)
+	Instance.BaseURL = url.URL{Scheme: "https", Host: "brutalinks.git"}
+	Instance.Conf = &config.Configuration{HostName: "brutalinks.git", APIURL: "https://fedbox.git"}
+
+	group := vocab.IRI("https://fedbox.git/actors/golang")
+	local := vocab.IRI("https://fedbox.git/actors/jdoe")
+	remote := vocab.IRI("https://remote.example/users/alice")
+	banned := vocab.IRI("https://remote.example/users/spammer")
+	g := groupInfo{
+		Name:         "golang",
+		IRI:          group.String(),
+		Banned:       []string{banned.String()},
+		Removed:      []string{"https://remote.example/objects/removed"},
+		InboxHandled: []string{"https://remote.example/activities/handled"},
+	}
+
+	now := time.Now().UTC()
+	create := func(id string, actor vocab.IRI, ob *vocab.Object) *vocab.Activity {
+		return &vocab.Activity{ID: vocab.IRI(id), Type: vocab.CreateType, Actor: actor, Object: ob, Published: now}
+	}
+	note := func(id string, rec ...vocab.Item) *vocab.Object {
+		return &vocab.Object{ID: vocab.IRI(id), Type: vocab.NoteType, To: rec}
+	}
+	follow := func(id string, actor, object vocab.IRI) *vocab.Activity {
+		return &vocab.Activity{ID: vocab.IRI(id), Type: vocab.FollowType, Actor: actor, Object: object, Published: now}
+	}
+	// delivered late, with a date older than the activities handled before it
+	late := create("https://remote.example/activities/late", remote, note("https://remote.example/objects/late", vocab.PublicNS, group))
+	late.Published = now.Add(-24 * time.Hour)
+	inbox := vocab.ItemCollection{
+		create("https://remote.example/activities/1", remote, note("https://remote.example/objects/1", vocab.PublicNS, group)),
+		late,
+		create("https://remote.example/activities/handled", remote, note("https://remote.example/objects/handled", vocab.PublicNS, group)),
+		create("https://fedbox.git/activities/local", local, note("https://fedbox.git/objects/local", vocab.PublicNS, group)),
+		create("https://remote.example/activities/private", remote, note("https://remote.example/objects/private", group)),
+		create("https://remote.example/activities/other", remote, note("https://remote.example/objects/other", vocab.PublicNS)),
+		create("https://remote.example/activities/spam", banned, note("https://remote.example/objects/spam", vocab.PublicNS, group)),
+		create("https://remote.example/activities/removed", remote, note("https://remote.example/objects/removed", vocab.PublicNS, group)),
+		follow("https://remote.example/activities/follow", remote, group),
+		follow("https://remote.example/activities/follow-other", remote, local),
+		follow("https://remote.example/activities/follow-banned", banned, group),
+	}
+
+	creates, follows := groupInboxActivities(g, inbox)
+	if len(creates) != 2 || creates[0].GetLink() != "https://remote.example/activities/1" || creates[1].GetLink() != late.GetLink() {
+		t.Errorf("groupInboxActivities() creates = %v, want only the public remote creates addressed to the group", creates)
+	}
+	if len(follows) != 1 || follows[0].GetLink() != "https://remote.example/activities/follow" {
+		t.Errorf("groupInboxActivities() follows = %v, want only the remote follow of the group", follows)
+	}
+
+	for _, act := range append(creates, follows...) {
+		g.InboxHandled = append(g.InboxHandled, act.GetLink().String())
+	}
+	if creates, follows = groupInboxActivities(g, inbox); len(creates) > 0 || len(follows) > 0 {
+		t.Errorf("groupInboxActivities() returned the activities handled by the previous check")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	xerrors "errors"
 	"fmt"
 	"hash/crc32"
+	"html/template"
 	"io"
 	"net/http"
 	"net/url"
@@ -59,7 +60,16 @@ func enhanceItem(c *Cursor, n *Item) {
 		n.Metadata.To = append(n.Metadata.To, *pi.SubmittedBy)
 	}
 	if pi.Private() {
+		// replies to private items keep their audience, so they don't end up addressed to the public
 		n.MakePrivate()
+		if pi.HasMetadata() {
+			for _, rec := range pi.Metadata.To {
+				if !rec.HasMetadata() || (n.SubmittedBy != nil && rec.ID() == n.SubmittedBy.ID()) || n.Metadata.To.Contains(rec) {
+					continue
+				}
+				n.Metadata.To = append(n.Metadata.To, rec)
+			}
+		}
 	}
 	if pi.OP != nil && pi.OP.IsValid() {
 		n.OP = pi.OP
@@ -94,8 +104,64 @@ func (h *handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 		h.v.HandleErrors(w, r, errors.NewMethodNotAllowed(err, ""))
 		return
 	}
+	attachments, err := attachmentsFromRequest(r, Instance.Conf.AttachmentMaxSize)
+	if err != nil {
+		h.errFn(log.Ctx{"err": err.Error()})("invalid attachments")
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	if len(attachments) > 0 {
+		n.Metadata.Attachments = attachments
+	}
+	if name := strings.TrimSpace(r.PostFormValue("group")); name != "" && saveVote && n.Parent == nil && !n.Private() {
+		g, err := h.storage.loadGroup(r.Context(), strings.TrimPrefix(name, "g/"))
+		if err != nil {
+			h.v.HandleErrors(w, r, err)
+			return
+		}
+		n.Metadata.To = append(n.Metadata.To, *g.Account)
+	}
+	if saveVote && n.Parent == nil {
+		poll, err := pollFromRequest(r)
+		if err != nil {
+			h.v.HandleErrors(w, r, err)
+			return
+		}
+		if poll != nil {
+			n.Metadata.Poll = poll
+		}
+	}
 	enhanceItem(c, &n)
 	repo := h.storage
+	if saveVote && n.Parent == nil && n.IsLink() && !n.Private() {
+		ex, err := repo.findSubmittedLink(r.Context(), n)
+		if err != nil {
+			h.errFn(log.Ctx{"err": err.Error(), "url": n.Data})("unable to search for previous submissions")
+		}
+		grace := Instance.Conf.RepostGracePeriod
+		if ex != nil && !repostAllowed(ex, r.PostFormValue("repost") != "", grace) {
+			m := &contentModel{Content: new(Item)}
+			submissionModel(m, r.PostFormValue("group"))
+			m.Message.Title = template.HTML(template.HTMLEscapeString(n.Title))
+			m.Message.Content = template.HTML(template.HTMLEscapeString(n.Data))
+			m.Message.Warning = htmlf(`This link has already been submitted recently, you can join <a href="%s">the discussion</a>.`, ItemPermaLink(ex))
+			if time.Since(ex.SubmittedAt) > grace {
+				m.Message.Warning = htmlf(`This link has been <a href="%s">discussed before</a>. To start a new discussion, submit it again with "post anyway" checked.`, ItemPermaLink(ex))
+			}
+			if err := h.v.RenderTemplate(r, w, m.Template(), m); err != nil {
+				h.v.HandleErrors(w, r, err)
+			}
+			return
+		}
+		if p, err := h.preview.Fetch(r.Context(), n.Data); err == nil && p.IsValid() {
+			n.Metadata.Preview = &p
+			if n.Title == "" {
+				n.Title = p.Title
+			}
+		} else if err != nil {
+			h.errFn(log.Ctx{"err": err.Error(), "url": n.Data})("unable to load link preview")
+		}
+	}
 	if n, err = repo.SaveItem(r.Context(), n); err != nil {
 		h.errFn(log.Ctx{"err": err.Error()})("unable to save item")
 		h.v.HandleErrors(w, r, err)
@@ -450,6 +516,12 @@ func (h *handler) HandleFollowInstanceRequest(w http.ResponseWriter, r *http.Req
 		h.v.HandleErrors(w, r, err)
 		return
 	}
+	if fol.IsGroup() {
+		// the listing of a group shows the threads it announces, so we send the account there
+		h.v.addFlashMessage(Success, w, r, fmt.Sprintf("Successfully sent a follow request to group: %s", ShowAccountHandle(&fol)))
+		h.v.Redirect(w, r, AccountLocalLink(&fol), http.StatusSeeOther)
+		return
+	}
 	h.v.addFlashMessage(Success, w, r, fmt.Sprintf("Successfully sent a follow request to instance: %s", instanceURL))
 	h.v.Redirect(w, r, backURL, http.StatusSeeOther)
 }
@@ -722,6 +794,21 @@ func (h *handler) ValidateLoggedIn(eh ErrorHandler) Handler {
 	}
 }
 
+// ValidateAccountOwner allows only the account in the URL to access the page
+func (h *handler) ValidateAccountOwner(eh ErrorHandler) Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			authors := ContextAuthors(r.Context())
+			if len(authors) == 0 || authors[0].Hash != loggedAccount(r).Hash {
+				eh(w, r, errors.NotFoundf("%s", strings.TrimLeft(r.URL.Path, "/")))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
 func (h *handler) ValidateModerator() Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
@@ -835,28 +922,49 @@ func (h *handler) HandleCreateInvitation(w http.ResponseWriter, r *http.Request)
 	}
 
 	acc.Metadata.InvalidateOutbox()
-	h.v.addFlashMessage(Info, w, r, "Invitation generated successfully.\nYou can now send an email to the person you want to invite by clicking the envelope icon.")
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	if email == "" || !h.conf.MailEnabled() {
+		h.v.addFlashMessage(Info, w, r, "Invitation generated successfully.\nYou can now send an email to the person you want to invite by clicking the envelope icon.")
+		h.v.Redirect(w, r, PermaLink(acc), http.StatusMovedPermanently)
+		return
+	}
+	if invitee.CreatedBy == nil {
+		invitee.CreatedBy = acc
+	}
+	subject, body := invitationMessage(h.conf.HostName, &invitee)
+	if err = h.storage.mail.Send(email, subject, body); err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "invitee": invitee.Hash})("unable to send invitation email")
+		h.v.addFlashMessage(Warning, w, r, "Invitation generated, but we were unable to email it.\nYou can still send it yourself by clicking the envelope icon.")
+	} else {
+		h.v.addFlashMessage(Success, w, r, fmt.Sprintf("Invitation sent to %s.", email))
+	}
 	h.v.Redirect(w, r, PermaLink(acc), http.StatusMovedPermanently)
 }
 
 // HandleChangePassword handles POST /pw requests
 func (h *handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
-	a, err := h.accountFromPost(r)
-	if err != nil {
+	if err := h.changePassword(r); err != nil {
 		h.v.HandleErrors(w, r, err)
 		return
 	}
+	h.v.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// changePassword sets the password from the POST request for the account in it
+func (h *handler) changePassword(r *http.Request) error {
+	a, err := h.accountFromPost(r)
+	if err != nil {
+		return err
+	}
 
 	repo := ContextRepository(r.Context())
 	maybeExists, err := repo.account(r.Context(), AccountByHandleCheck(a.Handle))
 	if err != nil && !errors.IsNotFound(err) {
 		h.logger.WithContext(log.Ctx{"handle": a.Handle, "err": err}).Warnf("error when trying to load account")
-		h.v.HandleErrors(w, r, errors.NewBadRequest(err, "error when trying to load account %s", a.Handle))
-		return
+		return errors.NewBadRequest(err, "error when trying to load account %s", a.Handle)
 	}
 	if !maybeExists.IsValid() {
-		h.v.HandleErrors(w, r, errors.BadRequestf("could not find account %s", a.Handle))
-		return
+		return errors.BadRequestf("could not find account %s", a.Handle)
 	}
 
 	app := h.storage.app
@@ -864,12 +972,10 @@ func (h *handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
 	a, err = h.storage.SaveAccount(r.Context(), a)
 	if err != nil {
 		h.errFn()("Error: %s", err)
-		h.v.HandleErrors(w, r, err)
-		return
+		return err
 	}
 	if !a.IsValid() || !a.HasMetadata() || a.Metadata.ID == "" {
-		h.v.HandleErrors(w, r, errors.Newf("unable to save actor"))
-		return
+		return errors.Newf("unable to save actor")
 	}
 
 	// TODO(marius): Start oauth2 authorize session
@@ -880,37 +986,25 @@ func (h *handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
 
 	res, err := http.Get(sessUrl)
 	if err != nil {
-		h.v.HandleErrors(w, r, err)
-		return
+		return err
 	}
 
 	var body []byte
 	if body, err = io.ReadAll(res.Body); err != nil {
-		h.v.HandleErrors(w, r, err)
-		return
+		return err
 	}
 	if res.StatusCode != http.StatusOK {
-		incoming, e := errors.UnmarshalJSON(body)
-		var errs []error
-		if e == nil {
-			errs = make([]error, len(incoming))
-			for i := range incoming {
-				errs[i] = incoming[i]
-			}
-		} else {
-			errs = []error{errors.WrapWithStatus(res.StatusCode, errors.Newf(""), "invalid response")}
+		if incoming, e := errors.UnmarshalJSON(body); e == nil && len(incoming) > 0 {
+			return incoming[0]
 		}
-		h.v.HandleErrors(w, r, errs...)
-		return
+		return errors.WrapWithStatus(res.StatusCode, errors.Newf(""), "invalid response")
 	}
 	d := osin.AuthorizeData{}
 	if err := json.Unmarshal(body, &d); err != nil {
-		h.v.HandleErrors(w, r, err)
-		return
+		return err
 	}
 	if d.Code == "" {
-		h.v.HandleErrors(w, r, errors.NotValidf("unable to get session token for setting the user's password"))
-		return
+		return errors.NotValidf("unable to get session token for setting the user's password")
 	}
 
 	// pos
@@ -927,17 +1021,17 @@ func (h *handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
 	form.Add("pw-confirm", pwConfirm)
 
 	pwChRes, err := http.Post(u.String(), "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
 	if body, err = io.ReadAll(pwChRes.Body); err != nil {
 		h.errFn()("Error: %s", err)
-		h.v.HandleErrors(w, r, err)
-		return
+		return err
 	}
 	if pwChRes.StatusCode != http.StatusOK {
-		h.v.HandleErrors(w, r, h.storage.handlerErrorResponse(body))
-		return
+		return h.storage.handlerErrorResponse(body)
 	}
-	h.v.Redirect(w, r, "/", http.StatusSeeOther)
-	return
+	return nil
 }
 
 // HandleRegister handles POST /register requests
@@ -1390,6 +1484,14 @@ func (h *handler) HandleShow(w http.ResponseWriter, r *http.Request) {
 			mod.SetCursor(cursor)
 		}
 	}
+	if wantsJSON(r) {
+		if ok, err := h.v.RenderJSON(w, m); ok {
+			if err != nil {
+				h.v.HandleErrors(w, r, err)
+			}
+			return
+		}
+	}
 	if err := h.v.RenderTemplate(r, w, m.Template(), m); err != nil {
 		h.v.HandleErrors(w, r, err)
 	}
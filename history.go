@@ -0,0 +1,326 @@
+package brutalinks
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+)
+
+// maxDiffWords limits the size of the texts we compute word level differences for.
+// Over it, we show the old text as removed and the new one as added.
+const maxDiffWords = 1000
+
+// Revision is a version of an item, as it was published by a Create or an Update activity
+type Revision struct {
+	Title     string    `json:"title,omitempty"`
+	Data      string    `json:"data,omitempty"`
+	MimeType  string    `json:"mimeType,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Activity  vocab.IRI `json:"activity,omitempty"`
+}
+
+func revisionFromItem(it Item) Revision {
+	rev := Revision{Title: it.Title, Data: it.Data, MimeType: it.MimeType, UpdatedAt: it.UpdatedAt}
+	if rev.UpdatedAt.IsZero() {
+		rev.UpdatedAt = it.SubmittedAt
+	}
+	return rev
+}
+
+func revisionFromActivity(act *vocab.Activity) (Revision, bool) {
+	it := Item{}
+	if err := it.FromActivityPub(act.Object); err != nil || vocab.IsNil(act.Object) || act.Object.IsLink() {
+		// the storage can keep only the IRI of the object, the revisionStore has the versions of those
+		return Revision{}, false
+	}
+	rev := revisionFromItem(it)
+	rev.Activity = act.GetLink()
+	if !act.Published.IsZero() {
+		rev.UpdatedAt = act.Published
+	}
+	return rev, true
+}
+
+func (r Revision) same(o Revision) bool {
+	return r.Title == o.Title && r.Data == o.Data
+}
+
+// revisionStore keeps the previous versions of the edited items in JSON files, one for each item
+type revisionStore struct {
+	m    sync.Mutex
+	path string
+}
+
+// revisionStoreNew returns a store saving the revisions in a "revisions" folder next to the storage at path
+func revisionStoreNew(path string) *revisionStore {
+	return &revisionStore{path: filepath.Join(storageDir(path), "revisions")}
+}
+
+func (s *revisionStore) file(h Hash) string {
+	return filepath.Join(s.path, h.String()+".json")
+}
+
+// Load returns the previous versions of the item with hash h, in the order they were added
+func (s *revisionStore) Load(h Hash) ([]Revision, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.load(h)
+}
+
+func (s *revisionStore) load(h Hash) ([]Revision, error) {
+	revisions := make([]Revision, 0)
+	if err := loadJSONFile(s.file(h), &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Add appends rev to the previous versions of the item with hash h
+func (s *revisionStore) Add(h Hash, rev Revision) error {
+	if s == nil {
+		return errors.NotImplementedf("revisions are not available")
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	revisions, err := s.load(h)
+	if err != nil {
+		return err
+	}
+	return saveJSONFile(s.file(h), append(revisions, rev))
+}
+
+// storedRevision returns the version of the item with iri from storage, before we update it
+func (r *repository) storedRevision(iri vocab.IRI) (Revision, bool) {
+	res, err := r.b.Search(filters.SameIRI(iri), filters.WithMaxCount(1))
+	if err != nil {
+		r.errFn(log.Ctx{"err": err.Error(), "iri": iri})("unable to load the item before updating it")
+		return Revision{}, false
+	}
+	for _, li := range res {
+		ob, ok := li.(vocab.Item)
+		if !ok || vocab.IsNil(ob) {
+			continue
+		}
+		it := Item{}
+		if err := it.FromActivityPub(ob); err == nil {
+			return revisionFromItem(it), true
+		}
+	}
+	return Revision{}, false
+}
+
+// loadItemRevisions returns the versions of it, oldest first, from the Create and Update activities
+// that have it as an object, and from the versions we kept when it was edited.
+func (r *repository) loadItemRevisions(ctx context.Context, it Item) ([]Revision, error) {
+	if vocab.IsNil(it.Pub) {
+		return nil, errors.NotFoundf("invalid item")
+	}
+	res, err := r.b.Search(
+		filters.HasType(vocab.CreateType, vocab.UpdateType),
+		filters.Object(filters.SameIRI(it.Pub.GetLink())),
+	)
+	if err != nil {
+		return nil, err
+	}
+	activities := make(vocab.ItemCollection, 0, len(res))
+	for _, li := range res {
+		if ob, ok := li.(vocab.Item); ok && !vocab.IsNil(ob) {
+			activities = append(activities, ob)
+		}
+	}
+	stored, err := r.revisions.Load(it.Hash)
+	if err != nil {
+		r.errFn(log.Ctx{"err": err.Error(), "item": it.Hash})("unable to load the item revisions")
+	}
+	return itemRevisions(it, stored, activities), nil
+}
+
+// itemRevisions merges the stored versions of it with the ones from the activities, oldest first.
+// The current version of the item is always the last one.
+func itemRevisions(it Item, stored []Revision, activities vocab.ItemCollection) []Revision {
+	revisions := make([]Revision, 0, len(stored)+len(activities)+1)
+	revisions = append(revisions, stored...)
+	for _, ob := range activities {
+		_ = vocab.OnActivity(ob, func(act *vocab.Activity) error {
+			if rev, ok := revisionFromActivity(act); ok {
+				revisions = append(revisions, rev)
+			}
+			return nil
+		})
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].UpdatedAt.Before(revisions[j].UpdatedAt)
+	})
+	revisions = append(revisions, revisionFromItem(it))
+
+	// updates which didn't change the title or the content (eg, adding recipients) are not
+	// interesting, so we keep only the last one of a sequence of identical revisions
+	result := make([]Revision, 0, len(revisions))
+	for _, rev := range revisions {
+		if l := len(result); l > 0 && result[l-1].same(rev) {
+			result[l-1] = rev
+			continue
+		}
+		result = append(result, rev)
+	}
+	return result
+}
+
+type diffOp int8
+
+const (
+	diffEqual diffOp = iota
+	diffInsert
+	diffDelete
+)
+
+// diffChunk is a sequence of words which have been kept, added, or removed between two texts
+type diffChunk struct {
+	Op   diffOp
+	Text string
+}
+
+func (c diffChunk) IsInsert() bool {
+	return c.Op == diffInsert
+}
+
+func (c diffChunk) IsDelete() bool {
+	return c.Op == diffDelete
+}
+
+// wordDiff returns the chunks of words that need to be removed from, or added to, the from text to
+// obtain the to text. The words are compared using their longest common subsequence.
+func wordDiff(from, to string) []diffChunk {
+	a, b := strings.Fields(from), strings.Fields(to)
+
+	chunks := make([]diffChunk, 0)
+	add := func(op diffOp, words ...string) {
+		if len(words) == 0 {
+			return
+		}
+		text := strings.Join(words, " ")
+		if l := len(chunks); l > 0 && chunks[l-1].Op == op {
+			chunks[l-1].Text += " " + text
+			return
+		}
+		chunks = append(chunks, diffChunk{Op: op, Text: text})
+	}
+
+	if len(a) > maxDiffWords || len(b) > maxDiffWords {
+		add(diffDelete, a...)
+		add(diffInsert, b...)
+		return chunks
+	}
+
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			add(diffEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(diffDelete, a[i])
+			i++
+		default:
+			add(diffInsert, b[j])
+			j++
+		}
+	}
+	add(diffDelete, a[i:]...)
+	add(diffInsert, b[j:]...)
+	return chunks
+}
+
+type historyModel struct {
+	Title     template.HTML
+	Item      *Item
+	Revisions []Revision
+	From      int
+	To        int
+	TitleDiff []diffChunk
+	DataDiff  []diffChunk
+}
+
+func (m *historyModel) SetTitle(s string) {
+	m.Title = template.HTML(s)
+}
+
+func (m historyModel) Template() string {
+	return "history"
+}
+
+func (*historyModel) SetCursor(c *Cursor) {}
+
+// revisionIndex returns the position of the revision in the q query parameter, or def if it's missing or invalid
+func revisionIndex(r *http.Request, q string, count, def int) int {
+	idx, err := strconv.Atoi(r.URL.Query().Get(q))
+	if err != nil || idx < 0 || idx >= count {
+		return def
+	}
+	return idx
+}
+
+// HistoryModelMw loads the revisions of the current item, and the differences between the two revisions
+// in the "from" and "to" query parameters. By default, it compares the last two revisions.
+func HistoryModelMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item := ContextItem(r.Context())
+		if !item.IsValid() || item.Deleted() {
+			ctxtErr(next, w, r, errors.NotFoundf("%s", strings.TrimLeft(r.URL.Path, "/")))
+			return
+		}
+		repo := ContextRepository(r.Context())
+		revisions, err := repo.loadItemRevisions(r.Context(), *item)
+		if err != nil {
+			ctxtErr(next, w, r, err)
+			return
+		}
+
+		last := len(revisions) - 1
+		m := &historyModel{Item: item, Revisions: revisions}
+		m.To = revisionIndex(r, "to", len(revisions), last)
+		m.From = revisionIndex(r, "from", len(revisions), max(m.To-1, 0))
+		if m.From > m.To {
+			m.From, m.To = m.To, m.From
+		}
+		from, to := revisions[m.From], revisions[m.To]
+		m.TitleDiff = wordDiff(from.Title, to.Title)
+		m.DataDiff = wordDiff(from.Data, to.Data)
+
+		m.Title = "Edit history"
+		if item.Title != "" {
+			m.Title = htmlf("Edit history: %s", template.HTMLEscapeString(item.Title))
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ModelCtxtKey, m)))
+	})
+}
@@ -0,0 +1,156 @@
+package brutalinks
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/uuid"
+)
+
+func TestWordDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     []diffChunk
+	}{
+		{
+			name: "empty",
+			want: []diffChunk{},
+		},
+		{
+			name: "same",
+			from: "lorem ipsum",
+			to:   "lorem  ipsum\n",
+			want: []diffChunk{{Op: diffEqual, Text: "lorem ipsum"}},
+		},
+		{
+			name: "added",
+			to:   "lorem ipsum",
+			want: []diffChunk{{Op: diffInsert, Text: "lorem ipsum"}},
+		},
+		{
+			name: "removed",
+			from: "lorem ipsum",
+			want: []diffChunk{{Op: diffDelete, Text: "lorem ipsum"}},
+		},
+		{
+			name: "changed word",
+			from: "the quick brown fox",
+			to:   "the slow brown fox jumps",
+			want: []diffChunk{
+				{Op: diffEqual, Text: "the"},
+				{Op: diffDelete, Text: "quick"},
+				{Op: diffInsert, Text: "slow"},
+				{Op: diffEqual, Text: "brown fox"},
+				{Op: diffInsert, Text: "jumps"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wordDiff(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wordDiff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevisionFromActivity(t *testing.T) {
+	published := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	ob := &vocab.Object{
+		ID:        "https://brutalinks.git/objects/1",
+		Type:      vocab.NoteType,
+		Name:      vocab.DefaultNaturalLanguage("Title"),
+		Content:   vocab.DefaultNaturalLanguage("Content"),
+		MediaType: MimeTypeMarkdown,
+		Published: published.Add(-time.Hour),
+	}
+	tests := []struct {
+		name string
+		act  *vocab.Activity
+		want Revision
+		ok   bool
+	}{
+		{
+			name: "embedded object",
+			act:  &vocab.Activity{ID: "https://brutalinks.git/activities/1", Type: vocab.UpdateType, Object: ob, Published: published},
+			want: Revision{Title: "Title", Data: "Content", MimeType: MimeTypeMarkdown, UpdatedAt: published, Activity: "https://brutalinks.git/activities/1"},
+			ok:   true,
+		},
+		{
+			name: "object without activity date",
+			act:  &vocab.Activity{ID: "https://brutalinks.git/activities/2", Type: vocab.CreateType, Object: ob},
+			want: Revision{Title: "Title", Data: "Content", MimeType: MimeTypeMarkdown, UpdatedAt: published.Add(-time.Hour), Activity: "https://brutalinks.git/activities/2"},
+			ok:   true,
+		},
+		{
+			name: "flattened object",
+			act:  &vocab.Activity{ID: "https://brutalinks.git/activities/3", Type: vocab.UpdateType, Object: ob.GetLink(), Published: published},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := revisionFromActivity(tt.act)
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("revisionFromActivity() = %+v, %t, want %+v, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestItemRevisions(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	it := Item{Hash: Hash(uuid.New()), Title: "Third", Data: "third", SubmittedAt: start, UpdatedAt: start.Add(3 * time.Hour)}
+	stored := []Revision{
+		{Title: "First", Data: "first", UpdatedAt: start},
+		{Title: "Second", Data: "second", UpdatedAt: start.Add(time.Hour)},
+		{Title: "Second", Data: "second", UpdatedAt: start.Add(2 * time.Hour)},
+	}
+	activities := vocab.ItemCollection{
+		&vocab.Activity{Type: vocab.CreateType, Object: vocab.IRI("https://brutalinks.git/objects/1"), Published: start},
+		&vocab.Activity{Type: vocab.UpdateType, Object: vocab.IRI("https://brutalinks.git/objects/1"), Published: start.Add(time.Hour)},
+	}
+
+	got := itemRevisions(it, stored, activities)
+	titles := make([]string, 0, len(got))
+	for _, rev := range got {
+		titles = append(titles, rev.Title)
+	}
+	if want := []string{"First", "Second", "Third"}; !reflect.DeepEqual(titles, want) {
+		t.Fatalf("itemRevisions() = %v, want %v", titles, want)
+	}
+	if !got[1].UpdatedAt.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("itemRevisions() did not keep the last of the identical revisions: %s", got[1].UpdatedAt)
+	}
+	if only := itemRevisions(it, nil, nil); len(only) != 1 || only[0].Title != "Third" {
+		t.Errorf("itemRevisions() without history = %+v, want only the current version", only)
+	}
+}
+
+func TestRevisionStore(t *testing.T) {
+	s := revisionStoreNew(t.TempDir())
+	h := Hash(uuid.New())
+
+	if revs, err := s.Load(h); err != nil || len(revs) != 0 {
+		t.Fatalf("Load() of an item without revisions = %v, %v", revs, err)
+	}
+	first := Revision{Title: "First", Data: "first", MimeType: MimeTypeMarkdown, UpdatedAt: time.Now().UTC().Truncate(time.Second)}
+	second := Revision{Title: "Second", Data: "second", UpdatedAt: first.UpdatedAt.Add(time.Hour)}
+	for _, rev := range []Revision{first, second} {
+		if err := s.Add(h, rev); err != nil {
+			t.Fatalf("Add() error = %s", err)
+		}
+	}
+	revs, err := s.Load(h)
+	if err != nil {
+		t.Fatalf("Load() error = %s", err)
+	}
+	if !reflect.DeepEqual(revs, []Revision{first, second}) {
+		t.Errorf("Load() = %+v, want %+v", revs, []Revision{first, second})
+	}
+	if other, _ := s.Load(Hash(uuid.New())); len(other) != 0 {
+		t.Errorf("Load() returned the revisions of another item: %+v", other)
+	}
+}
@@ -3,6 +3,8 @@ package brutalinks
 import (
 	"math"
 	"time"
+
+	"git.sr.ht/~mariusor/brutalinks/internal/config"
 )
 
 // StatisticalConfidence represents the statistical confidence
@@ -22,9 +24,9 @@ func Wilson(ups, downs int64) float64 {
 
 	n1 := float64(n)
 	z := StatisticalConfidence
-	p := float64(ups / n)
+	p := float64(ups) / n1
 	zzfn := z * z / (4 * n1)
-	w := (p + 2.0*zzfn - z*math.Sqrt((zzfn/n1+p*(1.0-p))/n1)) / (1 + 4*zzfn)
+	w := (p + 2.0*zzfn - z*math.Sqrt((zzfn+p*(1.0-p))/n1)) / (1 + 4*zzfn)
 
 	return w
 }
@@ -37,13 +39,28 @@ func Hacker(votes int64, date time.Duration) float64 {
 	return float64(votes) / math.Pow(secondsAge+ageDelta, HNGravity)
 }
 
-// Decay represents the decay rate for reddit scores
-var Decay = 45000.0
+// Controversy ranks higher the items with more votes, that are more evenly split between ups and downs
+func Controversy(ups, downs int64) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+	magnitude := float64(ups + downs)
+	balance := float64(downs) / float64(ups)
+	if ups < downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(magnitude, balance)
+}
 
-// Reddit implements reddit's hot sort
-// http://amix.dk/blog/post/19588
-func Reddit(ups, downs int64, date time.Duration) float64 {
-	s := float64(ups - downs)
-	order := math.Log(math.Max(math.Abs(s), 1)) / math.Ln10
-	return order - date.Seconds()/Decay
+// loadRankingConfig overrides the ranking parameters with the values set in the configuration
+func loadRankingConfig(c *config.Configuration) {
+	if c == nil {
+		return
+	}
+	if c.HNGravity > 0 {
+		HNGravity = c.HNGravity
+	}
+	if c.StatisticalConfidence > 0 {
+		StatisticalConfidence = c.StatisticalConfidence
+	}
 }
@@ -0,0 +1,83 @@
+package brutalinks
+
+import (
+	"testing"
+)
+
+func TestWilson(t *testing.T) {
+	tests := []struct {
+		name         string
+		ups, downs   int64
+		better       [2]int64
+		wantPositive bool
+	}{
+		{
+			name:         "no votes",
+			ups:          0,
+			downs:        0,
+			wantPositive: false,
+		},
+		{
+			name:         "only up votes rank higher than an even split",
+			ups:          10,
+			downs:        0,
+			better:       [2]int64{5, 5},
+			wantPositive: true,
+		},
+		{
+			name:         "more votes with the same ratio rank higher",
+			ups:          90,
+			downs:        10,
+			better:       [2]int64{9, 1},
+			wantPositive: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Wilson(tt.ups, tt.downs)
+			if (got > 0) != tt.wantPositive {
+				t.Errorf("Wilson(%d, %d) = %f, want positive %t", tt.ups, tt.downs, got, tt.wantPositive)
+			}
+			if got < 0 || got > 1 {
+				t.Errorf("Wilson(%d, %d) = %f, should be in the [0, 1] interval", tt.ups, tt.downs, got)
+			}
+			if tt.better[0]+tt.better[1] == 0 {
+				return
+			}
+			if other := Wilson(tt.better[0], tt.better[1]); got <= other {
+				t.Errorf("Wilson(%d, %d) = %f, should be greater than Wilson(%d, %d) = %f", tt.ups, tt.downs, got, tt.better[0], tt.better[1], other)
+			}
+		})
+	}
+}
+
+func TestControversy(t *testing.T) {
+	tests := []struct {
+		name     string
+		ups      int64
+		downs    int64
+		wantNone bool
+		better   [2]int64
+	}{
+		{name: "no votes", wantNone: true},
+		{name: "only ups", ups: 10, wantNone: true},
+		{name: "only downs", downs: 10, wantNone: true},
+		{name: "even split beats uneven", ups: 10, downs: 10, better: [2]int64{15, 5}},
+		{name: "more votes beat fewer", ups: 20, downs: 20, better: [2]int64{10, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Controversy(tt.ups, tt.downs)
+			if tt.wantNone {
+				if got != 0 {
+					t.Errorf("Controversy(%d, %d) = %v, want 0", tt.ups, tt.downs, got)
+				}
+				return
+			}
+			other := Controversy(tt.better[0], tt.better[1])
+			if got <= other {
+				t.Errorf("Controversy(%d, %d) = %v, want more than Controversy(%d, %d) = %v", tt.ups, tt.downs, got, tt.better[0], tt.better[1], other)
+			}
+		})
+	}
+}
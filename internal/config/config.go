@@ -40,19 +40,39 @@ type Configuration struct {
 	CachingEnabled             bool
 	AutoAcceptFollows          bool
 	MaintenanceMode            bool
+	StatsRefreshInterval       time.Duration
+	RankIndexRefreshInterval   time.Duration
+	SearchIndexSize            int
+	RepostGracePeriod          time.Duration
+	AttachmentMaxSize          int64
+	DefaultSort                string
+	HNGravity                  float64
+	StatisticalConfidence      float64
 	SessionKeys                [][]byte
 	SessionsBackend            string
 	SessionsPath               string
 	OAuth2App                  string
 	OAuth2Secret               string
 	OAuth2URL                  string
+	SMTPHost                   string
+	SMTPPort                   int
+	SMTPUser                   string
+	SMTPPassword               string
+	MailFrom                   string
 	Version                    string
 }
 
 const (
-	DefaultListenPort = 3000
-	DefaultListenHost = ""
-	Prefix            = "BRUTAL"
+	DefaultListenPort           = 3000
+	DefaultListenHost           = ""
+	DefaultStatsRefreshInterval = 30 * time.Minute
+	DefaultRankRefreshInterval  = 5 * time.Minute
+	DefaultSearchIndexSize      = 20000
+	DefaultRepostGracePeriod    = 7 * 24 * time.Hour
+	DefaultAttachmentMaxSize    = 2 << 20
+	DefaultSort                 = "hot"
+	DefaultSMTPPort             = 587
+	Prefix                      = "BRUTAL"
 
 	SessionsCookieBackend = "cookie"
 	SessionsFSBackend     = "fs"
@@ -83,6 +103,14 @@ const (
 	KeyDisableCaching             = "DISABLE_CACHING"
 	KeyAutoAcceptFollows          = "AUTO_ACCEPT_FOLLOWS"
 	KeyAdminContact               = "ADMIN_CONTACT"
+	KeyStatsRefreshInterval       = "STATS_REFRESH_INTERVAL"
+	KeyRankIndexRefreshInterval   = "RANK_INDEX_REFRESH_INTERVAL"
+	KeySearchIndexSize            = "SEARCH_INDEX_SIZE"
+	KeyRepostGracePeriod          = "REPOST_GRACE_PERIOD"
+	KeyAttachmentMaxSize          = "ATTACHMENT_MAX_SIZE"
+	KeyDefaultSort                = "DEFAULT_SORT"
+	KeyHNGravity                  = "HN_GRAVITY"
+	KeyStatisticalConfidence      = "STATISTICAL_CONFIDENCE"
 
 	KeyMaintenanceMode = "MAINTENANCE_MODE"
 
@@ -95,6 +123,12 @@ const (
 	KeySessionEncKey  = "SESS_ENC_KEY"
 	KeySessionBackend = "SESSIONS_BACKEND"
 	KeySessionPath    = "SESSIONS_PATH"
+
+	KeySMTPHost     = "SMTP_HOST"
+	KeySMTPPort     = "SMTP_PORT"
+	KeySMTPUser     = "SMTP_USER"
+	KeySMTPPassword = "SMTP_PASSWORD"
+	KeyMailFrom     = "MAIL_FROM"
 )
 
 func prefKey(k string) string {
@@ -201,6 +235,31 @@ func Load(e EnvType, wait time.Duration) *Configuration {
 
 	c.AdminContact = loadKeyFromEnv(KeyAdminContact, "")
 
+	c.StatsRefreshInterval = DefaultStatsRefreshInterval
+	if si, err := time.ParseDuration(loadKeyFromEnv(KeyStatsRefreshInterval, "")); err == nil {
+		c.StatsRefreshInterval = si
+	}
+	c.RankIndexRefreshInterval = DefaultRankRefreshInterval
+	if ri, err := time.ParseDuration(loadKeyFromEnv(KeyRankIndexRefreshInterval, "")); err == nil {
+		c.RankIndexRefreshInterval = ri
+	}
+	c.SearchIndexSize = DefaultSearchIndexSize
+	if ss, err := strconv.Atoi(loadKeyFromEnv(KeySearchIndexSize, "")); err == nil && ss > 0 {
+		c.SearchIndexSize = ss
+	}
+	c.RepostGracePeriod = DefaultRepostGracePeriod
+	if rg, err := time.ParseDuration(loadKeyFromEnv(KeyRepostGracePeriod, "")); err == nil {
+		c.RepostGracePeriod = rg
+	}
+	c.AttachmentMaxSize = DefaultAttachmentMaxSize
+	if as, err := strconv.ParseInt(loadKeyFromEnv(KeyAttachmentMaxSize, ""), 10, 64); err == nil && as > 0 {
+		c.AttachmentMaxSize = as
+	}
+
+	c.DefaultSort = strings.ToLower(loadKeyFromEnv(KeyDefaultSort, DefaultSort))
+	c.HNGravity, _ = strconv.ParseFloat(loadKeyFromEnv(KeyHNGravity, ""), 64)
+	c.StatisticalConfidence, _ = strconv.ParseFloat(loadKeyFromEnv(KeyStatisticalConfidence, ""), 64)
+
 	c.APIURL = loadKeyFromEnv(KeyAPIUrl, "")
 
 	c.SessionsBackend = loadKeyFromEnv(KeySessionBackend, SessionsFSBackend)
@@ -223,9 +282,23 @@ func Load(e EnvType, wait time.Duration) *Configuration {
 		c.OAuth2URL = u.String()
 	}
 
+	c.SMTPHost = loadKeyFromEnv(KeySMTPHost, "")
+	c.SMTPPort = DefaultSMTPPort
+	if port, _ := strconv.ParseInt(loadKeyFromEnv(KeySMTPPort, ""), 10, 32); port > 0 {
+		c.SMTPPort = int(port)
+	}
+	c.SMTPUser = loadKeyFromEnv(KeySMTPUser, "")
+	c.SMTPPassword = loadKeyFromEnv(KeySMTPPassword, "")
+	c.MailFrom = loadKeyFromEnv(KeyMailFrom, "")
+
 	return c
 }
 
+// MailEnabled returns true if we have an SMTP server to send emails through
+func (c Configuration) MailEnabled() bool {
+	return c.SMTPHost != ""
+}
+
 func (c Configuration) Listen() string {
 	if len(c.ListenHost) > 0 {
 		return fmt.Sprintf("%s:%d", c.ListenHost, c.ListenPort)
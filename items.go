@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	vocab "github.com/go-ap/activitypub"
@@ -12,17 +13,27 @@ import (
 )
 
 type ItemMetadata struct {
-	To         AccountCollection `json:"to,omitempty"`
-	CC         AccountCollection `json:"cc,omitempty"`
-	Tags       TagCollection     `json:"tags,omitempty"`
-	Mentions   TagCollection     `json:"mentions,omitempty"`
-	ID         string            `json:"id,omitempty"`
-	URL        string            `json:"url,omitempty"`
-	RepliesURI string            `json:"replies,omitempty"`
-	LikesURI   string            `json:"likes,omitempty"`
-	SharesURI  string            `json:"shares,omitempty"`
-	AuthorURI  string            `json:"author,omitempty"`
-	Icon       ImageMetadata     `json:"icon,omitempty"`
+	To          AccountCollection    `json:"to,omitempty"`
+	CC          AccountCollection    `json:"cc,omitempty"`
+	Tags        TagCollection        `json:"tags,omitempty"`
+	Mentions    TagCollection        `json:"mentions,omitempty"`
+	ID          string               `json:"id,omitempty"`
+	URL         string               `json:"url,omitempty"`
+	RepliesURI  string               `json:"replies,omitempty"`
+	LikesURI    string               `json:"likes,omitempty"`
+	SharesURI   string               `json:"shares,omitempty"`
+	AuthorURI   string               `json:"author,omitempty"`
+	Icon        ImageMetadata        `json:"icon,omitempty"`
+	Preview     *LinkPreview         `json:"preview,omitempty"`
+	Attachments AttachmentCollection `json:"attachments,omitempty"`
+	Poll        *Poll                `json:"poll,omitempty"`
+	// ContentWarning is the summary that is shown instead of the content, until the reader chooses to reveal it
+	ContentWarning string `json:"cw,omitempty"`
+	// Sensitive items are shown collapsed, behind their content warning, if they have one
+	Sensitive bool `json:"sensitive,omitempty"`
+	// Lang is the code of the language the title and content of the item are in
+	Lang     string           `json:"lang,omitempty"`
+	Variants []ContentVariant `json:"variants,omitempty"`
 }
 
 var ValidContentTypes = vocab.ActivityVocabularyTypes{
@@ -33,6 +44,7 @@ var ValidContentTypes = vocab.ActivityVocabularyTypes{
 	vocab.DocumentType,
 	vocab.VideoType,
 	vocab.AudioType,
+	vocab.QuestionType,
 }
 
 var ValidContentManagementTypes = vocab.ActivityVocabularyTypes{
@@ -168,6 +180,11 @@ func updateItemFromRequest(r *http.Request, author Account, i *Item) error {
 			}
 			i.Metadata.To = append(i.Metadata.To, rec)
 		}
+		for _, rec := range accountsFromRequestRecipients(r) {
+			if rec.IsValid() && rec.ID() != author.ID() && !i.Metadata.To.Contains(rec) {
+				i.Metadata.To = append(i.Metadata.To, rec)
+			}
+		}
 	}
 	if tit := r.PostFormValue("title"); len(tit) > 0 {
 		i.Title = tit
@@ -175,14 +192,26 @@ func updateItemFromRequest(r *http.Request, author Account, i *Item) error {
 	if dat := r.PostFormValue("data"); len(dat) > 0 {
 		i.Data = dat
 	}
+	if _, ok := r.PostForm["cw"]; ok {
+		i.Metadata.ContentWarning = strings.TrimSpace(r.PostFormValue("cw"))
+		i.Metadata.Sensitive = i.Metadata.ContentWarning != "" || r.PostFormValue("sensitive") != ""
+	}
 
 	i.SubmittedBy = &author
 	i.MimeType = detectMimeType(i.Data)
+	if i.IsLink() {
+		if u, err := CanonicalURL(i.Data); err == nil {
+			i.Data = u
+		}
+	}
 
 	i.Metadata.Tags, i.Metadata.Mentions = loadTags(i.Data)
 	if !i.IsLink() {
 		i.MimeType = r.PostFormValue("mime-type")
 	}
+	if _, ok := r.PostForm["lang"]; ok {
+		i.Metadata.Lang = languageFromRequest(r, *i)
+	}
 	if len(i.Data) > 0 {
 		now := time.Now().UTC()
 		i.SubmittedAt = now
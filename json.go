@@ -0,0 +1,152 @@
+package brutalinks
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+)
+
+const MimeTypeJSON = "application/json"
+
+type jsonVotes struct {
+	Up   int `json:"up"`
+	Down int `json:"down"`
+}
+
+func votesToJSON(votes VoteCollection) jsonVotes {
+	return jsonVotes{Up: votes.Ups(), Down: votes.Downs()}
+}
+
+// MarshalJSON adds the content, the votes and the replies of the item to its JSON representation
+func (i *Item) MarshalJSON() ([]byte, error) {
+	type item Item
+	j := struct {
+		*item
+		Type      string         `json:"type"`
+		IRI       string         `json:"iri,omitempty"`
+		URL       string         `json:"url,omitempty"`
+		Title     string         `json:"title,omitempty"`
+		MimeType  string         `json:"mimeType,omitempty"`
+		Content   string         `json:"content,omitempty"`
+		Published time.Time      `json:"published"`
+		Updated   *time.Time     `json:"updated,omitempty"`
+		Score     int            `json:"score"`
+		Votes     jsonVotes      `json:"votes"`
+		Parent    *Hash          `json:"parent,omitempty"`
+		Metadata  *ItemMetadata  `json:"metadata,omitempty"`
+		Private   bool           `json:"private,omitempty"`
+		Deleted   bool           `json:"deleted,omitempty"`
+		Children  RenderableList `json:"children,omitempty"`
+	}{
+		item:      (*item)(i),
+		Type:      "item",
+		URL:       absURL(ItemPermaLink(i)),
+		Published: i.SubmittedAt.UTC(),
+		Score:     i.Score(),
+		Votes:     votesToJSON(i.Votes),
+		Private:   i.Private(),
+		Deleted:   i.Deleted(),
+		Children:  i.children,
+	}
+	if i.Pub != nil {
+		j.IRI = i.Pub.GetLink().String()
+	}
+	if !i.Deleted() {
+		j.Title = i.Title
+		j.MimeType = i.MimeType
+		j.Content = i.Data
+		j.Metadata = i.Metadata
+	}
+	if !i.UpdatedAt.IsZero() && i.UpdatedAt.After(i.SubmittedAt) {
+		upd := i.UpdatedAt.UTC()
+		j.Updated = &upd
+	}
+	if i.Parent != nil && i.Parent.IsValid() {
+		p := i.Parent.ID()
+		j.Parent = &p
+	}
+	return json.Marshal(j)
+}
+
+type jsonPage struct {
+	Title string            `json:"title"`
+	User  *Account          `json:"user,omitempty"`
+	Item  json.RawMessage   `json:"item,omitempty"`
+	Items []json.RawMessage `json:"items"`
+	Next  string            `json:"next,omitempty"`
+	Prev  string            `json:"prev,omitempty"`
+}
+
+// sortChildren orders the children of ren, and theirs, with sortFn
+func sortChildren(ren Renderable, sortFn func(RenderableList) []Renderable) {
+	children := ren.Children()
+	if children == nil || len(*children) == 0 {
+		return
+	}
+	*children = sortFn(*children)
+	for _, c := range *children {
+		if c != nil {
+			sortChildren(c, sortFn)
+		}
+	}
+}
+
+func pageToJSON(m Model, logFn LogFn) (jsonPage, bool) {
+	sortFn := sortModel(m)
+	toJSON := renderableMarshalJSON(logFn)
+	page := jsonPage{Items: make([]json.RawMessage, 0)}
+	switch mm := m.(type) {
+	case *listingModel:
+		page.Title = string(mm.Title)
+		page.User = mm.User
+		for _, ren := range sortFn(mm.children) {
+			if ren == nil || !ren.IsValid() {
+				continue
+			}
+			sortChildren(ren, sortFn)
+			page.Items = append(page.Items, json.RawMessage(toJSON(ren)))
+		}
+	case *contentModel:
+		page.Title = string(mm.Title)
+		if mm.Content != nil && mm.Content.IsValid() {
+			sortChildren(mm.Content, sortFn)
+			page.Item = json.RawMessage(toJSON(mm.Content))
+		}
+	default:
+		return page, false
+	}
+	if p, ok := m.(Paginator); ok {
+		if next := p.NextPage(); next != "" {
+			page.Next = string(nextPageLink(next))
+		}
+		if prev := p.PrevPage(); prev != "" {
+			page.Prev = string(prevPageLink(prev))
+		}
+	}
+	return page, true
+}
+
+func wantsJSON(r *http.Request) bool {
+	return acceptedMediaType(r, MimeTypeHTML, MimeTypeJSON) == MimeTypeJSON
+}
+
+// RenderJSON outputs the listing or content model as JSON.
+// It returns false if the model doesn't have a JSON representation.
+func (v *view) RenderJSON(w http.ResponseWriter, m Model) (bool, error) {
+	page, ok := pageToJSON(m, v.errFn())
+	if !ok {
+		return false, nil
+	}
+	w.Header().Set("Content-Type", MimeTypeJSON+"; charset=utf-8")
+	w.Header().Set("Vary", "Accept")
+	b, err := json.Marshal(page)
+	if err != nil {
+		v.errFn(log.Ctx{"err": err})("failed to render JSON")
+		return true, err
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+	return true, nil
+}
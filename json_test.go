@@ -0,0 +1,86 @@
+package brutalinks
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/brutalinks/internal/config"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/uuid"
+)
+
+func TestPageToJSON(t *testing.T) {
+	logFn := func(s string, p ...interface{}) {
+		t.Errorf(s, p...)
+	}
+	Instance = new(Application)
+	Instance.BaseURL = url.URL{Scheme: "https", Host: "brutalinks.git"}
+	Instance.Conf = &config.Configuration{HostName: "brutalinks.git"}
+
+	now := time.Now().UTC()
+	jdoe := &Account{Hash: Hash(uuid.New()), Handle: "jdoe"}
+	older := &Item{Hash: Hash(uuid.New()), Title: "Older", Data: "older content", SubmittedBy: jdoe, SubmittedAt: now.Add(-time.Hour)}
+	newer := &Item{Hash: Hash(uuid.New()), Title: "Newer", SubmittedBy: jdoe, SubmittedAt: now, Pub: vocab.IRI("https://example.com/objects/newer")}
+	reply := &Item{Hash: Hash(uuid.New()), Data: "reply", SubmittedBy: jdoe, SubmittedAt: now, Parent: older}
+	deleted := &Item{Hash: Hash(uuid.New()), Title: "Deleted", SubmittedAt: now.Add(-time.Minute), Parent: older}
+	deleted.Delete()
+	older.children = RenderableList{deleted, reply}
+
+	m := &listingModel{Title: "Newest items", children: RenderableList{older, newer}}
+	page, ok := pageToJSON(m, logFn)
+	if !ok {
+		t.Fatalf("pageToJSON() has no JSON representation for a listing")
+	}
+
+	type jsonItem struct {
+		Hash    string `json:"hash"`
+		Type    string `json:"type"`
+		IRI     string `json:"iri"`
+		Title   string `json:"title"`
+		Content string `json:"content"`
+		Author  *struct {
+			Handle string `json:"handle"`
+		} `json:"by"`
+		Parent   string     `json:"parent"`
+		Deleted  bool       `json:"deleted"`
+		Score    int        `json:"score"`
+		Children []jsonItem `json:"children"`
+	}
+	items := make([]jsonItem, 0)
+	for _, raw := range page.Items {
+		it := jsonItem{}
+		if err := json.Unmarshal(raw, &it); err != nil {
+			t.Fatalf("invalid JSON for item %s: %s", raw, err)
+		}
+		items = append(items, it)
+	}
+	if len(items) != 2 {
+		t.Fatalf("pageToJSON() returned %d items, want 2", len(items))
+	}
+	if items[0].Hash != newer.Hash.String() || items[1].Hash != older.Hash.String() {
+		t.Errorf("pageToJSON() items are not sorted by date: %s, %s", items[0].Hash, items[1].Hash)
+	}
+	if items[0].Type != "item" || items[0].IRI != "https://example.com/objects/newer" || items[0].Title != "Newer" {
+		t.Errorf("pageToJSON() invalid item %+v", items[0])
+	}
+	if items[1].Author == nil || items[1].Author.Handle != "jdoe" {
+		t.Errorf("pageToJSON() item is missing its author %+v", items[1])
+	}
+	children := items[1].Children
+	if len(children) != 2 || children[0].Hash != reply.Hash.String() || children[1].Hash != deleted.Hash.String() {
+		t.Fatalf("pageToJSON() invalid children %+v", children)
+	}
+	if children[0].Parent != older.Hash.String() {
+		t.Errorf("pageToJSON() reply is missing its parent %+v", children[0])
+	}
+	if !children[1].Deleted || children[1].Title != "" {
+		t.Errorf("pageToJSON() deleted item shows its content %+v", children[1])
+	}
+
+	if _, ok := pageToJSON(&loginModel{}, logFn); ok {
+		t.Errorf("pageToJSON() returned a JSON representation for a model other than a listing or a content page")
+	}
+}
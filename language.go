@@ -0,0 +1,345 @@
+package brutalinks
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// ContentLanguage is a language that can be chosen for submissions, or as a reading preference
+type ContentLanguage struct {
+	Code string
+	Name string
+}
+
+var contentLanguages = []ContentLanguage{
+	{Code: "ar", Name: "العربية"},
+	{Code: "de", Name: "Deutsch"},
+	{Code: "el", Name: "Ελληνικά"},
+	{Code: "en", Name: "English"},
+	{Code: "es", Name: "Español"},
+	{Code: "fr", Name: "Français"},
+	{Code: "he", Name: "עברית"},
+	{Code: "it", Name: "Italiano"},
+	{Code: "ja", Name: "日本語"},
+	{Code: "ko", Name: "한국어"},
+	{Code: "nl", Name: "Nederlands"},
+	{Code: "pl", Name: "Polski"},
+	{Code: "pt", Name: "Português"},
+	{Code: "ro", Name: "Română"},
+	{Code: "ru", Name: "Русский"},
+	{Code: "uk", Name: "Українська"},
+	{Code: "zh", Name: "中文"},
+}
+
+func validContentLanguage(code string) bool {
+	for _, l := range contentLanguages {
+		if l.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// LanguageName returns the name of the language with code, or the code if it's not one we know about
+func LanguageName(code string) string {
+	for _, l := range contentLanguages {
+		if l.Code == code {
+			return l.Name
+		}
+	}
+	return code
+}
+
+// ContentVariant is the title and content of an item in one of its other languages
+type ContentVariant struct {
+	Lang  string `json:"lang"`
+	Title string `json:"title,omitempty"`
+	Data  string `json:"data,omitempty"`
+}
+
+// Language returns the language of the item, or an empty string if it's not known
+func (i Item) Language() string {
+	if !i.HasMetadata() {
+		return ""
+	}
+	return i.Metadata.Lang
+}
+
+// languageCode returns the primary language subtag of ref, or an empty string for undetermined languages
+func languageCode(ref vocab.LangRef) string {
+	if !ref.Valid() {
+		return ""
+	}
+	code, _, _ := strings.Cut(strings.ToLower(ref.String()), "-")
+	return code
+}
+
+func itemLangRef(it Item) vocab.LangRef {
+	if lang := it.Language(); lang != "" {
+		return vocab.MakeRef([]byte(lang))
+	}
+	return vocab.DefaultLang
+}
+
+// primaryLangRef returns the language we load the title and content of an item from.
+// the natural language values are a map, so we need to pick the same language every time,
+// the default one if it's present, or the first in alphabetical order.
+func primaryLangRef(values vocab.NaturalLanguageValues) vocab.LangRef {
+	refs := make([]vocab.LangRef, 0, len(values))
+	for ref := range values {
+		if ref == vocab.DefaultLang {
+			return ref
+		}
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].String() < refs[j].String()
+	})
+	if len(refs) == 0 {
+		return vocab.NilLangRef
+	}
+	return refs[0]
+}
+
+// loadLanguageVariants sets the language of the item from the content of the a object, or from its name when
+// it has no content, and keeps the values in every other language as variants of the item.
+func loadLanguageVariants(i *Item, a *vocab.Object) {
+	values := a.Content
+	if len(values) == 0 {
+		values = a.Name
+	}
+	if len(values) == 0 {
+		return
+	}
+	primary := primaryLangRef(values)
+	i.Metadata.Lang = languageCode(primary)
+	if len(a.Content) < 2 && len(a.Name) < 2 {
+		return
+	}
+
+	if t := a.Name.Get(primary); len(t) > 0 {
+		i.Title = t.String()
+	}
+	if c := a.Content.Get(primary); len(c) > 0 {
+		i.Data = c.String()
+	}
+	variants := make(map[string]ContentVariant)
+	load := func(values vocab.NaturalLanguageValues, setFn func(*ContentVariant, string)) {
+		for ref, val := range values {
+			code := languageCode(ref)
+			if code == "" || ref == primary || code == i.Metadata.Lang {
+				continue
+			}
+			v := variants[code]
+			v.Lang = code
+			setFn(&v, val.String())
+			variants[code] = v
+		}
+	}
+	load(a.Name, func(v *ContentVariant, s string) { v.Title = bluemonday.StrictPolicy().Sanitize(s) })
+	load(a.Content, func(v *ContentVariant, s string) { v.Data = LocalHTMLPolicy.Sanitize(s) })
+
+	i.Metadata.Variants = make([]ContentVariant, 0, len(variants))
+	for _, v := range variants {
+		i.Metadata.Variants = append(i.Metadata.Variants, v)
+	}
+	sort.Slice(i.Metadata.Variants, func(j, k int) bool {
+		return i.Metadata.Variants[j].Lang < i.Metadata.Variants[k].Lang
+	})
+}
+
+// setLanguageVariants adds the title and content of the item in its other languages to the o object
+func setLanguageVariants(o *vocab.Object, it Item) {
+	if !it.HasMetadata() {
+		return
+	}
+	for _, v := range it.Metadata.Variants {
+		ref := vocab.MakeRef([]byte(v.Lang))
+		if v.Title != "" {
+			if o.Name == nil {
+				o.Name = make(vocab.NaturalLanguageValues)
+			}
+			_ = o.Name.Set(ref, vocab.Content(v.Title))
+		}
+		if v.Data != "" {
+			if o.Content == nil {
+				o.Content = make(vocab.NaturalLanguageValues)
+			}
+			_ = o.Content.Set(ref, vocab.Content(v.Data))
+		}
+	}
+}
+
+// languageFromRequest returns the language chosen in the submission form,
+// or the one detected from the title and the content of the item, when it's missing.
+func languageFromRequest(r *http.Request, it Item) string {
+	if lang := r.PostFormValue("lang"); validContentLanguage(lang) {
+		return lang
+	}
+	text := it.Title
+	if !it.IsLink() {
+		text += " " + it.Data
+	}
+	return detectLanguage(text)
+}
+
+// stopWords are the most frequent words of the languages written with the latin alphabet
+var stopWords = map[string][]string{
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "ich", "zu", "mit", "den", "auf", "sich", "es", "von", "für", "auch", "dem", "wir"},
+	"en": {"the", "and", "is", "of", "to", "that", "it", "for", "with", "was", "this", "are", "on", "you", "not", "have", "be", "what", "they", "from"},
+	"es": {"el", "los", "las", "y", "es", "que", "en", "una", "por", "con", "para", "no", "se", "del", "lo", "pero", "su", "como", "muy", "está"},
+	"fr": {"le", "les", "et", "est", "des", "une", "pas", "qui", "dans", "pour", "sur", "du", "au", "avec", "ce", "je", "vous", "il", "sont", "mais"},
+	"it": {"il", "che", "di", "e", "è", "per", "non", "sono", "gli", "della", "mi", "ma", "anche", "questo", "nel", "alla", "ho", "si", "una", "lo"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "dat", "ik", "je", "op", "te", "zijn", "met", "voor", "ook", "maar", "die", "wat", "er"},
+	"pl": {"i", "w", "nie", "na", "się", "jest", "to", "że", "do", "jak", "ale", "z", "co", "tak", "czy", "ja", "od", "po", "przez", "już"},
+	"pt": {"o", "os", "e", "é", "que", "um", "uma", "não", "para", "com", "do", "da", "em", "se", "por", "mais", "como", "mas", "foi", "ao"},
+	"ro": {"și", "este", "în", "nu", "că", "cu", "pe", "la", "un", "din", "pentru", "sunt", "care", "mai", "ce", "se", "de", "sau", "dar", "fost"},
+}
+
+// detectLanguage guesses the language of text from the alphabet it's written in, and for the latin alphabet,
+// from the frequent words it contains. It returns an empty string when it can't tell.
+func detectLanguage(text string) string {
+	text = bluemonday.StrictPolicy().Sanitize(text)
+	if lang := detectScript(text); lang != "" {
+		return lang
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	scores := make(map[string]int)
+	for _, w := range words {
+		for lang, sw := range stopWords {
+			if slices.Contains(sw, w) {
+				scores[lang]++
+			}
+		}
+	}
+	best, bestScore, tie := "", 0, false
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tie = lang, score, false
+		case score == bestScore:
+			tie = true
+		}
+	}
+	// a single frequent word is not enough, as many of them are shared between languages
+	if bestScore < 2 || tie {
+		return ""
+	}
+	return best
+}
+
+// detectScript returns the language of the text, if most of its letters are in an alphabet only used by one language
+func detectScript(text string) string {
+	var letters, latin, cyrillic, ukrainian, greek, arabic, hebrew, hangul, kana, han int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				ukrainian++
+			}
+		case unicode.Is(unicode.Greek, r):
+			greek++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.Is(unicode.Hebrew, r):
+			hebrew++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		}
+	}
+	if letters == 0 || latin*2 >= letters {
+		return ""
+	}
+	switch {
+	case cyrillic*2 > letters:
+		if ukrainian > 0 {
+			return "uk"
+		}
+		return "ru"
+	case greek*2 > letters:
+		return "el"
+	case arabic*2 > letters:
+		return "ar"
+	case hebrew*2 > letters:
+		return "he"
+	case hangul*2 > letters:
+		return "ko"
+	case kana > 0 && (kana+han)*2 > letters:
+		// Japanese text mixes kana with Han characters, Chinese doesn't use kana
+		return "ja"
+	case han*2 > letters:
+		return "zh"
+	}
+	return ""
+}
+
+// PrefersLanguage returns true if code is one of the languages the account chose to read
+func (s AccountSettings) PrefersLanguage(code string) bool {
+	return slices.Contains(s.Languages, code)
+}
+
+// languagesFromRequest returns the valid languages from the codes submitted in the settings form
+func languagesFromRequest(codes []string) []string {
+	languages := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if validContentLanguage(code) && !slices.Contains(languages, code) {
+			languages = append(languages, code)
+		}
+	}
+	return languages
+}
+
+// byLanguage moves the items in one of the languages before the others, keeping their order otherwise.
+// When hide is true the items in other languages are removed. Items without a known language are kept
+// together with the preferred ones, as we can't tell what language they're in.
+func byLanguage(list []Renderable, languages []string, hide bool) []Renderable {
+	if len(languages) == 0 {
+		return list
+	}
+	preferred := make([]Renderable, 0, len(list))
+	others := make([]Renderable, 0)
+	for _, r := range list {
+		it, ok := r.(*Item)
+		if !ok || it.Language() == "" || slices.Contains(languages, it.Language()) {
+			preferred = append(preferred, r)
+			continue
+		}
+		others = append(others, r)
+	}
+	if hide {
+		return preferred
+	}
+	return append(preferred, others...)
+}
+
+// LanguagePreferencesMw sets the listing to show first, or only, the items in the languages
+// the logged account prefers
+func LanguagePreferencesMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m := ContextListingModel(r.Context()); m != nil {
+			st := accountSettings(r, loggedAccount(r))
+			m.languages, m.hideOtherLanguages = st.Languages, st.HideOtherLanguages
+		}
+		next.ServeHTTP(w, r)
+	})
+}
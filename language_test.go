@@ -0,0 +1,91 @@
+package brutalinks
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "empty", text: "", want: ""},
+		{name: "english", text: "This is the story of a man that was looking for his keys", want: "en"},
+		{name: "german", text: "Das ist nicht das Ende, und ich bin auch nicht müde", want: "de"},
+		{name: "french", text: "Les enfants sont dans le jardin avec leur chien", want: "fr"},
+		{name: "romanian", text: "Nu este adevărat că vremea este frumoasă în Iași", want: "ro"},
+		{name: "russian", text: "Привет, как дела?", want: "ru"},
+		{name: "ukrainian", text: "Привіт, як справи? Їжак", want: "uk"},
+		{name: "greek", text: "Καλημέρα κόσμε", want: "el"},
+		{name: "japanese", text: "今日はいい天気ですね", want: "ja"},
+		{name: "chinese", text: "今天天气很好", want: "zh"},
+		{name: "html", text: "<p>The <strong>cat</strong> is on the table</p>", want: "en"},
+		{name: "too short", text: "Hello world", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage(tt.text); got != tt.want {
+				t.Errorf("detectLanguage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByLanguage(t *testing.T) {
+	en := &Item{Title: "en", Metadata: &ItemMetadata{Lang: "en"}}
+	fr := &Item{Title: "fr", Metadata: &ItemMetadata{Lang: "fr"}}
+	unknown := &Item{Title: "unknown"}
+	list := []Renderable{fr, unknown, en}
+
+	tests := []struct {
+		name      string
+		languages []string
+		hide      bool
+		want      []Renderable
+	}{
+		{name: "no preferences", want: []Renderable{fr, unknown, en}},
+		{name: "preferred first", languages: []string{"en"}, want: []Renderable{unknown, en, fr}},
+		{name: "hide others", languages: []string{"en"}, hide: true, want: []Renderable{unknown, en}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := byLanguage(list, tt.languages, tt.hide)
+			if len(got) != len(tt.want) {
+				t.Fatalf("byLanguage() returned %d items, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("byLanguage()[%d] = %v, want %v", i, got[i].(*Item).Title, tt.want[i].(*Item).Title)
+				}
+			}
+		})
+	}
+}
+
+func TestSortModelByLanguage(t *testing.T) {
+	now := time.Now()
+	en := &Item{Title: "en", SubmittedAt: now.Add(-time.Hour), Metadata: &ItemMetadata{Lang: "en"}}
+	fr := &Item{Title: "fr", SubmittedAt: now, Metadata: &ItemMetadata{Lang: "fr"}}
+	list := RenderableList{en, fr}
+
+	tests := []struct {
+		name  string
+		model Model
+		want  []Renderable
+	}{
+		{name: "listing without preferences", model: &listingModel{sortFn: ByDate}, want: []Renderable{fr, en}},
+		{name: "listing with preferred language", model: &listingModel{sortFn: ByDate, languages: []string{"en"}}, want: []Renderable{en, fr}},
+		{name: "listing hiding other languages", model: &listingModel{sortFn: ByDate, languages: []string{"en"}, hideOtherLanguages: true}, want: []Renderable{en}},
+		{name: "content", model: &contentModel{sortFn: ByDate}, want: []Renderable{fr, en}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sortModel(tt.model)(list); !slices.Equal(got, tt.want) {
+				t.Errorf("sortModel() returned %d items in the wrong order, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
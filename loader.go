@@ -15,6 +15,8 @@ var (
 	CursorCtxtKey        CtxtKey = "__cursor"
 	ContentCtxtKey       CtxtKey = "__content"
 	DependenciesCtxtKey  CtxtKey = "__deps"
+	FeedCtxtKey          CtxtKey = "__feed"
+	GroupCtxtKey         CtxtKey = "__group"
 )
 
 type WebInfo struct {
@@ -74,6 +76,13 @@ func ContextAuthors(ctx context.Context) AccountCollection {
 	return nil
 }
 
+func ContextGroup(ctx context.Context) *Group {
+	if g, ok := ctx.Value(GroupCtxtKey).(*Group); ok {
+		return g
+	}
+	return nil
+}
+
 func ContextCursor(ctx context.Context) *Cursor {
 	if c, ok := ctx.Value(CursorCtxtKey).(*Cursor); ok {
 		return c
@@ -0,0 +1,208 @@
+package brutalinks
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/brutalinks/internal/config"
+	log "git.sr.ht/~mariusor/lw"
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi/v5"
+)
+
+// mailer sends plain text emails through the SMTP server in the configuration
+type mailer struct {
+	addr string
+	auth smtp.Auth
+	from mail.Address
+}
+
+// mailerNew returns a mailer for the SMTP server in c, or nil if there's none configured
+func mailerNew(c *config.Configuration) *mailer {
+	if c == nil || !c.MailEnabled() {
+		return nil
+	}
+	m := &mailer{
+		addr: net.JoinHostPort(c.SMTPHost, strconv.Itoa(c.SMTPPort)),
+		from: mail.Address{Name: c.Name, Address: "noreply@" + c.HostName},
+	}
+	if c.SMTPUser != "" {
+		// PLAIN authentication refuses to send the credentials over unencrypted connections,
+		// unless the server is on localhost.
+		m.auth = smtp.PlainAuth("", c.SMTPUser, c.SMTPPassword, c.SMTPHost)
+	}
+	if from, err := mail.ParseAddress(c.MailFrom); err == nil {
+		m.from = *from
+	}
+	return m
+}
+
+// Send delivers an email with subject and body to the to address
+func (m *mailer) Send(to, subject, body string) error {
+	if m == nil {
+		return errors.NotImplementedf("email is not configured")
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return errors.NewBadRequest(err, "invalid email address %q", to)
+	}
+	msg, err := m.message(*rcpt, subject, body, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from.Address, []string{rcpt.Address}, msg)
+}
+
+// message returns the headers and the quoted-printable encoded body of the email
+func (m *mailer) message(to mail.Address, subject, body string, date time.Time) ([]byte, error) {
+	msg := bytes.Buffer{}
+	headers := [][2]string{
+		{"From", m.from.String()},
+		{"To", to.String()},
+		// the subject can't span multiple lines, or it could inject headers
+		{"Subject", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject), " "))},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"Message-ID", messageID(m.from.Address, date)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+func messageID(from string, date time.Time) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = from[i+1:]
+	}
+	r := make([]byte, 8)
+	_, _ = rand.Read(r)
+	return fmt.Sprintf("<%d.%s@%s>", date.Unix(), hex.EncodeToString(r), domain)
+}
+
+// validEmail returns the address part of email, or an error if it's not a valid email address
+func validEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return "", errors.NewBadRequest(err, "invalid email address %q", email)
+	}
+	return addr.Address, nil
+}
+
+const (
+	// EmailPasswordReset are the emails with the links for changing a forgotten password
+	EmailPasswordReset = "password-reset"
+	// EmailDigestReplies are the digests with the replies and mentions the account received
+	EmailDigestReplies = "digest-replies"
+	// EmailDigestThreads are the digests with the top threads of the instance
+	EmailDigestThreads = "digest-threads"
+)
+
+// EmailKinds are the kinds of emails an account can choose to receive
+var EmailKinds = []string{EmailPasswordReset, EmailDigestReplies, EmailDigestThreads}
+
+// ChoseEmail returns true if the account chose to receive the kind of emails
+func (s AccountSettings) ChoseEmail(kind string) bool {
+	return slices.Contains(s.Emails, kind)
+}
+
+// WantsEmail returns true if the account has a confirmed email address, and it chose to receive the kind of emails
+func (s AccountSettings) WantsEmail(kind string) bool {
+	return s.Email != "" && s.EmailConfirmed && s.ChoseEmail(kind)
+}
+
+// newEmailConfirmation marks the address in st as not confirmed, and returns the token for its confirmation link
+func newEmailConfirmation(st *AccountSettings) string {
+	token := randomToken()
+	st.EmailConfirmed = false
+	st.EmailConfirmation = tokenHash(token)
+	return token
+}
+
+// validEmailConfirmation checks token against the hash kept by newEmailConfirmation
+func (s AccountSettings) validEmailConfirmation(token string) bool {
+	if token == "" || s.Email == "" || s.EmailConfirmation == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(s.EmailConfirmation), []byte(tokenHash(token))) == 1
+}
+
+// SendEmailConfirmation emails the link for confirming the address in the settings of the a account
+func (r *repository) SendEmailConfirmation(a *Account, st AccountSettings, token string) error {
+	link := fmt.Sprintf("%s%s/confirm/%s", r.SelfURL, AccountLocalLink(a), token)
+	subject := fmt.Sprintf("Confirm your email address on %s", Instance.BaseURL.Host)
+	bodyFmt := "Hello %s,\n\nSomeone, hopefully you, added this email address to an account on %s.\n\n" +
+		"To start receiving emails from us, confirm the address by visiting the URL below: %s\n\n" +
+		"If you didn't ask for this, you can ignore this email and we won't send you any other."
+	body := fmt.Sprintf(bodyFmt, a.Handle, r.SelfURL, link)
+	return r.mail.Send(st.Email, subject, body)
+}
+
+// HandleEmailConfirmation serves the GET /~{handle}/confirm/{token} requests
+func (h *handler) HandleEmailConfirmation(w http.ResponseWriter, r *http.Request) {
+	authors := ContextAuthors(r.Context())
+	if len(authors) == 0 {
+		h.v.HandleErrors(w, r, errors.NotFoundf("account not found"))
+		return
+	}
+	acc := &authors[0]
+	token := chi.URLParam(r, "token")
+	confirmed := false
+	_, err := h.storage.settings.Update(acc, func(st *AccountSettings) bool {
+		if !st.validEmailConfirmation(token) {
+			return false
+		}
+		st.EmailConfirmed, st.EmailConfirmation = true, ""
+		confirmed = true
+		return true
+	})
+	if err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to confirm email address")
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	if !confirmed {
+		h.v.addFlashMessage(Error, w, r, "The email confirmation link is not valid.")
+		h.v.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	h.v.addFlashMessage(Success, w, r, "The email address has been confirmed.")
+	h.v.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// emailsFromRequest returns the valid kinds of emails from the ones submitted in the settings form
+func emailsFromRequest(kinds []string) []string {
+	emails := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		if slices.Contains(EmailKinds, k) && !slices.Contains(emails, k) {
+			emails = append(emails, k)
+		}
+	}
+	return emails
+}
@@ -0,0 +1,109 @@
+package brutalinks
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// smtpSink accepts one email on a local port, and sends the data it received on the returned channel
+func smtpSink(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to start SMTP sink: %s", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+		reply := func(s string) {
+			_, _ = rw.WriteString(s + "\r\n")
+			_ = rw.Flush()
+		}
+		reply("220 localhost ESMTP sink")
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 end data with <CR><LF>.<CR><LF>")
+				data := strings.Builder{}
+				for {
+					l, err := rw.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				received <- data.String()
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestMailerSend(t *testing.T) {
+	addr, received := smtpSink(t)
+	m := &mailer{addr: addr, from: mail.Address{Name: "Brutalinks", Address: "noreply@example.com"}}
+
+	subject := "Invitation to join\r\nBcc: someone@example.com"
+	body := "Hello,\n\nThis is an invitation to join, ăîș.\n"
+	if err := m.Send("Invitee <invitee@example.com>", subject, body); err != nil {
+		t.Fatalf("unable to send email: %s", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-received))
+	if err != nil {
+		t.Fatalf("invalid email received: %s", err)
+	}
+	if got := msg.Header.Get("To"); got != `"Invitee" <invitee@example.com>` {
+		t.Errorf("invalid To header %q", got)
+	}
+	if got := msg.Header.Get("Bcc"); got != "" {
+		t.Errorf("the subject injected a Bcc header %q", got)
+	}
+	dec := mime.WordDecoder{}
+	if got, _ := dec.DecodeHeader(msg.Header.Get("Subject")); got != "Invitation to join Bcc: someone@example.com" {
+		t.Errorf("invalid Subject header %q", got)
+	}
+	raw, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatalf("invalid body: %s", err)
+	}
+	if got := strings.ReplaceAll(string(raw), "\r\n", "\n"); got != body {
+		t.Errorf("invalid body %q, expected %q", got, body)
+	}
+}
+
+func TestMailerSendInvalidAddress(t *testing.T) {
+	m := &mailer{addr: "127.0.0.1:0", from: mail.Address{Address: "noreply@example.com"}}
+	if err := m.Send("invitee@example.com\r\nBcc: someone@example.com", "test", "test"); err == nil {
+		t.Errorf("expected an error for an invalid address")
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	log "git.sr.ht/~mariusor/lw"
 	vocab "github.com/go-ap/activitypub"
@@ -83,6 +85,61 @@ func LoadMw(next http.Handler) http.Handler {
 	})
 }
 
+// LoadTopMw loads the items of the top listing time window set up by TopWindowMw, ranks them all,
+// and keeps the current page.
+func LoadTopMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo := ContextRepository(r.Context())
+		checks := ContextActivityChecks(r.Context())
+		d := ContextDependentLoads(r.Context())
+		if d == nil {
+			d = &deps{}
+		}
+
+		c, err := repo.LoadSearches(r.Context(), *d, checks)
+		if err != nil {
+			ctxtErr(next, w, r, errors.NotFoundf("%s", strings.TrimLeft(r.URL.Path, "/")))
+			return
+		}
+		q := r.URL.Query()
+		c.items, c.before, c.after = pageRenderables(rankings[requestSort(r, SortTop)](c.items), q.Get(keyAfter), q.Get(keyBefore))
+		c.items = reparentRenderables(c.items)
+
+		if m := ContextListingModel(r.Context()); m != nil {
+			period := "all time"
+			if window := topWindow(r); window != "all" {
+				period = "the " + window
+			}
+			if m.Title == "" {
+				m.Title = htmlf("Top items of %s", period)
+			} else {
+				m.Title = htmlf("%s: top of %s", m.Title, period)
+			}
+		}
+		ctx := context.WithValue(r.Context(), CursorCtxtKey, &c)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// pageRenderables is pageIRIs for the ranked list, with pages of MaxContentItems
+func pageRenderables(ranked []Renderable, after, before string) (RenderableList, vocab.IRI, vocab.IRI) {
+	iris := make(vocab.IRIs, 0, len(ranked))
+	byIRI := make(map[vocab.IRI]Renderable, len(ranked))
+	for _, ren := range ranked {
+		if ren == nil || vocab.IsNil(ren.AP()) {
+			continue
+		}
+		iris = append(iris, ren.AP().GetLink())
+		byIRI[ren.AP().GetLink()] = ren
+	}
+	page, prev, next, _ := pageIRIs(iris, after, before, MaxContentItems)
+	items := make(RenderableList, 0, len(page))
+	for _, iri := range page {
+		items = append(items, byIRI[iri])
+	}
+	return items, prev, next
+}
+
 func LoadSingleItemMw(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
@@ -114,6 +171,10 @@ func LoadSingleItemMw(next http.Handler) http.Handler {
 				repo.errFn()("unable to load item votes")
 			}
 		}
+		if items, err = repo.loadItemsPolls(r.Context(), loggedAccount(r), items...); err != nil {
+			repo.errFn()("unable to load poll votes")
+		}
+		items = repo.loadItemsSensitive(r.Context(), items...)
 		c := Cursor{
 			items: make(RenderableList, 0),
 		}
@@ -275,17 +336,26 @@ func AddModelMw(next http.Handler) http.Handler {
 			m = new(contentModel)
 			m.Content = new(Item)
 		}
-		m.tpl = "new"
-		m.Message.ShowTitle = true
-		m.Title = "Add new submission"
-		m.Message.Editable = true
-		m.Message.Label = "Add new submission:"
-		m.Message.Back = "/"
-		m.Message.SubmitLabel = htmlf("%s Submit", icon("reply", "h-mirror", "v-mirror"))
+		submissionModel(m, r.URL.Query().Get("group"))
 		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, ModelCtxtKey, m)))
 	})
 }
 
+// submissionModel sets up m for the form adding a new submission, optionally to group
+func submissionModel(m *contentModel, group string) {
+	m.tpl = "new"
+	m.Message.ShowTitle = true
+	m.Title = "Add new submission"
+	m.Message.Editable = true
+	m.Message.Label = "Add new submission:"
+	m.Message.Back = "/"
+	m.Message.SubmitLabel = htmlf("%s Submit", icon("reply", "h-mirror", "v-mirror"))
+	if group != "" {
+		m.Message.Group = group
+		m.Title = htmlf("Add new submission to g/%s", template.HTMLEscapeString(group))
+	}
+}
+
 func reportModelFromCtx(ctx context.Context) *moderationModel {
 	if _, ok := ContextModel(ctx).(*errorModel); ok {
 		return nil
@@ -416,6 +486,7 @@ func MessageUserContentModelMw(next http.Handler) http.Handler {
 		m.Title = htmlf("Send user %s private message", auth.Handle)
 		m.Message.Editable = true
 		m.Message.Label = htmlf("Message %s:", auth.Handle)
+		m.Message.ShowRecipients = true
 		m.Message.Back = htmlf("%s", PermaLink(&auth))
 		m.Message.SubmitLabel = htmlf("%s Send", icon("lock"))
 		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, ModelCtxtKey, m)))
@@ -439,38 +510,77 @@ func OutOfOrderMw(v *view) func(next http.Handler) http.Handler {
 	}
 }
 
-func SortByScore(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer next.ServeHTTP(w, r)
+// SortBy sets the listing to be ordered by the ranking registered under name,
+// unless the request asks for a different one with the "sort" query parameter.
+func SortBy(name string) Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer next.ServeHTTP(w, r)
 
-		m := ContextListingModel(r.Context())
-		if m == nil {
-			return
-		}
-		m.sortFn = ByScore
-	})
+			if m := ContextListingModel(r.Context()); m != nil {
+				m.setSort(requestSort(r, name))
+				if c := ContextCursor(r.Context()); c != nil && c.ranked == m.sortName {
+					m.sortFn = keepOrder
+				}
+			}
+			if m := ContextContentModel(r.Context()); m != nil {
+				m.setSort(requestSort(r, name))
+			}
+		})
+	}
 }
 
-func SortByDate(next http.Handler) http.Handler {
+// SessionThreadSortKey is the session key for the ordering the reader chose for replies
+const SessionThreadSortKey = "__thread_sort"
+
+// SortThread orders the replies of an item, at every level, by the ranking the reader chose.
+// The choice is kept in the session, so it applies to the next threads they read.
+func (v *view) SortThread(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer next.ServeHTTP(w, r)
-		m := ContextListingModel(r.Context())
-		if m == nil {
-			return
+		if m := ContextContentModel(r.Context()); m != nil {
+			m.setSort(v.threadSort(w, r))
 		}
-		m.sortFn = ByDate
+		next.ServeHTTP(w, r)
 	})
 }
 
-func SortByRecentActivity(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer next.ServeHTTP(w, r)
+func (v *view) threadSort(w http.ResponseWriter, r *http.Request) string {
+	s, _ := v.s.get(w, r)
+	if name := r.URL.Query().Get("sort"); slices.Contains(threadSortOptions, name) {
+		if s != nil {
+			s.Values[SessionThreadSortKey] = name
+		}
+		return name
+	}
+	if s != nil {
+		if name, ok := s.Values[SessionThreadSortKey].(string); ok && slices.Contains(threadSortOptions, name) {
+			return name
+		}
+	}
+	return SortBest
+}
 
-		m := ContextListingModel(r.Context())
-		if m == nil {
-			return
+func requestSort(r *http.Request, def string) string {
+	if s := r.URL.Query().Get("sort"); s != "" {
+		if _, ok := rankings[s]; ok {
+			return s
 		}
-		m.sortFn = ByRecentActivity
+	}
+	return def
+}
+
+var (
+	SortByScore          = SortBy(SortHot)
+	SortByDate           = SortBy(SortNew)
+	SortByRecentActivity = SortBy(SortActive)
+	SortByTop            = SortBy(SortTop)
+	SortByControversy    = SortBy(SortControversial)
+)
+
+// SortByDefault orders the listing by the ranking set in the configuration
+func SortByDefault(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SortBy(Instance.Conf.DefaultSort)(next).ServeHTTP(w, r)
 	})
 }
 
@@ -480,6 +590,9 @@ type deps struct {
 	Replies     bool
 	Follows     bool
 	Moderations bool
+	// Window loads the items of a top listing, published after Since, if set
+	Window bool
+	Since  time.Time
 }
 
 func depsSetterFunc(r *http.Request, setterFn func(*deps)) (*deps, bool) {
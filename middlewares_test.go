@@ -0,0 +1,91 @@
+package brutalinks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+)
+
+func TestPageRenderables(t *testing.T) {
+	ranked := make([]Renderable, 0, MaxContentItems+5)
+	for i := 0; i < MaxContentItems+5; i++ {
+		iri := vocab.IRI(fmt.Sprintf("https://brutalinks.git/objects/%d", i))
+		ranked = append(ranked, &Item{Hash: Hash(uuid.New()), Pub: &vocab.Object{ID: iri}})
+	}
+	iri := func(i int) vocab.IRI {
+		return ranked[i].AP().GetLink()
+	}
+
+	first, prev, next := pageRenderables(ranked, "", "")
+	if len(first) != MaxContentItems || first[0] != ranked[0] || prev != "" || next != iri(MaxContentItems-1) {
+		t.Fatalf("pageRenderables() invalid first page: %d items, prev %q, next %q", len(first), prev, next)
+	}
+	last, prev, next := pageRenderables(ranked, IRIRef(next).String(), "")
+	if len(last) != 5 || last[0] != ranked[MaxContentItems] || prev != iri(MaxContentItems) || next != "" {
+		t.Errorf("pageRenderables() invalid last page: %d items, prev %q, next %q", len(last), prev, next)
+	}
+	back, _, _ := pageRenderables(ranked, "", IRIRef(iri(MaxContentItems)).String())
+	if len(back) != MaxContentItems || back[0] != ranked[0] {
+		t.Errorf("pageRenderables() invalid previous page: %d items", len(back))
+	}
+	if missing, _, _ := pageRenderables(ranked, "unknown", ""); len(missing) != 0 {
+		t.Errorf("pageRenderables() returned %d items for an unknown reference", len(missing))
+	}
+}
+
+func TestSortThread(t *testing.T) {
+	now := time.Now()
+	older := &Item{Hash: Hash(uuid.New()), SubmittedAt: now.Add(-time.Hour)}
+	newer := &Item{Hash: Hash(uuid.New()), SubmittedAt: now}
+
+	tests := []struct {
+		name        string
+		disabled    bool
+		query       string
+		session     string
+		want        string
+		wantSession string
+		wantOrder   []Renderable
+	}{
+		{name: "default", want: SortBest},
+		{name: "chosen", query: "?sort=new", want: SortNew, wantSession: SortNew, wantOrder: []Renderable{newer, older}},
+		{name: "not a thread ranking", query: "?sort=hot", want: SortBest},
+		{name: "remembered", session: SortOld, want: SortOld, wantSession: SortOld, wantOrder: []Renderable{older, newer}},
+		{name: "chosen over remembered", query: "?sort=controversial", session: SortOld, want: SortControversial, wantSession: SortControversial},
+		{name: "invalid remembered", session: "reddit", want: SortBest, wantSession: "reddit"},
+		{name: "no sessions", disabled: true, query: "?sort=old", want: SortOld},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+			v := &view{s: sess{enabled: !tt.disabled, name: "test", s: store}}
+
+			m := &contentModel{}
+			r := httptest.NewRequest(http.MethodGet, "/~jdoe/hash"+tt.query, nil)
+			r = r.WithContext(context.WithValue(r.Context(), ModelCtxtKey, m))
+			s, _ := store.Get(r, "test")
+			if tt.session != "" {
+				s.Values[SessionThreadSortKey] = tt.session
+			}
+
+			v.SortThread(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(httptest.NewRecorder(), r)
+			if m.SortName() != tt.want {
+				t.Errorf("SortThread() ranking = %q, want %q", m.SortName(), tt.want)
+			}
+			if got, _ := s.Values[SessionThreadSortKey].(string); !tt.disabled && got != tt.wantSession {
+				t.Errorf("SortThread() kept %q in the session, want %q", got, tt.wantSession)
+			}
+			if tt.wantOrder != nil && !slices.Equal(sortModel(m)(RenderableList{older, newer}), tt.wantOrder) {
+				t.Errorf("SortThread() did not order the replies by %q", tt.want)
+			}
+		})
+	}
+}
@@ -26,12 +26,18 @@ type listingModel struct {
 	Title        template.HTML
 	tpl          string
 	User         *Account
+	Group        *Group
 	ShowChildren bool
 	children     RenderableList
 	ShowText     bool
 	after        vocab.IRI
 	before       vocab.IRI
 	sortFn       func(list RenderableList) []Renderable
+	sortName     string
+	feeds        bool
+	// languages are the languages of the items shown first, or only when hideOtherLanguages is set
+	languages          []string
+	hideOtherLanguages bool
 }
 
 func (m listingModel) AP() vocab.Item {
@@ -89,7 +95,28 @@ func (m listingModel) Template() string {
 }
 
 func (m listingModel) Sorted() []Renderable {
-	return m.sortFn(m.children)
+	return sortModel(&m)(m.children)
+}
+
+func (m *listingModel) setSort(name string) {
+	m.sortName, m.sortFn = ranking(name)
+}
+
+// SortName returns the name of the ranking used for the listing
+func (m listingModel) SortName() string {
+	return m.sortName
+}
+
+func (m listingModel) SortOptions() []string {
+	return sortOptions
+}
+
+// SortWindows returns the time windows available for the top ranking
+func (m listingModel) SortWindows() []string {
+	if m.sortName != SortTop {
+		return nil
+	}
+	return []string{"day", "week", "month", "year", "all"}
 }
 
 type mBox struct {
@@ -103,6 +130,13 @@ type mBox struct {
 	Content     template.HTML
 	Back        template.HTML
 	SubmitLabel template.HTML
+
+	// ShowRecipients shows the field for the additional recipients of a private message
+	ShowRecipients bool
+	// Group is the name of the group a new submission is addressed to
+	Group string
+	// Warning is shown above the form, when the submission needs the user's attention
+	Warning template.HTML
 }
 
 type contentModel struct {
@@ -114,6 +148,25 @@ type contentModel struct {
 	Message      mBox
 	after        vocab.IRI
 	before       vocab.IRI
+	sortFn       func(list RenderableList) []Renderable
+	sortName     string
+}
+
+func (m *contentModel) setSort(name string) {
+	m.sortName, m.sortFn = ranking(name)
+}
+
+// SortName returns the name of the ranking used for the replies
+func (m contentModel) SortName() string {
+	return m.sortName
+}
+
+func (m contentModel) SortOptions() []string {
+	return threadSortOptions
+}
+
+func (m contentModel) SortWindows() []string {
+	return nil
 }
 
 func (m contentModel) ID() Hash {
@@ -285,9 +338,13 @@ func (*registerModel) SetCursor(c *Cursor) {}
 
 // Stats holds data for keeping compatibility with Mastodon instances
 type Stats struct {
-	DomainCount int  `json:"domain_count"`
-	UserCount   uint `json:"user_count"`
-	StatusCount uint `json:"status_count"`
+	DomainCount    int  `json:"domain_count"`
+	UserCount      uint `json:"user_count"`
+	ActiveMonth    uint `json:"active_month"`
+	ActiveHalfYear uint `json:"active_halfyear"`
+	PostCount      uint `json:"post_count"`
+	CommentCount   uint `json:"comment_count"`
+	StatusCount    uint `json:"status_count"`
 }
 
 // Desc holds data for keeping compatibility with Mastodon instances
@@ -340,9 +397,16 @@ func sortModel(m Model) func(list RenderableList) []Renderable {
 			return nil
 		}
 		var sortFn = ByDate
-		if lModel, ok := m.(*listingModel); ok && lModel.sortFn != nil {
+		if cModel, ok := m.(*contentModel); ok && cModel.sortFn != nil {
+			sortFn = cModel.sortFn
+		}
+		lModel, ok := m.(*listingModel)
+		if !ok {
+			return sortFn(list)
+		}
+		if lModel.sortFn != nil {
 			sortFn = lModel.sortFn
 		}
-		return sortFn(list)
+		return byLanguage(sortFn(list), lModel.languages, lModel.hideOtherLanguages)
 	}
 }
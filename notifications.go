@@ -0,0 +1,403 @@
+package brutalinks
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+)
+
+const (
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+	NotificationVote    = "vote"
+	NotificationFollow  = "follow"
+)
+
+const (
+	// notificationsWindow is how far back we look in the inbox for notifications
+	notificationsWindow = 90 * 24 * time.Hour
+	// notificationsMaxActivities is how many inbox activities we load, some of them don't result in a notification
+	notificationsMaxActivities = 4 * MaxContentItems
+)
+
+var notificationTypes = vocab.ActivityVocabularyTypes{vocab.CreateType, vocab.LikeType, vocab.DislikeType, vocab.FollowType}
+
+// Notification is an activity from another account, which concerns the account reading it
+type Notification struct {
+	Type  string
+	Actor *Account
+	// Item is the reply or the mentioning item, or the item that received the vote
+	Item      *Item
+	Weight    int
+	Published time.Time
+	Unread    bool
+}
+
+func (n Notification) IsReply() bool {
+	return n.Type == NotificationReply
+}
+
+func (n Notification) IsMention() bool {
+	return n.Type == NotificationMention
+}
+
+func (n Notification) IsVote() bool {
+	return n.Type == NotificationVote
+}
+
+func (n Notification) IsFollow() bool {
+	return n.Type == NotificationFollow
+}
+
+// mentionsAccount returns true if one of the mentions of the it item points to the a account
+func mentionsAccount(it Item, a *Account) bool {
+	if !it.HasMetadata() || a == nil {
+		return false
+	}
+	iris := make([]string, 0, 3)
+	if !vocab.IsNil(a.Pub) {
+		iris = append(iris, a.Pub.GetLink().String())
+	}
+	if a.HasMetadata() {
+		iris = append(iris, a.Metadata.ID, a.Metadata.URL)
+	}
+	for _, m := range it.Metadata.Mentions {
+		if m.URL != "" && stringInSlice(iris)(m.URL) {
+			return true
+		}
+		if m.Metadata != nil && m.Metadata.ID != "" && stringInSlice(iris)(m.Metadata.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationFromActivity returns the notification for an activity in the inbox of the a account.
+// The owned map holds the items of the account which the activities refer to, loaded by their IRI.
+func notificationFromActivity(act *vocab.Activity, a *Account, owned map[vocab.IRI]Item) (Notification, bool) {
+	n := Notification{Published: act.Published}
+	if act.Actor == nil || vocab.IsNil(act.Object) || (!vocab.IsNil(a.Pub) && act.Actor.GetLink().Equals(a.Pub.GetLink(), false)) {
+		// the activities of the account itself are not interesting
+		return n, false
+	}
+	switch act.Type {
+	case vocab.FollowType:
+		if vocab.IsNil(a.Pub) || !act.Object.GetLink().Equals(a.Pub.GetLink(), false) {
+			return n, false
+		}
+		n.Type = NotificationFollow
+	case vocab.LikeType, vocab.DislikeType:
+		it, ok := owned[act.Object.GetLink()]
+		if !ok {
+			return n, false
+		}
+		n.Type = NotificationVote
+		n.Item = &it
+		n.Weight = 1
+		if act.Type == vocab.DislikeType {
+			n.Weight = -1
+		}
+	case vocab.CreateType:
+		if act.Object.IsLink() {
+			return n, false
+		}
+		it := Item{}
+		if err := it.FromActivityPub(act); err != nil || !it.IsValid() || isPollAnswer(it) {
+			return n, false
+		}
+		n.Item = &it
+		switch {
+		case mentionsAccount(it, a):
+			n.Type = NotificationMention
+		case it.Parent != nil && !vocab.IsNil(it.Parent.AP()):
+			if _, ok := owned[it.Parent.AP().GetLink()]; !ok {
+				return n, false
+			}
+			n.Type = NotificationReply
+		default:
+			return n, false
+		}
+	default:
+		return n, false
+	}
+	if n.Published.IsZero() && n.Item != nil {
+		n.Published = n.Item.SubmittedAt
+	}
+	return n, true
+}
+
+// loadNotifications returns the notifications from the inbox of the a account, newest first.
+// Only the activities from the last notificationsWindow are loaded, and the ones published after readAt are marked as unread.
+func (r *repository) loadNotifications(ctx context.Context, a *Account, readAt time.Time) ([]Notification, error) {
+	if !a.IsLogged() || vocab.IsNil(a.Pub) {
+		return nil, errors.Unauthorizedf("invalid account")
+	}
+	res, err := r.b.SearchInCollection(
+		vocab.Inbox.Of(a.Pub).GetLink(),
+		filters.HasType(notificationTypes...),
+		publishedAfter(time.Now().Add(-notificationsWindow)),
+		filters.WithMaxCount(notificationsMaxActivities),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	activities := make([]*vocab.Activity, 0)
+	objects := make(vocab.IRIs, 0)
+	actors := make(vocab.IRIs, 0)
+	for _, li := range res {
+		it, ok := li.(vocab.Item)
+		if !ok || vocab.IsNil(it) || !notificationTypes.Match(it.GetType()) {
+			continue
+		}
+		_ = vocab.OnActivity(it, func(act *vocab.Activity) error {
+			if act.Actor == nil || vocab.IsNil(act.Object) {
+				return nil
+			}
+			activities = append(activities, act)
+			_ = actors.Append(act.Actor.GetLink())
+			if act.Type == vocab.CreateType {
+				_ = vocab.OnObject(act.Object, func(o *vocab.Object) error {
+					if o.InReplyTo != nil {
+						_ = objects.Append(o.InReplyTo.GetLink())
+					}
+					return nil
+				})
+			} else {
+				_ = objects.Append(act.Object.GetLink())
+			}
+			return nil
+		})
+	}
+
+	owned, err := r.loadAccountItems(a, objects)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := r.loadAccountsByIRI(actors)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := make([]Notification, 0, len(activities))
+	for _, act := range activities {
+		n, ok := notificationFromActivity(act, a, owned)
+		if !ok {
+			continue
+		}
+		if auth, ok := accounts[act.Actor.GetLink()]; ok {
+			n.Actor = &auth
+		} else {
+			n.Actor = &Account{Metadata: &AccountMetadata{}}
+			_ = n.Actor.FromActivityPub(act.Actor)
+		}
+		n.Unread = n.Published.After(readAt)
+		notifications = append(notifications, n)
+	}
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].Published.After(notifications[j].Published)
+	})
+	if len(notifications) > MaxContentItems {
+		notifications = notifications[:MaxContentItems]
+	}
+	return notifications, nil
+}
+
+// loadAccountItems returns the items with the iris that have been submitted by the a account
+func (r *repository) loadAccountItems(a *Account, iris vocab.IRIs) (map[vocab.IRI]Item, error) {
+	items := make(map[vocab.IRI]Item)
+	if len(iris) == 0 {
+		return items, nil
+	}
+	same := make(filters.Checks, 0, len(iris))
+	for _, iri := range iris {
+		same = append(same, filters.SameIRI(iri))
+	}
+	res, err := r.b.Search(
+		filters.HasType(ValidContentTypes...),
+		filters.SameAttributedTo(a.Pub.GetLink()),
+		filters.Any(same...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, li := range res {
+		ob, ok := li.(vocab.Item)
+		if !ok || vocab.IsNil(ob) {
+			continue
+		}
+		it := Item{}
+		if err := it.FromActivityPub(ob); err == nil {
+			items[ob.GetLink()] = it
+		}
+	}
+	return items, nil
+}
+
+// loadAccountsByIRI returns the accounts with the iris
+func (r *repository) loadAccountsByIRI(iris vocab.IRIs) (map[vocab.IRI]Account, error) {
+	accounts := make(map[vocab.IRI]Account)
+	if len(iris) == 0 {
+		return accounts, nil
+	}
+	same := make(filters.Checks, 0, len(iris))
+	for _, iri := range iris {
+		same = append(same, filters.SameIRI(iri))
+	}
+	res, err := r.b.Search(filters.HasType(ValidActorTypes...), filters.Any(same...))
+	if err != nil {
+		return nil, err
+	}
+	for _, li := range res {
+		ob, ok := li.(vocab.Item)
+		if !ok || vocab.IsNil(ob) {
+			continue
+		}
+		acc := Account{}
+		if err := acc.FromActivityPub(ob); err == nil {
+			accounts[ob.GetLink()] = acc
+		}
+	}
+	return accounts, nil
+}
+
+// unreadCountTTL is how long we keep the number of unread notifications of an account,
+// before loading them again from its inbox
+const unreadCountTTL = time.Minute
+
+type unreadCount struct {
+	count int
+	at    time.Time
+}
+
+// unreadCounts keeps the number of unread notifications of the accounts, so we don't need to load
+// their notifications for every page they request
+type unreadCounts struct {
+	m      sync.Mutex
+	counts map[Hash]unreadCount
+}
+
+func unreadCountsNew() *unreadCounts {
+	return &unreadCounts{counts: make(map[Hash]unreadCount)}
+}
+
+func (u *unreadCounts) Get(h Hash, now time.Time) (int, bool) {
+	if u == nil {
+		return 0, false
+	}
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	c, ok := u.counts[h]
+	if !ok || now.Sub(c.at) >= unreadCountTTL {
+		return 0, false
+	}
+	return c.count, true
+}
+
+// Set stores the count for the account with hash h, and drops the expired counts of the other accounts
+func (u *unreadCounts) Set(h Hash, count int, now time.Time) {
+	if u == nil {
+		return
+	}
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	for k, c := range u.counts {
+		if now.Sub(c.at) >= unreadCountTTL {
+			delete(u.counts, k)
+		}
+	}
+	u.counts[h] = unreadCount{count: count, at: now}
+}
+
+func (u *unreadCounts) Invalidate(h Hash) {
+	if u == nil {
+		return
+	}
+	u.m.Lock()
+	defer u.m.Unlock()
+	delete(u.counts, h)
+}
+
+// unreadNotifications returns the number of notifications of the a account it didn't read yet
+func unreadNotifications(r *http.Request, a *Account) int {
+	if !a.IsLogged() {
+		return 0
+	}
+	repo := ContextRepository(r.Context())
+	if repo == nil {
+		return 0
+	}
+	now := time.Now()
+	if count, ok := repo.unread.Get(a.Hash, now); ok {
+		return count
+	}
+	notifications, err := repo.loadNotifications(r.Context(), a, accountSettings(r, a).NotificationsReadAt)
+	if err != nil {
+		repo.errFn(log.Ctx{"err": err.Error(), "account": a.Handle})("unable to load notifications")
+		return 0
+	}
+	count := 0
+	for _, n := range notifications {
+		if n.Unread {
+			count++
+		}
+	}
+	repo.unread.Set(a.Hash, count, now)
+	return count
+}
+
+type notificationsModel struct {
+	Title         template.HTML
+	Notifications []Notification
+}
+
+func (m *notificationsModel) SetTitle(s string) {
+	m.Title = template.HTML(s)
+}
+
+func (notificationsModel) Template() string {
+	return "notifications"
+}
+
+func (*notificationsModel) SetCursor(c *Cursor) {}
+
+// NotificationsModelMw loads the notifications of the logged account
+func NotificationsModelMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acc := loggedAccount(r)
+		repo := ContextRepository(r.Context())
+		notifications, err := repo.loadNotifications(r.Context(), acc, accountSettings(r, acc).NotificationsReadAt)
+		if err != nil {
+			ctxtErr(next, w, r, err)
+			return
+		}
+		m := &notificationsModel{Title: "Notifications", Notifications: notifications}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ModelCtxtKey, m)))
+	})
+}
+
+// HandleNotificationsRead marks all the notifications of the logged account as read
+func (h *handler) HandleNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	_, err := h.storage.settings.Update(acc, func(st *AccountSettings) bool {
+		st.NotificationsReadAt = time.Now().UTC()
+		return true
+	})
+	if err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to save notifications state")
+		h.v.addFlashMessage(Error, w, r, "Unable to mark the notifications as read.")
+	}
+	h.storage.unread.Invalidate(acc.Hash)
+	h.v.Redirect(w, r, strings.TrimSuffix(r.URL.Path, "/"), http.StatusSeeOther)
+}
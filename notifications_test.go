@@ -0,0 +1,81 @@
+package brutalinks
+
+import (
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/uuid"
+)
+
+func TestNotificationFromActivity(t *testing.T) {
+	self := vocab.IRI("https://example.com/actors/jdoe")
+	other := vocab.IRI("https://example.com/actors/alice")
+	acc := &Account{Handle: "jdoe", Pub: &vocab.Actor{ID: self}, Metadata: &AccountMetadata{ID: self.String()}}
+
+	own := vocab.IRI("https://example.com/objects/6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	owned := map[vocab.IRI]Item{own: {Title: "own"}}
+	reply := func(parent vocab.IRI, tag vocab.ItemCollection) *vocab.Object {
+		return &vocab.Object{ID: "https://example.com/objects/6ba7b811-9dad-11d1-80b4-00c04fd430c8", Type: vocab.NoteType, Content: vocab.DefaultNaturalLanguage("reply"), InReplyTo: parent, Tag: tag}
+	}
+
+	tests := []struct {
+		name string
+		act  *vocab.Activity
+		want string
+		ok   bool
+	}{
+		{name: "follow", act: &vocab.Activity{Type: vocab.FollowType, Actor: other, Object: self}, want: NotificationFollow, ok: true},
+		{name: "follow someone else", act: &vocab.Activity{Type: vocab.FollowType, Actor: other, Object: other}},
+		{name: "like", act: &vocab.Activity{Type: vocab.LikeType, Actor: other, Object: own}, want: NotificationVote, ok: true},
+		{name: "like another item", act: &vocab.Activity{Type: vocab.LikeType, Actor: other, Object: vocab.IRI("https://example.com/objects/6ba7b812-9dad-11d1-80b4-00c04fd430c8")}},
+		{name: "own activity", act: &vocab.Activity{Type: vocab.LikeType, Actor: self, Object: own}},
+		{name: "reply", act: &vocab.Activity{Type: vocab.CreateType, Actor: other, Object: reply(own, nil)}, want: NotificationReply, ok: true},
+		{name: "reply to another item", act: &vocab.Activity{Type: vocab.CreateType, Actor: other, Object: reply("https://example.com/objects/6ba7b812-9dad-11d1-80b4-00c04fd430c8", nil)}},
+		{
+			name: "mention",
+			act: &vocab.Activity{Type: vocab.CreateType, Actor: other, Object: reply("https://example.com/objects/6ba7b812-9dad-11d1-80b4-00c04fd430c8", vocab.ItemCollection{
+				&vocab.Mention{Type: vocab.MentionType, Name: vocab.DefaultNaturalLanguage("@jdoe"), Href: self},
+			})},
+			want: NotificationMention,
+			ok:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := notificationFromActivity(tt.act, acc, owned)
+			if ok != tt.ok {
+				t.Fatalf("notificationFromActivity() ok = %t, want %t", ok, tt.ok)
+			}
+			if ok && got.Type != tt.want {
+				t.Errorf("notificationFromActivity() type = %s, want %s", got.Type, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnreadCounts(t *testing.T) {
+	now := time.Now()
+	jdoe := Hash(uuid.New())
+	alice := Hash(uuid.New())
+
+	u := unreadCountsNew()
+	if _, ok := u.Get(jdoe, now); ok {
+		t.Errorf("Get() found a count that was never set")
+	}
+	u.Set(jdoe, 3, now)
+	if got, ok := u.Get(jdoe, now.Add(time.Second)); !ok || got != 3 {
+		t.Errorf("Get() = %d, %t, want 3, true", got, ok)
+	}
+	if _, ok := u.Get(jdoe, now.Add(unreadCountTTL)); ok {
+		t.Errorf("Get() returned an expired count")
+	}
+	u.Set(alice, 1, now.Add(unreadCountTTL))
+	if _, ok := u.counts[jdoe]; ok {
+		t.Errorf("Set() didn't drop the expired count")
+	}
+	u.Invalidate(alice)
+	if _, ok := u.Get(alice, now.Add(unreadCountTTL)); ok {
+		t.Errorf("Get() returned an invalidated count")
+	}
+}
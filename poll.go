@@ -0,0 +1,400 @@
+package brutalinks
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+)
+
+const (
+	PollMinOptions = 2
+	PollMaxOptions = 10
+	// DefaultPollDuration is the time a poll accepts votes, when the author doesn't choose one
+	DefaultPollDuration = 24 * time.Hour
+	// PollMaxDuration is the longest time a poll can accept votes
+	PollMaxDuration = 30 * 24 * time.Hour
+)
+
+// PollOption is one of the answers of a poll, with the number of votes it received
+type PollOption struct {
+	Name  string `json:"name"`
+	Votes int    `json:"votes"`
+}
+
+// Poll holds the options of an item stored as an ActivityPub Question.
+// The votes are Note objects replying to the question, with their name set to the chosen option.
+type Poll struct {
+	Multiple bool         `json:"multiple,omitempty"`
+	Options  []PollOption `json:"options"`
+	EndTime  time.Time    `json:"endTime,omitempty"`
+	Closed   bool         `json:"closed,omitempty"`
+	Voters   int          `json:"voters"`
+	// Voted holds the options chosen by the current account
+	Voted []string `json:"-"`
+}
+
+// IsClosed returns true if the poll has been closed by its author, or its end time has passed
+func (p Poll) IsClosed() bool {
+	return p.Closed || (!p.EndTime.IsZero() && time.Now().After(p.EndTime))
+}
+
+func (p Poll) HasVoted() bool {
+	return len(p.Voted) > 0
+}
+
+func (p Poll) VotedFor(name string) bool {
+	return stringInSlice(p.Voted)(name)
+}
+
+// Total returns the number of votes for all the options
+func (p Poll) Total() int {
+	total := 0
+	for _, o := range p.Options {
+		total += o.Votes
+	}
+	return total
+}
+
+// Percent returns the share of the votes received by the o option
+func (p Poll) Percent(o PollOption) int {
+	total := p.Total()
+	if total == 0 {
+		return 0
+	}
+	return o.Votes * 100 / total
+}
+
+func (p Poll) hasOption(name string) bool {
+	for _, o := range p.Options {
+		if o.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// choices validates the options a voter picked
+func (p Poll) choices(names []string) ([]string, error) {
+	choices := make([]string, 0, len(names))
+	for _, n := range names {
+		if !p.hasOption(n) {
+			return nil, errors.BadRequestf("invalid option %q", n)
+		}
+		if !stringInSlice(choices)(n) {
+			choices = append(choices, n)
+		}
+	}
+	if len(choices) == 0 {
+		return nil, errors.BadRequestf("no option was chosen")
+	}
+	if !p.Multiple && len(choices) > 1 {
+		return nil, errors.BadRequestf("only one option can be chosen")
+	}
+	return choices, nil
+}
+
+// pollAnswer is a vote, as loaded from a Note reply to the poll
+type pollAnswer struct {
+	actor     vocab.IRI
+	name      string
+	published time.Time
+}
+
+// tally counts the answers received before the end of the poll.
+// For each voter we count every option only once, and only their first option when the poll is single choice.
+func (p *Poll) tally(answers []pollAnswer, voter vocab.IRI) {
+	sort.SliceStable(answers, func(i, j int) bool {
+		return answers[i].published.Before(answers[j].published)
+	})
+	counts := make(map[string]int)
+	voters := make(map[vocab.IRI][]string)
+	for _, a := range answers {
+		if !p.EndTime.IsZero() && a.published.After(p.EndTime) {
+			continue
+		}
+		if !p.hasOption(a.name) {
+			continue
+		}
+		chosen := voters[a.actor]
+		if stringInSlice(chosen)(a.name) || (!p.Multiple && len(chosen) > 0) {
+			continue
+		}
+		voters[a.actor] = append(chosen, a.name)
+		counts[a.name]++
+	}
+	for i, o := range p.Options {
+		p.Options[i].Votes = counts[o.Name]
+	}
+	p.Voters = len(voters)
+	p.Voted = voters[voter]
+}
+
+// countedPoll returns p with the answers counted.
+// The counts of remote polls come from their Question, as only the server of the poll has all the answers,
+// so for them we only mark the options voter has chosen.
+func countedPoll(p Poll, local bool, answers []pollAnswer, voter vocab.IRI) Poll {
+	counted := p
+	counted.Options = append([]PollOption{}, p.Options...)
+	counted.tally(answers, voter)
+	if local {
+		return counted
+	}
+	p.Voted = counted.Voted
+	return p
+}
+
+func pollOptionsFromActivityPub(it vocab.Item) []PollOption {
+	options := make([]PollOption, 0)
+	appendOption := func(it vocab.Item) error {
+		return vocab.OnObject(it, func(o *vocab.Object) error {
+			opt := PollOption{Name: o.Name.First().String()}
+			if opt.Name == "" {
+				return nil
+			}
+			if o.Replies != nil && !o.Replies.IsLink() {
+				_ = vocab.OnCollectionIntf(o.Replies, func(c vocab.CollectionInterface) error {
+					opt.Votes = int(c.Count())
+					return nil
+				})
+			}
+			options = append(options, opt)
+			return nil
+		})
+	}
+	if it.IsCollection() {
+		_ = vocab.OnCollectionIntf(it, func(c vocab.CollectionInterface) error {
+			for _, o := range c.Collection() {
+				_ = appendOption(o)
+			}
+			return nil
+		})
+	} else {
+		_ = appendOption(it)
+	}
+	return options
+}
+
+func (p *Poll) FromActivityPub(q *vocab.Question) error {
+	if q == nil {
+		return errors.Newf("nil question received")
+	}
+	switch {
+	case q.AnyOf != nil:
+		p.Multiple = true
+		p.Options = pollOptionsFromActivityPub(q.AnyOf)
+	case q.OneOf != nil:
+		p.Options = pollOptionsFromActivityPub(q.OneOf)
+	}
+	p.EndTime = q.EndTime
+	p.Closed = q.Closed
+	return nil
+}
+
+// AP returns the Question holding the properties of the ob object, and the poll options.
+func (p Poll) AP(ob *vocab.Object) *vocab.Question {
+	q := new(vocab.Question)
+	// Question starts with the same properties as Object, so we can load them in place
+	_ = vocab.OnObject(q, func(o *vocab.Object) error {
+		*o = *ob
+		return nil
+	})
+	q.Type = vocab.QuestionType
+	options := make(vocab.ItemCollection, 0, len(p.Options))
+	for _, o := range p.Options {
+		options = append(options, &vocab.Object{
+			Type:    vocab.NoteType,
+			Name:    vocab.DefaultNaturalLanguage(o.Name),
+			Replies: &vocab.Collection{Type: vocab.CollectionType, TotalItems: uint(o.Votes)},
+		})
+	}
+	if p.Multiple {
+		q.AnyOf = options
+	} else {
+		q.OneOf = options
+	}
+	q.EndTime = p.EndTime
+	q.Closed = p.Closed
+	return q
+}
+
+// pollFromRequest loads the poll options from the submission form.
+// It returns nil if the submission is not a poll.
+func pollFromRequest(r *http.Request) (*Poll, error) {
+	multiple := r.PostFormValue("poll-multiple") != ""
+	options := make([]PollOption, 0)
+	names := make([]string, 0)
+	for _, o := range r.PostForm["poll-option"] {
+		if o = strings.TrimSpace(o); o == "" || stringInSlice(names)(o) {
+			continue
+		}
+		names = append(names, o)
+		options = append(options, PollOption{Name: o})
+	}
+	if len(options) == 0 {
+		return nil, nil
+	}
+	if len(options) < PollMinOptions || len(options) > PollMaxOptions {
+		return nil, errors.BadRequestf("a poll needs between %d and %d different options", PollMinOptions, PollMaxOptions)
+	}
+	dur, err := time.ParseDuration(r.PostFormValue("poll-duration"))
+	if err != nil || dur <= 0 {
+		dur = DefaultPollDuration
+	}
+	if dur > PollMaxDuration {
+		dur = PollMaxDuration
+	}
+	return &Poll{
+		Multiple: multiple,
+		Options:  options,
+		EndTime:  time.Now().UTC().Add(dur).Truncate(time.Second),
+	}, nil
+}
+
+// isPollAnswer returns true for the Note replies that only have a name, which are votes in the parent poll
+func isPollAnswer(it Item) bool {
+	return it.Parent != nil && it.Title != "" && it.Data == ""
+}
+
+// withoutPollAnswers removes the poll answers from items, as they are counted in their polls instead
+func withoutPollAnswers(items ItemCollection) ItemCollection {
+	result := make(ItemCollection, 0, len(items))
+	for _, it := range items {
+		if !isPollAnswer(it) {
+			result = append(result, it)
+		}
+	}
+	return result
+}
+
+func pollAnswersChecks(iri vocab.IRI) filters.Checks {
+	return filters.Checks{
+		filters.HasType(vocab.NoteType),
+		filters.SameInReplyTo(iri),
+		filters.Not(filters.NameEmpty),
+	}
+}
+
+// loadItemsPolls counts the votes of the polls in items, and marks the options voter has chosen
+func (r *repository) loadItemsPolls(ctx context.Context, voter *Account, items ...Item) (ItemCollection, error) {
+	var voterIRI vocab.IRI
+	if voter != nil && voter.IsLogged() && !vocab.IsNil(voter.Pub) {
+		voterIRI = voter.Pub.GetLink()
+	}
+	for k, it := range items {
+		if !it.HasMetadata() || it.Metadata.Poll == nil || vocab.IsNil(it.Pub) {
+			continue
+		}
+		res, err := r.b.Search(pollAnswersChecks(it.Pub.GetLink())...)
+		if err != nil {
+			return items, err
+		}
+		answers := make([]pollAnswer, 0, len(res))
+		for _, li := range res {
+			ob, ok := li.(vocab.Item)
+			if !ok || vocab.IsNil(ob) {
+				continue
+			}
+			_ = vocab.OnObject(ob, func(o *vocab.Object) error {
+				if o.AttributedTo == nil {
+					return nil
+				}
+				answers = append(answers, pollAnswer{
+					actor:     o.AttributedTo.GetLink(),
+					name:      o.Name.First().String(),
+					published: o.Published,
+				})
+				return nil
+			})
+		}
+		if len(answers) == 0 {
+			// for remote polls we don't have the answers, so we keep the counts from the Question
+			continue
+		}
+		poll := countedPoll(*it.Metadata.Poll, HostIsLocal(it.Pub.GetLink().String()), answers, voterIRI)
+		items[k].Metadata.Poll = &poll
+	}
+	return items, nil
+}
+
+// SavePollVote sends a Note addressed to the author of the poll, for every option the voter chose
+func (r *repository) SavePollVote(ctx context.Context, voter Account, it Item, choices []string) error {
+	if !accountValidForC2S(&voter) {
+		return errors.Unauthorizedf("invalid account %s", voter.Handle)
+	}
+	if vocab.IsNil(it.Pub) || !it.SubmittedBy.IsValid() {
+		return errors.NotFoundf("invalid poll")
+	}
+	author := r.loadAPPerson(voter).GetLink()
+	to := vocab.ItemCollection{GetID(it.SubmittedBy)}
+	for _, c := range choices {
+		act := &vocab.Activity{
+			Type:  vocab.CreateType,
+			Actor: author,
+			To:    to,
+			Object: &vocab.Object{
+				Type:         vocab.NoteType,
+				Name:         vocab.DefaultNaturalLanguage(c),
+				InReplyTo:    it.Pub.GetLink(),
+				AttributedTo: author,
+				To:           to,
+				Published:    time.Now().UTC(),
+			},
+		}
+		i, ob, err := r.ToOutbox(ctx, voter.Credentials(), act)
+		if err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "poll": it.Pub.GetLink()})("unable to save poll vote")
+			return err
+		}
+		r.cache.removeRelated(i, ob, act)
+	}
+	return nil
+}
+
+// HandlePollVote saves the options the logged account chose for the current poll
+func (h *handler) HandlePollVote(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	it := ContextItem(r.Context())
+	if !it.IsValid() || !it.HasMetadata() || it.Metadata.Poll == nil {
+		h.v.HandleErrors(w, r, errors.NotFoundf("poll not found"))
+		return
+	}
+	back := ItemPermaLink(it)
+
+	items, err := h.storage.loadItemsPolls(r.Context(), acc, *it)
+	if err != nil {
+		h.errFn(log.Ctx{"err": err.Error()})("unable to load poll votes")
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	poll := items[0].Metadata.Poll
+	if poll.IsClosed() {
+		h.v.addFlashMessage(Warning, w, r, "This poll is closed.")
+		h.v.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if poll.HasVoted() {
+		h.v.addFlashMessage(Warning, w, r, "You have already voted in this poll.")
+		h.v.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	_ = r.ParseForm()
+	choices, err := poll.choices(r.PostForm["choice"])
+	if err != nil {
+		h.v.addFlashMessage(Error, w, r, err.Error())
+		h.v.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err = h.storage.SavePollVote(r.Context(), *acc, items[0], choices); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.addFlashMessage(Success, w, r, "Your vote has been recorded.")
+	h.v.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,122 @@
+package brutalinks
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+)
+
+func TestPollTally(t *testing.T) {
+	now := time.Now().UTC()
+	answer := func(actor, name string, after time.Duration) pollAnswer {
+		return pollAnswer{actor: vocab.IRI(actor), name: name, published: now.Add(after)}
+	}
+	tests := []struct {
+		name       string
+		multiple   bool
+		answers    []pollAnswer
+		wantVotes  []int
+		wantVoters int
+		wantVoted  []string
+	}{
+		{
+			name:      "no answers",
+			wantVotes: []int{0, 0, 0},
+		},
+		{
+			name: "single choice keeps the first answer",
+			answers: []pollAnswer{
+				answer("https://example.com/~jane", "b", 2*time.Second),
+				answer("https://example.com/~jane", "a", time.Second),
+				answer("https://example.com/~john", "b", time.Second),
+			},
+			wantVotes:  []int{1, 1, 0},
+			wantVoters: 2,
+			wantVoted:  []string{"a"},
+		},
+		{
+			name:     "multiple choice",
+			multiple: true,
+			answers: []pollAnswer{
+				answer("https://example.com/~jane", "a", time.Second),
+				answer("https://example.com/~jane", "c", time.Second),
+				answer("https://example.com/~jane", "c", 2*time.Second),
+				answer("https://example.com/~john", "c", time.Second),
+			},
+			wantVotes:  []int{1, 0, 2},
+			wantVoters: 2,
+			wantVoted:  []string{"a", "c"},
+		},
+		{
+			name: "invalid and late answers",
+			answers: []pollAnswer{
+				answer("https://example.com/~jane", "d", time.Second),
+				answer("https://example.com/~john", "a", time.Hour),
+			},
+			wantVotes: []int{0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Poll{
+				Multiple: tt.multiple,
+				Options:  []PollOption{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+				EndTime:  now.Add(time.Minute),
+			}
+			p.tally(tt.answers, "https://example.com/~jane")
+			votes := make([]int, 0, len(p.Options))
+			for _, o := range p.Options {
+				votes = append(votes, o.Votes)
+			}
+			if !reflect.DeepEqual(votes, tt.wantVotes) {
+				t.Errorf("tally() votes = %v, want %v", votes, tt.wantVotes)
+			}
+			if p.Voters != tt.wantVoters {
+				t.Errorf("tally() voters = %d, want %d", p.Voters, tt.wantVoters)
+			}
+			if !reflect.DeepEqual(p.Voted, tt.wantVoted) {
+				t.Errorf("tally() voted = %v, want %v", p.Voted, tt.wantVoted)
+			}
+		})
+	}
+}
+
+func TestCountedPoll(t *testing.T) {
+	now := time.Now().UTC()
+	p := Poll{
+		Options: []PollOption{{Name: "a", Votes: 40}, {Name: "b", Votes: 2}},
+		EndTime: now.Add(time.Hour),
+		Voters:  42,
+	}
+	answers := []pollAnswer{{actor: "https://example.com/~jane", name: "b", published: now}}
+
+	local := countedPoll(p, true, answers, "https://example.com/~jane")
+	if local.Options[0].Votes != 0 || local.Options[1].Votes != 1 || local.Voters != 1 {
+		t.Errorf("countedPoll() = %v, want the local answers counted", local)
+	}
+	remote := countedPoll(p, false, answers, "https://example.com/~jane")
+	if remote.Options[0].Votes != 40 || remote.Options[1].Votes != 2 || remote.Voters != 42 {
+		t.Errorf("countedPoll() = %v, want the counts of the remote poll kept", remote)
+	}
+	if !remote.VotedFor("b") {
+		t.Errorf("countedPoll() didn't mark the option chosen by the voter of the remote poll")
+	}
+	if p.Options[0].Votes != 40 {
+		t.Errorf("countedPoll() changed the options of the poll it received")
+	}
+}
+
+func TestWithoutPollAnswers(t *testing.T) {
+	poll := &Item{Title: "Which one?", Metadata: &ItemMetadata{Poll: &Poll{Options: []PollOption{{Name: "a"}, {Name: "b"}}}}}
+	items := ItemCollection{
+		*poll,
+		{Title: "a", Parent: poll},
+		{Title: "Re: Which one?", Data: "the first one", Parent: poll},
+	}
+	got := withoutPollAnswers(items)
+	if len(got) != 2 || got[0].Title != poll.Title || got[1].Data != "the first one" {
+		t.Errorf("withoutPollAnswers() = %v, want the poll and the reply with content", got)
+	}
+}
@@ -0,0 +1,351 @@
+package brutalinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	xhtml "golang.org/x/net/html"
+)
+
+const (
+	// PreviewMaxSize is the maximum number of bytes we read from a linked page
+	PreviewMaxSize = 512 * 1024
+	// PreviewTimeout is the time we wait for a linked page to load
+	PreviewTimeout = 5 * time.Second
+	// PreviewRateLimit is the number of link previews an account can request in PreviewRateInterval
+	PreviewRateLimit    = 20
+	PreviewRateInterval = time.Minute
+)
+
+// LinkPreview holds the details we extract from the page a submitted link points to
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Canonical   string `json:"canonical,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+}
+
+func (p LinkPreview) IsValid() bool {
+	return p.Title != "" || p.Description != "" || p.Image != ""
+}
+
+// AP returns the preview as the ActivityPub object we store in the "preview" property of the link
+func (p LinkPreview) AP() vocab.Item {
+	o := vocab.Object{Type: vocab.PageType}
+	if p.Canonical != "" {
+		o.URL = vocab.IRI(p.Canonical)
+	}
+	if p.Title != "" {
+		o.Name = vocab.DefaultNaturalLanguage(p.Title)
+	}
+	if p.Description != "" {
+		o.Summary = vocab.DefaultNaturalLanguage(p.Description)
+	}
+	if p.Image != "" {
+		o.Image = vocab.IRI(p.Image)
+	}
+	if p.SiteName != "" {
+		o.Generator = &vocab.Object{Type: vocab.ServiceType, Name: vocab.DefaultNaturalLanguage(p.SiteName)}
+	}
+	return &o
+}
+
+func (p *LinkPreview) FromActivityPub(it vocab.Item) error {
+	if vocab.IsNil(it) {
+		return errors.Newf("nil preview received")
+	}
+	return vocab.OnObject(it, func(o *vocab.Object) error {
+		if o.URL != nil {
+			p.Canonical = o.URL.GetLink().String()
+		}
+		p.Title = o.Name.First().String()
+		p.Description = o.Summary.First().String()
+		if o.Image != nil {
+			p.Image = o.Image.GetLink().String()
+		}
+		if o.Generator != nil {
+			_ = vocab.OnObject(o.Generator, func(g *vocab.Object) error {
+				p.SiteName = g.Name.First().String()
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+type previewFetcher struct {
+	c       *http.Client
+	ua      string
+	maxSize int64
+}
+
+// errPreviewAddress is returned when a link resolves to an address on the local network
+var errPreviewAddress = errors.Forbiddenf("link points to a local address")
+
+// publicAddressOnly stops the connections to the loopback and private networks,
+// so submitted links can't be used to probe the services running next to us.
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return errPreviewAddress
+	}
+	return nil
+}
+
+func previewFetcherNew(ua string) *previewFetcher {
+	dialer := &net.Dialer{Timeout: PreviewTimeout, Control: publicAddressOnly}
+	return &previewFetcher{
+		c: &http.Client{
+			Timeout:   PreviewTimeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: PreviewTimeout},
+		},
+		ua:      ua,
+		maxSize: PreviewMaxSize,
+	}
+}
+
+// Fetch downloads the page at u and extracts its preview
+func (f *previewFetcher) Fetch(ctx context.Context, u string) (LinkPreview, error) {
+	p := LinkPreview{URL: u}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return p, errors.NewBadRequest(err, "invalid URL %q", u)
+	}
+	if pu.Scheme != "http" && pu.Scheme != "https" {
+		return p, errors.BadRequestf("unsupported URL scheme %q", pu.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, PreviewTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return p, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	if f.ua != "" {
+		req.Header.Set("User-Agent", f.ua)
+	}
+	res, err := f.c.Do(req)
+	if err != nil {
+		return p, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return p, errors.NotFoundf("unable to load %s: %s", u, res.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mt != "text/html" && mt != "application/xhtml+xml" {
+		return p, errors.NotValidf("unsupported content type %q", mt)
+	}
+	// after redirects, the relative URLs need to be resolved against the final location
+	parsePreview(io.LimitReader(res.Body, f.maxSize), res.Request.URL, &p)
+	return p, nil
+}
+
+// parsePreview loads the title, description, image and canonical URL of the page from its head.
+// The OpenGraph properties take precedence over the Twitter card ones, which take precedence over the HTML elements.
+func parsePreview(r io.Reader, base *url.URL, p *LinkPreview) {
+	props := make(map[string]string)
+	setProp := func(k, v string) {
+		if v = strings.TrimSpace(v); v == "" {
+			return
+		}
+		if _, ok := props[k]; !ok {
+			props[k] = v
+		}
+	}
+
+	z := xhtml.NewTokenizer(r)
+	inTitle := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			p.fill(props, base)
+			return
+		case xhtml.TextToken:
+			if inTitle {
+				setProp("title", string(z.Text()))
+			}
+		case xhtml.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "title" {
+				inTitle = false
+			}
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[strings.ToLower(string(k))] = string(v)
+			}
+			switch string(name) {
+			case "title":
+				inTitle = tt == xhtml.StartTagToken
+			case "meta":
+				key := attrs["property"]
+				if key == "" {
+					key = attrs["name"]
+				}
+				setProp(strings.ToLower(key), attrs["content"])
+			case "link":
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					if rel == "canonical" {
+						setProp("canonical", attrs["href"])
+					}
+				}
+			case "body":
+				// everything we're interested in is in the head of the document
+				p.fill(props, base)
+				return
+			}
+		}
+	}
+}
+
+func (p *LinkPreview) fill(props map[string]string, base *url.URL) {
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := props[k]; ok {
+				return v
+			}
+		}
+		return ""
+	}
+	resolve := func(v string) string {
+		if v == "" || base == nil {
+			return v
+		}
+		u, err := base.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return ""
+		}
+		return u.String()
+	}
+	p.Title = strings.Join(strings.Fields(first("og:title", "twitter:title", "title")), " ")
+	p.Description = strings.Join(strings.Fields(first("og:description", "twitter:description", "description")), " ")
+	p.Image = resolve(first("og:image", "og:image:url", "twitter:image", "twitter:image:src"))
+	p.SiteName = first("og:site_name")
+	if c := resolve(first("canonical", "og:url")); c != "" {
+		if canonical, err := CanonicalURL(c); err == nil {
+			p.Canonical = canonical
+		}
+	}
+}
+
+// HandleLinkPreview serves GET /submit/preview?url= requests, with the details of the linked page,
+// which are used to fill in the submission form.
+func (h *handler) HandleLinkPreview(w http.ResponseWriter, r *http.Request) {
+	u := strings.TrimSpace(r.URL.Query().Get("url"))
+	if detectMimeType(u) != MimeTypeURL {
+		h.writeJSONError(w, errors.BadRequestf("invalid URL %q", u))
+		return
+	}
+	p, err := h.preview.Fetch(r.Context(), u)
+	if err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "url": u})("unable to load link preview")
+		h.writeJSONError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", MimeTypeJSON+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+func (h *handler) writeJSONError(w http.ResponseWriter, err error) {
+	writeJSONStatus(w, errors.HttpStatus(err), err)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", MimeTypeJSON+"; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("%s", err)})
+}
+
+// JSONErrors is the ErrorHandler for the endpoints returning JSON
+func (h *handler) JSONErrors(w http.ResponseWriter, _ *http.Request, errs ...error) {
+	if len(errs) == 0 {
+		errs = append(errs, errors.Newf("unknown error"))
+	}
+	h.writeJSONError(w, errs[0])
+}
+
+// rateLimiter counts the requests for each key in consecutive windows of interval
+type rateLimiter struct {
+	m        sync.Mutex
+	limit    int
+	interval time.Duration
+	windows  map[string]rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func rateLimiterNew(limit int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, interval: interval, windows: make(map[string]rateWindow)}
+}
+
+// Allow counts a request for key, and returns false if key went over the limit in the current window
+func (l *rateLimiter) Allow(key string, now time.Time) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	win, ok := l.windows[key]
+	if !ok || now.Sub(win.start) >= l.interval {
+		if !ok {
+			l.expire(now)
+		}
+		win = rateWindow{start: now}
+	}
+	if win.count >= l.limit {
+		return false
+	}
+	win.count++
+	l.windows[key] = win
+	return true
+}
+
+// expire drops the windows that ended before now
+func (l *rateLimiter) expire(now time.Time) {
+	for k, win := range l.windows {
+		if now.Sub(win.start) >= l.interval {
+			delete(l.windows, k)
+		}
+	}
+}
+
+// PreviewRateLimitMw limits the number of link previews each account can request
+func (h *handler) PreviewRateLimitMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.limits != nil && !h.limits.Allow(loggedAccount(r).Hash.String(), time.Now()) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(PreviewRateInterval.Seconds())))
+			writeJSONStatus(w, http.StatusTooManyRequests, errors.Newf("too many link previews, please try again later"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,182 @@
+package brutalinks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const previewPage = `<!DOCTYPE html>
+<html><head>
+<title>  The HTML
+  title </title>
+<meta name="description" content="The HTML description">
+<meta property="og:title" content="The OpenGraph title">
+<meta name="twitter:description" content="The Twitter &amp; X description">
+<meta property="og:image" content="/img/cover.png">
+<meta property="og:site_name" content="Example">
+<link rel="canonical" href="https://www.example.com/article?utm_source=feed">
+</head><body><meta property="og:description" content="ignored"></body></html>`
+
+func TestPreviewFetcher_Fetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = fmt.Fprint(w, previewPage)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/article", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte{0x89, 'P', 'N', 'G'})
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, "<html><head><!--"+strings.Repeat("-", 2048)+"--><title>Too far</title></head></html>")
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f := &previewFetcher{c: srv.Client(), maxSize: 1024}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    LinkPreview
+		wantErr bool
+	}{
+		{
+			name: "page with metadata",
+			path: "/article",
+			want: LinkPreview{
+				Title:       "The OpenGraph title",
+				Description: "The Twitter & X description",
+				Image:       srv.URL + "/img/cover.png",
+				SiteName:    "Example",
+				Canonical:   "https://www.example.com/article",
+			},
+		},
+		{
+			name: "redirected page",
+			path: "/moved",
+			want: LinkPreview{
+				Title:       "The OpenGraph title",
+				Description: "The Twitter & X description",
+				Image:       srv.URL + "/img/cover.png",
+				SiteName:    "Example",
+				Canonical:   "https://www.example.com/article",
+			},
+		},
+		{
+			name: "page over the size limit",
+			path: "/huge",
+			want: LinkPreview{},
+		},
+		{
+			name:    "not a page",
+			path:    "/image.png",
+			wantErr: true,
+		},
+		{
+			name:    "not found",
+			path:    "/missing",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := srv.URL + tt.path
+			got, err := f.Fetch(context.Background(), u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch(%s) error = %v, wantErr %t", u, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			tt.want.URL = u
+			if got != tt.want {
+				t.Errorf("Fetch(%s) = %#v, want %#v", u, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviewFetcher_FetchLocalAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the local server should not have been reached")
+	}))
+	defer srv.Close()
+
+	if _, err := previewFetcherNew("test").Fetch(context.Background(), srv.URL); err == nil {
+		t.Errorf("Fetch(%s) expected error for a loopback address", srv.URL)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := rateLimiterNew(2, time.Minute)
+	steps := []struct {
+		key  string
+		at   time.Duration
+		want bool
+	}{
+		{key: "jdoe", want: true},
+		{key: "jdoe", at: time.Second, want: true},
+		{key: "jdoe", at: 2 * time.Second},
+		{key: "alice", at: 2 * time.Second, want: true},
+		{key: "jdoe", at: time.Minute, want: true},
+		{key: "jdoe", at: time.Minute + time.Second, want: true},
+		{key: "jdoe", at: time.Minute + 2*time.Second},
+		{key: "bob", at: 2 * time.Minute, want: true},
+	}
+	for i, s := range steps {
+		if got := l.Allow(s.key, now.Add(s.at)); got != s.want {
+			t.Errorf("step %d: Allow(%q) = %t, want %t", i, s.key, got, s.want)
+		}
+	}
+	if _, ok := l.windows["alice"]; ok {
+		t.Errorf("Allow() kept the expired window of %q", "alice")
+	}
+}
+
+func TestPreviewRouteLimits(t *testing.T) {
+	jdoe := &Account{Hash: Hash(uuid.New()), Handle: "jdoe", CreatedAt: time.Now()}
+	h := &handler{limits: rateLimiterNew(1, time.Minute)}
+	preview := h.ValidateLoggedIn(h.JSONErrors)(h.PreviewRateLimitMw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name    string
+		account *Account
+		want    int
+	}{
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "logged in", account: jdoe, want: http.StatusOK},
+		{name: "over the limit", account: jdoe, want: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/submit/preview?url=https://example.com", nil)
+			if tt.account != nil {
+				r = r.WithContext(context.WithValue(r.Context(), LoggedAccountCtxtKey, tt.account))
+			}
+			w := httptest.NewRecorder()
+			preview.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("GET /submit/preview status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code != http.StatusOK && !strings.HasPrefix(w.Header().Get("Content-Type"), MimeTypeJSON) {
+				t.Errorf("GET /submit/preview error is not JSON: %q", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
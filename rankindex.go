@@ -0,0 +1,261 @@
+package brutalinks
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+)
+
+// RankIndexSize is the number of top level items we keep ranked for the front page
+const RankIndexSize = 10 * MaxContentItems
+
+type rankedItem struct {
+	iri       vocab.IRI
+	published time.Time
+	votes     int64
+	score     float64
+}
+
+// rankIndex keeps the candidates for the front page ordered by their hot score, so requests
+// can page through them without loading and scoring all the items every time.
+type rankIndex struct {
+	m       sync.RWMutex
+	r       *repository
+	items   map[vocab.IRI]*rankedItem
+	order   []*rankedItem
+	touched chan vocab.IRI
+	stop    chan struct{}
+	stopped sync.Once
+}
+
+// rankIndexNew builds the ranking index, and keeps it up to date in the background until Stop is called.
+// The scores get recomputed, to account for the time decay, every interval.
+// If interval is not greater than zero, the index is disabled and it returns nil.
+func rankIndexNew(r *repository, interval time.Duration) *rankIndex {
+	if r == nil || interval <= 0 {
+		return nil
+	}
+	ri := &rankIndex{
+		r:       r,
+		items:   make(map[vocab.IRI]*rankedItem),
+		touched: make(chan vocab.IRI, MaxContentItems),
+		stop:    make(chan struct{}),
+	}
+	go ri.run(interval)
+	return ri
+}
+
+func rankCandidateChecks() filters.Checks {
+	return filters.Checks{
+		filters.Recipients(vocab.PublicNS),
+		filters.HasType(ValidContentTypes...),
+		filters.Not(filters.NameEmpty),
+		filters.NilInReplyTo,
+	}
+}
+
+func (ri *rankIndex) run(interval time.Duration) {
+	ri.rebuild()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case iri := <-ri.touched:
+			ri.update(iri)
+		case <-t.C:
+			ri.rebuild()
+		case <-ri.stop:
+			return
+		}
+	}
+}
+
+// Stop ends the background updates of the index
+func (ri *rankIndex) Stop() {
+	if ri == nil {
+		return
+	}
+	ri.stopped.Do(func() { close(ri.stop) })
+}
+
+// Touch schedules the item with iri to have its rank updated
+func (ri *rankIndex) Touch(iri vocab.IRI) {
+	if ri == nil || iri == "" {
+		return
+	}
+	select {
+	case ri.touched <- iri:
+	default:
+		// the worker is busy, the item will get picked up at the next rebuild
+	}
+}
+
+// load returns the top level items matching checks, with their votes
+func (ri *rankIndex) load(checks ...filters.Check) []*rankedItem {
+	res, err := ri.r.b.Search(append(rankCandidateChecks(), checks...)...)
+	if err != nil {
+		ri.r.errFn(log.Ctx{"err": err.Error()})("unable to load ranking candidates")
+		return nil
+	}
+	items := make(ItemCollection, 0, len(res))
+	for _, li := range res {
+		it, ok := li.(vocab.Item)
+		if !ok || vocab.IsNil(it) {
+			continue
+		}
+		i := Item{}
+		if err := i.FromActivityPub(it); err != nil || i.Deleted() {
+			continue
+		}
+		items = append(items, i)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	if items, err = ri.r.loadItemsVotes(context.Background(), items...); err != nil {
+		ri.r.errFn(log.Ctx{"err": err.Error()})("unable to load ranking candidates votes")
+	}
+	ranked := make([]*rankedItem, 0, len(items))
+	for _, it := range items {
+		iri := it.AP().GetLink()
+		ranked = append(ranked, &rankedItem{
+			iri:       iri,
+			published: it.SubmittedAt,
+			votes:     int64(it.Votes.Score()),
+		})
+	}
+	return ranked
+}
+
+// rebuild reloads the newest candidates and recomputes all the scores
+func (ri *rankIndex) rebuild() {
+	ranked := ri.load(filters.WithMaxCount(RankIndexSize))
+
+	items := make(map[vocab.IRI]*rankedItem, len(ranked))
+	for _, it := range ranked {
+		items[it.iri] = it
+	}
+	ri.m.Lock()
+	defer ri.m.Unlock()
+	ri.items = items
+	ri.reorder()
+}
+
+// update reloads the item with iri, and moves it to its new position, or removes it from the index
+// if it's not a candidate anymore.
+func (ri *rankIndex) update(iri vocab.IRI) {
+	ranked := ri.load(filters.SameIRI(iri))
+
+	ri.m.Lock()
+	defer ri.m.Unlock()
+	delete(ri.items, iri)
+	for _, it := range ranked {
+		ri.items[it.iri] = it
+	}
+	ri.reorder()
+}
+
+func (ri *rankIndex) reorder() {
+	now := time.Now()
+	order := make([]*rankedItem, 0, len(ri.items))
+	for _, it := range ri.items {
+		it.score = Hacker(it.votes, now.Sub(it.published))
+		order = append(order, it)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].score != order[j].score {
+			return order[i].score > order[j].score
+		}
+		return order[i].published.After(order[j].published)
+	})
+	ri.order = order
+}
+
+// Page pages through the ranked items with pageIRIs
+func (ri *rankIndex) Page(after, before string, count int) (vocab.IRIs, vocab.IRI, vocab.IRI, bool) {
+	if ri == nil {
+		return nil, "", "", false
+	}
+	ri.m.RLock()
+	defer ri.m.RUnlock()
+
+	if len(ri.order) == 0 {
+		return nil, "", "", false
+	}
+	iris := make(vocab.IRIs, 0, len(ri.order))
+	for _, it := range ri.order {
+		iris = append(iris, it.iri)
+	}
+	return pageIRIs(iris, after, before, count)
+}
+
+// inIRIsOrder returns the items in the order of their IRIs in iris
+func inIRIsOrder(items RenderableList, iris vocab.IRIs) RenderableList {
+	position := make(map[vocab.IRI]int, len(iris))
+	for i, iri := range iris {
+		position[iri] = i
+	}
+	positionOf := func(ren Renderable) int {
+		if ren == nil || vocab.IsNil(ren.AP()) {
+			return len(iris)
+		}
+		if i, ok := position[ren.AP().GetLink()]; ok {
+			return i
+		}
+		return len(iris)
+	}
+	ordered := make(RenderableList, len(items))
+	copy(ordered, items)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return positionOf(ordered[i]) < positionOf(ordered[j])
+	})
+	return ordered
+}
+
+// LoadRankedMw loads the current page of the front page from the ranking index.
+// When the index is not available, or the request asks for a different ordering, it falls back to LoadMw.
+func LoadRankedMw(next http.Handler) http.Handler {
+	fallback := LoadMw(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		for k := range q {
+			if k != keyAfter && k != keyBefore && k != "sort" {
+				fallback.ServeHTTP(w, r)
+				return
+			}
+		}
+		if requestSort(r, Instance.Conf.DefaultSort) != SortHot {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		repo := ContextRepository(r.Context())
+		iris, prev, nxt, ok := repo.ranks.Page(q.Get(keyAfter), q.Get(keyBefore), MaxContentItems)
+		if !ok {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		d := ContextDependentLoads(r.Context())
+		if d == nil {
+			d = &deps{}
+		}
+		c, err := repo.loadIRIs(r.Context(), *d, iris)
+		if err != nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		c.after, c.before = nxt, prev
+		c.items = reparentRenderables(inIRIsOrder(c.items, iris))
+		c.ranked = SortHot
+
+		ctx := context.WithValue(r.Context(), CursorCtxtKey, &c)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
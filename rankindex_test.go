@@ -0,0 +1,144 @@
+package brutalinks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/uuid"
+)
+
+func TestPageIRIs(t *testing.T) {
+	iris := vocab.IRIs{
+		"https://example.com/objects/1",
+		"https://example.com/objects/2",
+		"https://example.com/objects/3",
+		"https://example.com/objects/4",
+		"https://example.com/objects/5",
+	}
+	ref := func(i int) string {
+		return IRIRef(iris[i]).String()
+	}
+	tests := []struct {
+		name          string
+		after, before string
+		want          vocab.IRIs
+		prev, next    vocab.IRI
+		ok            bool
+	}{
+		{
+			name: "first page",
+			want: iris[0:2],
+			next: iris[1],
+			ok:   true,
+		},
+		{
+			name:  "after",
+			after: ref(1),
+			want:  iris[2:4],
+			prev:  iris[2],
+			next:  iris[3],
+			ok:    true,
+		},
+		{
+			name:  "last page",
+			after: ref(3),
+			want:  iris[4:],
+			prev:  iris[4],
+			ok:    true,
+		},
+		{
+			name:   "before",
+			before: ref(2),
+			want:   iris[0:2],
+			next:   iris[1],
+			ok:     true,
+		},
+		{
+			name:  "unknown reference",
+			after: "unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, prev, next, ok := pageIRIs(iris, tt.after, tt.before, 2)
+			if ok != tt.ok {
+				t.Fatalf("pageIRIs() ok = %t, want %t", ok, tt.ok)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pageIRIs() = %v, want %v", got, tt.want)
+			}
+			if prev != tt.prev || next != tt.next {
+				t.Errorf("pageIRIs() bounds = %q, %q, want %q, %q", prev, next, tt.prev, tt.next)
+			}
+		})
+	}
+}
+
+func TestInIRIsOrder(t *testing.T) {
+	item := func(iri vocab.IRI) *Item {
+		return &Item{Hash: Hash(uuid.New()), Pub: &vocab.Object{ID: iri}}
+	}
+	first, second, third := item("https://example.com/objects/1"), item("https://example.com/objects/2"), item("https://example.com/objects/3")
+	iris := vocab.IRIs{second.AP().GetLink(), third.AP().GetLink(), first.AP().GetLink()}
+
+	got := inIRIsOrder(RenderableList{first, second, third}, iris)
+	if len(got) != 3 || got[0] != second || got[1] != third || got[2] != first {
+		t.Errorf("inIRIsOrder() did not keep the order of the index")
+	}
+}
+
+func TestSortByKeepsRankedOrder(t *testing.T) {
+	now := time.Now()
+	older := &Item{Hash: Hash(uuid.New()), SubmittedAt: now.Add(-time.Hour)}
+	newer := &Item{Hash: Hash(uuid.New()), SubmittedAt: now}
+
+	tests := []struct {
+		name   string
+		ranked string
+		sort   string
+		want   []Renderable
+	}{
+		{name: "ranked by the index", ranked: SortHot, sort: SortHot, want: []Renderable{older, newer}},
+		{name: "other ranking", ranked: SortHot, sort: SortNew, want: []Renderable{newer, older}},
+		{name: "not ranked", sort: SortNew, want: []Renderable{newer, older}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &listingModel{}
+			c := &Cursor{items: RenderableList{older, newer}, ranked: tt.ranked}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			ctx := context.WithValue(r.Context(), ModelCtxtKey, m)
+			r = r.WithContext(context.WithValue(ctx, CursorCtxtKey, c))
+
+			SortBy(tt.sort)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(httptest.NewRecorder(), r)
+			if got := m.sortFn(c.items); !slices.Equal(got, tt.want) {
+				t.Errorf("SortBy(%q) changed the order of the items", tt.sort)
+			}
+		})
+	}
+}
+
+func TestRankIndexStop(t *testing.T) {
+	ri := &rankIndex{stop: make(chan struct{})}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ri.Stop()
+		}()
+	}
+	wg.Wait()
+	select {
+	case <-ri.stop:
+	default:
+		t.Errorf("rankIndex.Stop() did not close the stop channel")
+	}
+	(*rankIndex)(nil).Stop()
+}
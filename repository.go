@@ -24,15 +24,27 @@ import (
 )
 
 type repository struct {
-	SelfURL string
-	b       *box.Client
-	cred    *credentials.C2S
-	cache   *cc
-	app     *Account
-	fedbox  *fedbox
-	modTags TagCollection
-	infoFn  CtxLogFn
-	errFn   CtxLogFn
+	SelfURL   string
+	b         *box.Client
+	cred      *credentials.C2S
+	cache     *cc
+	app       *Account
+	fedbox    *fedbox
+	modTags   TagCollection
+	ranks     *rankIndex
+	search    *searchIndex
+	settings  *settingsStore
+	revisions *revisionStore
+	sensitive *sensitiveStore
+	unread    *unreadCounts
+	mail      *mailer
+	digests   *digestSender
+	relay     *groupRelay
+	webhooks  *webhookStore
+	groups    *groupStore
+	hooks     *webhookDispatcher
+	infoFn    CtxLogFn
+	errFn     CtxLogFn
 }
 
 func (r *repository) BaseURL() vocab.IRI {
@@ -40,6 +52,10 @@ func (r *repository) BaseURL() vocab.IRI {
 }
 
 func (r *repository) Close() error {
+	r.ranks.Stop()
+	r.digests.Stop()
+	r.relay.Stop()
+	r.hooks.Stop()
 	return r.b.Close()
 }
 
@@ -80,6 +96,9 @@ func ActivityPubService(c appConfig) (*repository, error) {
 		infoFn:  infoFn,
 		errFn:   errFn,
 		cache:   caches(c.CachingEnabled),
+		search:  searchIndexNew(c.SearchIndexSize),
+		unread:  unreadCountsNew(),
+		mail:    mailerNew(c.Configuration),
 	}
 
 	storeFn := box.UseXDGPaths(c.HostName)
@@ -97,6 +116,12 @@ func ActivityPubService(c appConfig) (*repository, error) {
 		return repo, err
 	}
 	c.Logger.WithContext(log.Ctx{"path": repo.b.StoragePath()}).Infof("BOX storage opened")
+	repo.settings = settingsStoreNew(repo.b.StoragePath())
+	repo.revisions = revisionStoreNew(repo.b.StoragePath())
+	repo.sensitive = sensitiveStoreNew(repo.b.StoragePath(), ua)
+	repo.webhooks = webhookStoreNew(repo.b.StoragePath())
+	repo.groups = groupStoreNew(repo.b.StoragePath())
+	repo.hooks = webhookDispatcherNew(repo.webhooks, errFn)
 
 	if c.OAuth2App == "" {
 		return repo, fmt.Errorf("invalid OAuth2 application name %s", c.OAuth2App)
@@ -130,6 +155,8 @@ func ActivityPubService(c appConfig) (*repository, error) {
 		return repo, fmt.Errorf("invalid authorized Actor: %s", cred.IRI)
 	}
 
+	go repo.search.backfill(repo)
+
 	go func() {
 		// NOTE(marius): this is the new BrutaLinks long polling mechanism that fetches
 		// the relevant collections for the instance actor every minute.
@@ -297,6 +324,71 @@ func appendReplies(parent vocab.Item) (vocab.ItemCollection, error) {
 	return repl, err
 }
 
+// announcedObject returns the object of the it Announce activity
+func announcedObject(it vocab.Item) vocab.Item {
+	var ob vocab.Item
+	_ = vocab.OnActivity(it, func(a *vocab.Activity) error {
+		ob = a.Object
+		return nil
+	})
+	return ob
+}
+
+// announcingActors returns the IRIs of the actors of the Announce activities in results
+func announcingActors(results vocab.ItemCollection) vocab.IRIs {
+	actors := make(vocab.IRIs, 0)
+	for _, it := range results {
+		if vocab.IsNil(it) || it.GetType() != vocab.AnnounceType {
+			continue
+		}
+		_ = vocab.OnActivity(it, func(a *vocab.Activity) error {
+			if a.Actor != nil {
+				_ = actors.Append(a.Actor.GetLink())
+			}
+			return nil
+		})
+	}
+	return actors
+}
+
+// groupAnnouncements returns the objects of the Announce activities in results which have a Group actor, by the IRI
+// of the announce. Every object is returned once, and not at all if results contain it, or a Create activity of it.
+func groupAnnouncements(results vocab.ItemCollection, groups vocab.IRIs) map[vocab.IRI]vocab.Item {
+	seen := make(map[vocab.IRI]struct{})
+	for _, it := range results {
+		if vocab.IsNil(it) || it.GetType() == vocab.AnnounceType {
+			continue
+		}
+		seen[it.GetLink()] = struct{}{}
+		if it.GetType() == vocab.CreateType {
+			if ob := announcedObject(it); !vocab.IsNil(ob) {
+				seen[ob.GetLink()] = struct{}{}
+			}
+		}
+	}
+	announced := make(map[vocab.IRI]vocab.Item)
+	for _, it := range results {
+		if vocab.IsNil(it) || it.GetType() != vocab.AnnounceType {
+			continue
+		}
+		_ = vocab.OnActivity(it, func(a *vocab.Activity) error {
+			if a.Actor == nil || vocab.IsNil(a.Object) {
+				return nil
+			}
+			if a.Actor.GetType() != vocab.GroupType && !groups.Contains(a.Actor.GetLink()) {
+				return nil
+			}
+			if _, ok := seen[a.Object.GetLink()]; ok {
+				return nil
+			}
+			seen[a.Object.GetLink()] = struct{}{}
+			announced[a.GetLink()] = a.Object
+			return nil
+		})
+	}
+	return announced
+}
+
 func loadFromParent(ob *vocab.Object, it vocab.Item) error {
 	if vocab.IsNil(it) || ob == nil {
 		return nil
@@ -309,6 +401,7 @@ func loadFromParent(ob *vocab.Object, it vocab.Item) error {
 		_ = appendRecipients(&ob.Bto, p.Bto)
 		_ = appendRecipients(&ob.CC, p.CC)
 		_ = appendRecipients(&ob.BCC, p.BCC)
+		_ = appendRecipients(&ob.Audience, p.Audience)
 		return nil
 	})
 
@@ -330,6 +423,9 @@ func (r *repository) loadAPItem(it vocab.Item, item Item) error {
 			} else {
 				o.URL = vocab.IRI(item.Data)
 			}
+			if item.HasMetadata() && item.Metadata.Preview != nil && item.Metadata.Preview.IsValid() {
+				o.Preview = item.Metadata.Preview.AP()
+			}
 		} else {
 			wordCount := strings.Count(item.Data, " ") +
 				strings.Count(item.Data, "\t") +
@@ -353,11 +449,11 @@ func (r *repository) loadAPItem(it vocab.Item, item Item) error {
 					if o.Source.Content == nil {
 						o.Source.Content = make(vocab.NaturalLanguageValues)
 					}
-					_ = o.Source.Content.Set(vocab.DefaultLang, vocab.Content(item.Data))
+					_ = o.Source.Content.Set(itemLangRef(item), vocab.Content(item.Data))
 					if o.Content == nil {
 						o.Content = make(vocab.NaturalLanguageValues)
 					}
-					_ = o.Content.Set(vocab.DefaultLang, vocab.Content(Markdown(item.Data)))
+					_ = o.Content.Set(itemLangRef(item), vocab.Content(Markdown(item.Data)))
 				}
 			case MimeTypeText:
 				fallthrough
@@ -366,10 +462,14 @@ func (r *repository) loadAPItem(it vocab.Item, item Item) error {
 				if o.Content == nil {
 					o.Content = make(vocab.NaturalLanguageValues)
 				}
-				_ = o.Content.Set(vocab.DefaultLang, vocab.Content(item.Data))
+				_ = o.Content.Set(itemLangRef(item), vocab.Content(item.Data))
 			}
 		}
 
+		if item.HasMetadata() && len(item.Metadata.Attachments) > 0 {
+			o.Attachment = item.Metadata.Attachments.AP()
+		}
+
 		o.Published = item.SubmittedAt
 		o.Updated = item.UpdatedAt
 
@@ -409,7 +509,11 @@ func (r *repository) loadAPItem(it vocab.Item, item Item) error {
 			if o.Name == nil {
 				o.Name = make(vocab.NaturalLanguageValues)
 			}
-			_ = o.Name.Set(vocab.DefaultLang, vocab.Content(item.Title))
+			_ = o.Name.Set(itemLangRef(item), vocab.Content(item.Title))
+		}
+		setLanguageVariants(o, item)
+		if item.HasMetadata() && item.Metadata.Sensitive && item.Metadata.ContentWarning != "" {
+			o.Summary = vocab.DefaultNaturalLanguage(item.Metadata.ContentWarning)
 		}
 		if item.SubmittedBy != nil {
 			o.AttributedTo = GetID(item.SubmittedBy)
@@ -677,7 +781,8 @@ func (r *repository) loadAccountsOutbox(ctx context.Context, acc *Account) error
 	}
 
 	ac := acc.AP()
-	validTypes := append(vocab.ActivityVocabularyTypes{vocab.LikeType}, vocab.CreateType, vocab.DeleteType)
+	validTypes := append(vocab.ActivityVocabularyTypes{vocab.LikeType}, vocab.CreateType, vocab.DeleteType,
+		vocab.AddType, vocab.RemoveType)
 	check := []filters.Check{
 		filters.HasType(validTypes...),
 		filters.SameAttributedTo(ac.GetLink()),
@@ -735,6 +840,31 @@ func (r *repository) loadAccountsOutbox(ctx context.Context, acc *Account) error
 	return nil
 }
 
+// maxReplyDepth is how deep we follow the replies which are not in reply to the top level item
+const maxReplyDepth = 10
+
+// remoteThreadReply returns true if the it reply is in reply to one of the threads IRIs
+func remoteThreadReply(it vocab.Item, threads vocab.IRIs) bool {
+	found := false
+	_ = vocab.OnObject(it, func(o *vocab.Object) error {
+		if vocab.IsNil(o.InReplyTo) {
+			return nil
+		}
+		if vocab.IsIRI(o.InReplyTo) {
+			found = threads.Contains(o.InReplyTo.GetLink())
+			return nil
+		}
+		_ = vocab.OnCollectionIntf(o.InReplyTo, func(col vocab.CollectionInterface) error {
+			for _, p := range col.Collection() {
+				found = found || threads.Contains(p.GetLink())
+			}
+			return nil
+		})
+		return nil
+	})
+	return found
+}
+
 func getRepliesOf(items ...Item) vocab.IRIs {
 	repliesTo := make(vocab.IRIs, 0)
 	iriFn := func(it Item) vocab.IRI {
@@ -765,26 +895,42 @@ func (r *repository) loadItemsReplies(ctx context.Context, items ...Item) (ItemC
 	if len(repliesTo) == 0 {
 		return nil, nil
 	}
-	inReplyTo := make([]filters.Check, 0, len(repliesTo))
-	for _, rr := range repliesTo {
-		inReplyTo = append(inReplyTo, filters.SameInReplyTo(rr.GetLink()))
+	// the local replies are in reply to the top level item too, the remote ones can be only in reply to their parent
+	remote := make(vocab.IRIs, 0)
+	for _, iri := range repliesTo {
+		if !HostIsLocal(iri.String()) {
+			remote = append(remote, iri)
+		}
 	}
-
 	allReplies := make(ItemCollection, 0)
-	checks := filters.All(
-		filters.HasType(ValidContentTypes...),
-		filters.Any(inReplyTo...),
-	)
+	for depth := 0; len(repliesTo) > 0 && depth < maxReplyDepth; depth++ {
+		inReplyTo := make([]filters.Check, 0, len(repliesTo))
+		for _, rr := range repliesTo {
+			inReplyTo = append(inReplyTo, filters.SameInReplyTo(rr.GetLink()))
+		}
+		checks := filters.All(
+			filters.HasType(ValidContentTypes...),
+			filters.Any(inReplyTo...),
+		)
 
-	repl, err := r.b.Search(checks)
-	if err != nil {
-		r.errFn()(err.Error())
-	}
-	for _, rr := range repl {
-		if it, ok := rr.(vocab.Item); ok {
+		repl, err := r.b.Search(checks)
+		if err != nil {
+			r.errFn()(err.Error())
+		}
+		repliesTo = make(vocab.IRIs, 0)
+		for _, rr := range repl {
+			it, ok := rr.(vocab.Item)
+			if !ok {
+				continue
+			}
 			ob := Item{}
-			if err := ob.FromActivityPub(it); err == nil {
-				allReplies = append(allReplies, ob)
+			if err := ob.FromActivityPub(it); err != nil || isPollAnswer(ob) || allReplies.Contains(ob) {
+				continue
+			}
+			allReplies = append(allReplies, ob)
+			if remoteThreadReply(it, remote) {
+				_ = remote.Append(it.GetLink())
+				_ = repliesTo.Append(it.GetLink())
 			}
 		}
 	}
@@ -792,6 +938,69 @@ func (r *repository) loadItemsReplies(ctx context.Context, items ...Item) (ItemC
 	return allReplies, nil
 }
 
+// withoutUndoneVotes removes the undo votes from votes, together with the votes they undo.
+// A vote is undone only by an Undo of the same actor.
+func withoutUndoneVotes(votes VoteCollection) VoteCollection {
+	undone := make(map[string][]*Account)
+	for _, v := range votes {
+		if v.HasMetadata() && v.Metadata.OriginalIRI != "" && v.SubmittedBy != nil {
+			undone[v.Metadata.OriginalIRI] = append(undone[v.Metadata.OriginalIRI], v.SubmittedBy)
+		}
+	}
+	result := make(VoteCollection, 0, len(votes))
+	for _, v := range votes {
+		if !v.HasMetadata() {
+			result = append(result, v)
+			continue
+		}
+		if v.Metadata.OriginalIRI != "" {
+			continue
+		}
+		if undoneBy(undone[v.Metadata.IRI], v.SubmittedBy) {
+			continue
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// undoneBy returns true if the actor of a vote is one of the actors that undid it
+func undoneBy(undoers []*Account, voter *Account) bool {
+	if voter == nil {
+		return false
+	}
+	for _, undoer := range undoers {
+		if accountsEqual(*undoer, *voter) {
+			return true
+		}
+	}
+	return false
+}
+
+// validAnnouncedVote returns true if v was not announced, or if it was announced by one of the recipients
+// of the object it votes on, which is the group the thread was submitted to.
+func validAnnouncedVote(v Vote, items ItemCollection) bool {
+	if !v.HasMetadata() || v.Metadata.AnnouncedBy == "" {
+		return true
+	}
+	if v.Item == nil {
+		return false
+	}
+	announcer := vocab.IRI(v.Metadata.AnnouncedBy)
+	for _, it := range items {
+		if !itemsEqual(*v.Item, it) {
+			continue
+		}
+		addressed := false
+		_ = vocab.OnObject(it.AP(), func(ob *vocab.Object) error {
+			addressed = ob.Recipients().Contains(announcer)
+			return nil
+		})
+		return addressed
+	}
+	return false
+}
+
 func likesFilter(iris vocab.IRIs, types ...vocab.ActivityVocabularyType) filters.Check {
 	byIRIChecks := make(filters.Checks, 0, len(iris))
 
@@ -826,7 +1035,17 @@ func (r *repository) loadItemsVotes(ctx context.Context, items ...Item) (ItemCol
 		activeAppreciationTypes = ValidAppreciationTypes
 	}
 
-	searches := likesFilter(irisFromItems(items...), activeAppreciationTypes...)
+	iris := irisFromItems(items...)
+	likes := likesFilter(iris, activeAppreciationTypes...)
+	// the votes on the threads of remote groups arrive announced by the group, and so do their undos
+	searches := filters.Any(
+		likes,
+		filters.All(filters.HasType(vocab.AnnounceType), filters.Object(likes)),
+		filters.All(
+			filters.HasType(vocab.AnnounceType),
+			filters.Object(filters.All(filters.HasType(vocab.UndoType), filters.Object(likes))),
+		),
+	)
 	votes := make(VoteCollection, 0)
 	results, err := r.b.Search(searches)
 	for _, res := range results {
@@ -838,8 +1057,12 @@ func (r *repository) loadItemsVotes(ctx context.Context, items ...Item) (ItemCol
 		if err := vv.FromActivityPub(it); err != nil {
 			continue
 		}
+		if !validAnnouncedVote(vv, items) {
+			continue
+		}
 		votes = append(votes, vv)
 	}
+	votes = withoutUndoneVotes(votes)
 
 	for k, ob := range items {
 		for _, v := range votes {
@@ -1388,10 +1611,41 @@ func (r *repository) LoadSearches(ctx context.Context, deps deps, checks ...filt
 	if err != nil {
 		return emptyCursor, err
 	}
+	found := make(vocab.ItemCollection, 0, len(results))
 	for _, res := range results {
-		it, ok := res.(vocab.Item)
-		if !ok {
-			continue
+		if it, ok := res.(vocab.Item); ok {
+			found = append(found, it)
+		}
+	}
+	// Lemmy and kbin communities are Group actors that announce the activities of their members,
+	// so we load the threads, replies and votes the groups announce as our own.
+	groups := make(vocab.IRIs, 0)
+	if actors := announcingActors(found); len(actors) > 0 {
+		loaded, err := r.loadAccountsByIRI(actors)
+		if err != nil {
+			r.errFn(log.Ctx{"err": err.Error()})("unable to load the actors of the announces")
+		}
+		for iri, acc := range loaded {
+			if acc.IsGroup() {
+				_ = groups.Append(iri)
+			}
+		}
+	}
+	announced := groupAnnouncements(found, groups)
+	for _, it := range found {
+		if it.GetType() == vocab.AnnounceType {
+			ob, ok := announced[it.GetLink()]
+			if !ok {
+				continue
+			}
+			if vocab.IsIRI(ob) {
+				if !deferredRemote.Contains(ob.GetLink()) {
+					deferredRemote = append(deferredRemote, ob.GetLink())
+				}
+				relations.Store(it.GetLink(), ob.GetLink())
+				continue
+			}
+			it = ob
 		}
 		typ := it.GetType()
 		switch {
@@ -1514,6 +1768,7 @@ func (r *repository) LoadSearches(ctx context.Context, deps deps, checks ...filt
 		}
 	}
 
+	items = withoutPollAnswers(items)
 	if deps.Authors {
 		items, _ = r.loadItemsAuthors(ctx, items...)
 		accounts, _ = r.loadAccountsAuthors(ctx, accounts...)
@@ -1526,6 +1781,8 @@ func (r *repository) LoadSearches(ctx context.Context, deps deps, checks ...filt
 			items = append(items, comments...)
 		}
 	}
+	items = r.loadItemsSensitive(ctx, items...)
+	r.search.Add(items...)
 	if deps.Follows {
 		follows, _ = r.loadFollowsAuthors(ctx, follows...)
 		for i, follow := range follows {
@@ -1587,6 +1844,18 @@ func (r *repository) LoadSearches(ctx context.Context, deps deps, checks ...filt
 	}, nil
 }
 
+// loadIRIs loads the objects with the iris, and their dependencies
+func (r *repository) loadIRIs(ctx context.Context, deps deps, iris vocab.IRIs) (Cursor, error) {
+	if len(iris) == 0 {
+		return Cursor{items: make(RenderableList, 0)}, nil
+	}
+	same := make(filters.Checks, 0, len(iris))
+	for _, iri := range iris {
+		same = append(same, filters.SameIRI(iri))
+	}
+	return r.LoadSearches(ctx, deps, filters.All(filters.Any(same...), filters.WithMaxCount(MaxContentItems)))
+}
+
 func (r *repository) SaveVote(ctx context.Context, v Vote) (Vote, error) {
 	if !v.SubmittedBy.IsValid() || !v.SubmittedBy.HasMetadata() {
 		return Vote{}, errors.Newf("Invalid vote submitter")
@@ -1642,6 +1911,8 @@ func (r *repository) SaveVote(ctx context.Context, v Vote) (Vote, error) {
 		i, it, err := r.ToOutbox(ctx, v.SubmittedBy.Credentials(), act)
 		if err != nil {
 			r.errFn()(err.Error())
+		} else {
+			r.ranks.Touch(o.GetLink())
 		}
 		r.cache.removeRelated(i, it, act)
 	}
@@ -1653,6 +1924,11 @@ func (r *repository) SaveVote(ctx context.Context, v Vote) (Vote, error) {
 		act.Type = vocab.DislikeType
 		act.Object = o.GetLink()
 	} else {
+		if exists.HasMetadata() {
+			removed := v
+			removed.Weight = 0
+			r.hooks.Emit(voteEvent(removed))
+		}
 		return v, nil
 	}
 	if v.Item.SubmittedBy != nil && v.Item.SubmittedBy.Pub != nil {
@@ -1681,8 +1957,10 @@ func (r *repository) SaveVote(ctx context.Context, v Vote) (Vote, error) {
 		r.errFn(lCtx)(err.Error())
 		return v, err
 	}
+	r.hooks.Emit(voteEvent(v))
 	err = v.FromActivityPub(act)
 	r.infoFn()("saved activity")
+	r.ranks.Touch(o.GetLink())
 	return v, err
 }
 
@@ -2009,6 +2287,15 @@ func (r *repository) ModerateDelete(ctx context.Context, mod ModerationOp, autho
 	}
 	r.infoFn(lCtx)("saved activity")
 	r.cache.removeRelated(act, tombstone)
+	e := moderationEvent("delete", author, nil, nil, nil)
+	switch p := mod.Object.(type) {
+	case *Item:
+		e.Item = eventItem(p)
+	case *Account:
+		e.Account = eventAccount(p)
+	}
+	e.Reason = mod.Data
+	r.hooks.Emit(e)
 	return mod, err
 }
 
@@ -2056,6 +2343,11 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 	}
 
 	to, _, cc, bcc := r.defaultRecipientsList(author, it.Public())
+	if it.Private() {
+		// private items are addressed only to their recipients, not to the followers of the instance
+		cc = vocab.ItemCollection{r.app.Pub.GetLink()}
+	}
+	parent := it.Parent
 
 	var err error
 
@@ -2099,6 +2391,16 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 		}
 		par = p.Parent
 	}
+	var groups []groupInfo
+	if it.Public() {
+		// the items in a group, and the replies to them, are addressed to the group, following FEP-1b12
+		groups = r.itemGroups(it)
+		for _, g := range groups {
+			if gi := vocab.IRI(g.IRI); !to.Contains(gi) && !cc.Contains(gi) {
+				cc = append(cc, gi)
+			}
+		}
+	}
 
 	if !it.Private() {
 		if it.Parent == nil && it.SubmittedBy.HasMetadata() && len(it.SubmittedBy.Metadata.FollowersIRI) > 0 {
@@ -2106,11 +2408,30 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 		}
 	}
 
+	if !it.Deleted() {
+		if err = r.saveAttachments(ctx, &it, author); err != nil {
+			r.errFn(log.Ctx{"err": err.Error()})("unable to save the attachments")
+			return it, err
+		}
+	}
+
 	art := new(vocab.Object)
 	_ = r.loadAPItem(art, it)
 	if it.Parent != nil {
 		_ = loadFromParent(art, it.Parent.AP())
 	}
+	if len(groups) > 0 {
+		art.Audience = vocab.ItemCollection{vocab.IRI(groups[0].IRI)}
+	}
+	if it.Public() && it.Parent != nil && len(art.Audience) > 0 {
+		// remote groups federate back only the replies addressed to them, with a single inReplyTo IRI
+		for _, aud := range art.Audience {
+			if !to.Contains(aud.GetLink()) && !cc.Contains(aud.GetLink()) {
+				cc = append(cc, aud.GetLink())
+			}
+		}
+		art.InReplyTo = it.Parent.AP().GetLink()
+	}
 	id := art.GetLink()
 
 	act := &vocab.Activity{
@@ -2120,6 +2441,9 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 		Actor:  author.GetLink(),
 		Object: art,
 	}
+	if it.HasMetadata() && it.Metadata.Poll != nil && !it.Deleted() {
+		act.Object = it.Metadata.Poll.AP(art)
+	}
 	loadAuthors := true
 	if it.Deleted() {
 		if len(id) == 0 {
@@ -2136,11 +2460,24 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 			act.Type = vocab.UpdateType
 		}
 	}
+	var previous *Revision
+	if act.Type == vocab.UpdateType {
+		if rev, ok := r.storedRevision(id); ok {
+			previous = &rev
+		}
+	}
 	var (
 		i  vocab.IRI
 		ob vocab.Item
 	)
-	i, ob, err = r.ToOutbox(ctx, it.SubmittedBy.Credentials(), act)
+	sensitive := it.HasMetadata() && it.Metadata.Sensitive
+	var out vocab.Item = act
+	if sensitive && act.Type != vocab.DeleteType {
+		sensitive := *act
+		sensitive.Object = sensitiveObject{act.Object}
+		out = &sensitive
+	}
+	i, ob, err = r.ToOutbox(ctx, it.SubmittedBy.Credentials(), out)
 	lCtx := log.Ctx{"act": i}
 	if !vocab.IsNil(ob) {
 		lCtx["obj"] = ob.GetLink()
@@ -2152,14 +2489,36 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 	}
 	r.cache.removeRelated(i, ob, act)
 	r.infoFn(lCtx)("saved activity")
+	if previous != nil {
+		if err := r.revisions.Add(it.Hash, *previous); err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "item": it.Hash})("unable to save the previous version of the item")
+		}
+	}
+	if act.Type != vocab.DeleteType && !vocab.IsNil(ob) {
+		if err := r.sensitive.Set(map[vocab.IRI]bool{ob.GetLink(): sensitive}); err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "iri": ob.GetLink()})("unable to save the sensitive flag of the item")
+		}
+	}
+	if it.Parent == nil && !vocab.IsNil(ob) {
+		r.ranks.Touch(ob.GetLink())
+	}
+	if act.Type == vocab.CreateType && len(groups) > 0 {
+		r.announceInGroups(ctx, groups, i)
+	}
 	if err = it.FromActivityPub(ob); err != nil {
 		r.errFn(lCtx)(err.Error())
 		return it, err
 	}
+	applySensitive(&it, sensitive)
 	if loadAuthors {
 		items, err := r.loadItemsAuthors(ctx, it)
+		r.search.Add(items[0])
+		if act.Type == vocab.CreateType && !it.Private() {
+			r.hooks.Emit(itemCreatedEvent(items[0], parent))
+		}
 		return items[0], err
 	}
+	r.search.Add(it)
 	return it, err
 }
 
@@ -2296,6 +2655,11 @@ func (r *repository) SendFollowResponse(ctx context.Context, f FollowRequest, ac
 		return err
 	}
 	r.cache.removeRelated(i, it, response)
+	action := "reject"
+	if accept {
+		action = "accept"
+	}
+	r.hooks.Emit(followEvent(action, ed, er, reason))
 	return nil
 }
 
@@ -2303,7 +2667,8 @@ func (r *repository) FollowAccount(ctx context.Context, er, ed Account, reason *
 	if !accountValidForC2S(&er) {
 		return errors.Unauthorizedf("invalid account %s", er.Handle)
 	}
-	if err := r.FollowActor(ctx, er, ed, reason); err != nil {
+	follow, err := r.followActor(ctx, er, ed, reason)
+	if err != nil {
 		r.errFn(log.Ctx{
 			"err":      err.Error(),
 			"follower": er.Handle,
@@ -2311,10 +2676,23 @@ func (r *repository) FollowAccount(ctx context.Context, er, ed Account, reason *
 		})("Unable to follow")
 		return err
 	}
+	if g, ok := r.groups.ByIRI(accountIRI(&ed)); ok {
+		// anyone can follow a group, so we accept the follow requests for the local groups right away
+		if err = r.acceptGroupFollow(ctx, g, accountIRI(&er), follow); err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "follower": er.Handle, "group": g.Name})("unable to accept group follow")
+		}
+	}
+	r.hooks.Emit(followEvent("request", &er, &ed, reason))
 	return nil
 }
 
 func (r *repository) FollowActor(ctx context.Context, er, ed Account, reason *Item) error {
+	_, err := r.followActor(ctx, er, ed, reason)
+	return err
+}
+
+// followActor sends the Follow activity, and returns its IRI
+func (r *repository) followActor(ctx context.Context, er, ed Account, reason *Item) (vocab.IRI, error) {
 	follower := r.loadAPPerson(er)
 	followed := r.loadAPPerson(ed)
 
@@ -2327,11 +2705,11 @@ func (r *repository) FollowActor(ctx context.Context, er, ed Account, reason *It
 	follow.Type = vocab.FollowType
 	follow.Object = followed.GetLink()
 	follow.Actor = follower.GetLink()
-	_, _, err := r.ToOutbox(ctx, er.Credentials(), follow)
+	i, _, err := r.ToOutbox(ctx, er.Credentials(), follow)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	return i, nil
 }
 
 func (r *repository) SaveAccount(ctx context.Context, a Account) (Account, error) {
@@ -2472,6 +2850,7 @@ func (r *repository) BlockAccount(ctx context.Context, er, ed Account, reason *I
 		return err
 	}
 	r.cache.removeRelated(i, ob)
+	r.hooks.Emit(moderationEvent("block", &er, nil, &ed, reason))
 	return nil
 }
 
@@ -2493,6 +2872,7 @@ func (r *repository) BlockItem(ctx context.Context, er Account, ed Item, reason
 		return err
 	}
 	r.cache.removeRelated(i, ob, block)
+	r.hooks.Emit(moderationEvent("block", &er, &ed, nil, reason))
 	return nil
 }
 
@@ -2509,6 +2889,7 @@ func (r *repository) ReportItem(ctx context.Context, er Account, it Item, reason
 		return err
 	}
 	r.cache.removeRelated(i, ob, flag)
+	r.hooks.Emit(reportEvent(&er, &it, nil, reason))
 	return nil
 }
 
@@ -2525,6 +2906,7 @@ func (r *repository) ReportAccount(ctx context.Context, er, ed Account, reason *
 		return err
 	}
 	r.cache.removeRelated(i, ob, flag)
+	r.hooks.Emit(reportEvent(&er, nil, &ed, reason))
 	return nil
 }
 
@@ -0,0 +1,137 @@
+package brutalinks
+
+import (
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+)
+
+func TestGroupAnnouncements(t *testing.T) {
+	community := vocab.IRI("https://lemmy.example.com/c/golang")
+	person := vocab.IRI("https://lemmy.example.com/u/jdoe")
+	post := &vocab.Object{ID: "https://lemmy.example.com/post/1", Type: vocab.PageType}
+	announce := func(id string, actor vocab.Item, ob vocab.Item) *vocab.Activity {
+		return &vocab.Activity{ID: vocab.IRI(id), Type: vocab.AnnounceType, Actor: actor, Object: ob}
+	}
+
+	results := vocab.ItemCollection{
+		announce("https://lemmy.example.com/activities/announce/1", community, post),
+		announce("https://lemmy.example.com/activities/announce/2", community, post),
+		announce("https://lemmy.example.com/activities/announce/3", person, vocab.IRI("https://lemmy.example.com/post/2")),
+		announce("https://kbin.example.com/activities/announce/4", &vocab.Actor{ID: "https://kbin.example.com/m/golang", Type: vocab.GroupType}, vocab.IRI("https://kbin.example.com/entry/1")),
+		announce("https://lemmy.example.com/activities/announce/5", community, vocab.IRI("https://fedbox.git/objects/1")),
+		&vocab.Activity{ID: "https://fedbox.git/activities/1", Type: vocab.CreateType, Object: vocab.IRI("https://fedbox.git/objects/1")},
+	}
+	announced := groupAnnouncements(results, vocab.IRIs{community})
+
+	want := map[vocab.IRI]vocab.IRI{
+		"https://lemmy.example.com/activities/announce/1": post.ID,
+		"https://kbin.example.com/activities/announce/4":  "https://kbin.example.com/entry/1",
+	}
+	if len(announced) != len(want) {
+		t.Errorf("groupAnnouncements() returned %d objects, want %d: %v", len(announced), len(want), announced)
+	}
+	for iri, ob := range want {
+		if got, ok := announced[iri]; !ok || got.GetLink() != ob {
+			t.Errorf("groupAnnouncements()[%s] = %v, want %s", iri, got, ob)
+		}
+	}
+
+	if actors := announcingActors(results); len(actors) != 3 {
+		t.Errorf("announcingActors() = %v, want the three distinct actors", actors)
+	}
+}
+
+func TestWithoutUndoneVotes(t *testing.T) {
+	jdoe := &Account{Pub: vocab.IRI("https://lemmy.example.com/u/jdoe")}
+	alice := &Account{Pub: vocab.IRI("https://lemmy.example.com/u/alice")}
+	like := Vote{Weight: 1, SubmittedBy: jdoe, Metadata: &VoteMetadata{IRI: "https://lemmy.example.com/activities/like/1"}}
+	other := Vote{Weight: -1, SubmittedBy: alice, Metadata: &VoteMetadata{IRI: "https://lemmy.example.com/activities/dislike/2"}}
+	undo := Vote{SubmittedBy: jdoe, Metadata: &VoteMetadata{
+		IRI:         "https://lemmy.example.com/activities/undo/1",
+		OriginalIRI: "https://lemmy.example.com/activities/like/1",
+	}}
+	forged := Vote{SubmittedBy: jdoe, Metadata: &VoteMetadata{
+		IRI:         "https://lemmy.example.com/activities/undo/2",
+		OriginalIRI: "https://lemmy.example.com/activities/dislike/2",
+	}}
+
+	got := withoutUndoneVotes(VoteCollection{like, other, undo})
+	if len(got) != 1 || got[0].Metadata.IRI != other.Metadata.IRI {
+		t.Errorf("withoutUndoneVotes() = %v, want only the vote which wasn't undone", got)
+	}
+	if got = withoutUndoneVotes(VoteCollection{like, other}); len(got) != 2 {
+		t.Errorf("withoutUndoneVotes() = %v, want the votes unchanged when there are no undos", got)
+	}
+	if got = withoutUndoneVotes(VoteCollection{like, other, forged}); len(got) != 2 {
+		t.Errorf("withoutUndoneVotes() = %v, want the votes unchanged by the undo of another actor", got)
+	}
+}
+
+func TestValidAnnouncedVote(t *testing.T) {
+	group := vocab.IRI("https://lemmy.example.com/c/golang")
+	thread := Item{Pub: &vocab.Object{ID: "https://lemmy.example.com/post/1", Type: vocab.PageType, To: vocab.ItemCollection{group}}}
+	other := Item{Pub: &vocab.Object{ID: "https://lemmy.example.com/post/2", Type: vocab.PageType}}
+	items := ItemCollection{thread, other}
+
+	tests := map[string]struct {
+		vote Vote
+		want bool
+	}{
+		"not announced": {
+			vote: Vote{Item: &other, Metadata: &VoteMetadata{IRI: "https://example.com/like/1"}},
+			want: true,
+		},
+		"announced by the group of the thread": {
+			vote: Vote{Item: &thread, Metadata: &VoteMetadata{IRI: "https://lemmy.example.com/like/1", AnnouncedBy: group.String()}},
+			want: true,
+		},
+		"announced by another actor": {
+			vote: Vote{Item: &thread, Metadata: &VoteMetadata{IRI: "https://lemmy.example.com/like/2", AnnouncedBy: "https://evil.example.com/u/mallory"}},
+			want: false,
+		},
+		"announced on a thread not addressed to the group": {
+			vote: Vote{Item: &other, Metadata: &VoteMetadata{IRI: "https://lemmy.example.com/like/3", AnnouncedBy: group.String()}},
+			want: false,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := validAnnouncedVote(tt.vote, items); got != tt.want {
+				t.Errorf("validAnnouncedVote() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoteThreadReply(t *testing.T) {
+	thread := vocab.IRI("https://lemmy.example.com/post/1")
+	tests := map[string]struct {
+		reply vocab.Item
+		want  bool
+	}{
+		"reply to the thread": {
+			reply: &vocab.Object{ID: "https://lemmy.example.com/comment/1", Type: vocab.NoteType, InReplyTo: thread},
+			want:  true,
+		},
+		"reply to the thread and its parent": {
+			reply: &vocab.Object{ID: "https://lemmy.example.com/comment/2", Type: vocab.NoteType, InReplyTo: vocab.ItemCollection{vocab.IRI("https://lemmy.example.com/comment/1"), thread}},
+			want:  true,
+		},
+		"reply to another thread": {
+			reply: &vocab.Object{ID: "https://fedbox.git/objects/2", Type: vocab.NoteType, InReplyTo: vocab.IRI("https://fedbox.git/objects/1")},
+			want:  false,
+		},
+		"not a reply": {
+			reply: &vocab.Object{ID: "https://fedbox.git/objects/3", Type: vocab.NoteType},
+			want:  false,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := remoteThreadReply(tt.reply, vocab.IRIs{thread}); got != tt.want {
+				t.Errorf("remoteThreadReply() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package brutalinks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// PasswordResetValidity is how long the link in a password reset email can be used
+	PasswordResetValidity = time.Hour
+	// passwordResetInterval is the time that needs to pass before sending a new password reset email to an account
+	passwordResetInterval = 5 * time.Minute
+)
+
+// randomToken returns a random string that can be used in the links we email
+func randomToken() string {
+	raw := make([]byte, 32)
+	_, _ = rand.Read(raw)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// tokenHash is what we store instead of the tokens we email, so they can't be read from the settings
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newPasswordResetToken returns a random token for the password reset link, and keeps its hash in the settings
+func newPasswordResetToken(st *AccountSettings, now time.Time) string {
+	token := randomToken()
+	st.PasswordReset = tokenHash(token)
+	st.PasswordResetExpires = now.Add(PasswordResetValidity)
+	return token
+}
+
+// validPasswordReset returns true if token is the one sent in the last password reset email, and it didn't expire
+func (s AccountSettings) validPasswordReset(token string, now time.Time) bool {
+	if token == "" || s.PasswordReset == "" || now.After(s.PasswordResetExpires) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(s.PasswordReset), []byte(tokenHash(token))) == 1
+}
+
+// SendPasswordReset emails a link for changing the password to the local account with handle,
+// if it has an email address and it chose to receive password reset emails.
+func (r *repository) SendPasswordReset(ctx context.Context, handle string) error {
+	acc, err := r.account(ctx, AccountByHandleCheck(handle))
+	if err != nil {
+		return err
+	}
+	if !acc.IsLocal() {
+		return errors.NotFoundf("account %s is not local", handle)
+	}
+	now := time.Now().UTC()
+	token := ""
+	st, err := r.settings.Update(acc, func(st *AccountSettings) bool {
+		if !st.WantsEmail(EmailPasswordReset) {
+			return false
+		}
+		if st.PasswordResetExpires.After(now.Add(PasswordResetValidity - passwordResetInterval)) {
+			// we just sent one, this keeps the form from being used for flooding the mailbox
+			return false
+		}
+		token = newPasswordResetToken(st, now)
+		return true
+	})
+	if err != nil || token == "" {
+		return err
+	}
+
+	link := fmt.Sprintf("%s%s/reset/%s", r.SelfURL, AccountLocalLink(acc), token)
+	subject := fmt.Sprintf("Change your password on %s", Instance.BaseURL.Host)
+	bodyFmt := "Hello %s,\n\nSomeone, hopefully you, asked to change the password of your account on %s.\n\n" +
+		"To choose a new password, visit the URL below in the next hour: %s\n\n" +
+		"If you didn't ask for this, you can ignore this email and your password stays the same."
+	body := fmt.Sprintf(bodyFmt, acc.Handle, r.SelfURL, link)
+	return r.mail.Send(st.Email, subject, body)
+}
+
+type resetModel struct {
+	Title   template.HTML
+	Account Account
+	Token   string
+}
+
+func (m *resetModel) SetTitle(s string) {
+	m.Title = template.HTML(s)
+}
+
+func (resetModel) Template() string {
+	return "reset"
+}
+
+func (*resetModel) SetCursor(c *Cursor) {}
+
+// HandlePasswordResetRequest serves the POST /reset requests
+func (h *handler) HandlePasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	if handle := strings.TrimSpace(r.PostFormValue("handle")); handle != "" {
+		if err := h.storage.SendPasswordReset(r.Context(), handle); err != nil {
+			h.errFn(log.Ctx{"err": err.Error(), "handle": handle})("unable to send password reset email")
+		}
+	}
+	// the message is the same whether we sent the email or not, so the form can't be used
+	// to find out which accounts have an email address.
+	h.v.addFlashMessage(Info, w, r, "If the account has an email address, we sent it a link for changing the password.")
+	h.v.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// ValidatePasswordReset checks the token in the password reset link for the current account,
+// and loads the model for changing its password.
+func (h *handler) ValidatePasswordReset(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authors := ContextAuthors(r.Context())
+		token := chi.URLParam(r, "token")
+		if len(authors) == 0 || !accountSettings(r, &authors[0]).validPasswordReset(token, time.Now().UTC()) {
+			h.v.addFlashMessage(Error, w, r, "The password reset link is not valid, or it has expired.")
+			h.v.Redirect(w, r, "/reset", http.StatusSeeOther)
+			return
+		}
+		m := &resetModel{Title: "Change password", Account: authors[0], Token: token}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ModelCtxtKey, m)))
+	})
+}
+
+// HandlePasswordReset serves the POST /~{handle}/reset/{token} requests.
+// It changes the password of the account, and only then invalidates the token.
+func (h *handler) HandlePasswordReset(w http.ResponseWriter, r *http.Request) {
+	m, ok := r.Context().Value(ModelCtxtKey).(*resetModel)
+	if !ok {
+		h.v.HandleErrors(w, r, errors.NotValidf("invalid password reset"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		h.v.HandleErrors(w, r, errors.NewBadRequest(err, "invalid password reset"))
+		return
+	}
+	if r.PostFormValue("pw") != r.PostFormValue("pw-confirm") {
+		h.v.addFlashMessage(Error, w, r, "The passwords don't match.")
+		h.v.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+	acc := &m.Account
+	r.PostForm.Set("hash", acc.Hash.String())
+	r.PostForm.Set("handle", acc.Handle)
+	if err := h.changePassword(r); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+
+	_, err := h.storage.settings.Update(acc, func(st *AccountSettings) bool {
+		st.PasswordReset, st.PasswordResetExpires = "", time.Time{}
+		return true
+	})
+	if err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to invalidate password reset")
+	}
+	h.v.addFlashMessage(Success, w, r, "The password has been changed.")
+	h.v.Redirect(w, r, "/login", http.StatusSeeOther)
+}
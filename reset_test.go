@@ -0,0 +1,57 @@
+package brutalinks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPasswordResetToken(t *testing.T) {
+	now := time.Now().UTC()
+	st := AccountSettings{}
+	token := newPasswordResetToken(&st, now)
+	if token == "" || st.PasswordReset == "" || st.PasswordReset == token {
+		t.Fatalf("newPasswordResetToken() must keep only the hash of the token")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		now   time.Time
+		want  bool
+	}{
+		{name: "valid", token: token, now: now, want: true},
+		{name: "empty", token: "", now: now, want: false},
+		{name: "other token", token: randomToken(), now: now, want: false},
+		{name: "the hash", token: st.PasswordReset, now: now, want: false},
+		{name: "expired", token: token, now: now.Add(PasswordResetValidity + time.Second), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := st.validPasswordReset(tt.token, tt.now); got != tt.want {
+				t.Errorf("validPasswordReset() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	st.PasswordReset, st.PasswordResetExpires = "", time.Time{}
+	if st.validPasswordReset(token, now) {
+		t.Errorf("validPasswordReset() accepted the token after it was cleared")
+	}
+}
+
+func TestEmailConfirmation(t *testing.T) {
+	st := AccountSettings{Email: "jdoe@example.com", EmailConfirmed: true, Emails: []string{EmailPasswordReset}}
+	token := newEmailConfirmation(&st)
+	if st.EmailConfirmed || st.WantsEmail(EmailPasswordReset) {
+		t.Errorf("an address waiting for confirmation must not receive emails")
+	}
+	if !st.ChoseEmail(EmailPasswordReset) {
+		t.Errorf("ChoseEmail() must keep the choices of the unconfirmed address")
+	}
+	if st.validEmailConfirmation(randomToken()) || st.validEmailConfirmation("") {
+		t.Errorf("validEmailConfirmation() accepted an invalid token")
+	}
+	if !st.validEmailConfirmation(token) {
+		t.Errorf("validEmailConfirmation() refused the valid token")
+	}
+}
@@ -14,51 +14,70 @@ import (
 
 var basicStyles = []string{"css/reset.css", "css/main.css", "css/header.css", "css/footer.css", "css/s.css"}
 var assetFiles = ass.Map{
-	"/css/moderate.css":     append(basicStyles, "css/listing.css", "css/content.css", "css/article.css", "css/moderate.css"),
-	"/css/content.css":      append(basicStyles, "css/article.css", "css/listing.css", "css/threaded.css", "css/content.css"),
-	"/css/accounts.css":     append(basicStyles, "css/listing.css", "css/threaded.css", "css/accounts.css"),
-	"/css/listing.css":      append(basicStyles, "css/listing.css", "css/article.css", "css/threaded.css", "css/moderate.css"),
-	"/css/moderation.css":   append(basicStyles, "css/listing.css", "css/article.css", "css/threaded.css", "css/moderation.css"),
-	"/css/user.css":         append(basicStyles, "css/listing.css", "css/article.css", "css/user.css"),
-	"/css/user-message.css": append(basicStyles, "css/listing.css", "css/article.css", "css/user-message.css"),
-	"/css/new.css":          append(basicStyles, "css/listing.css", "css/article.css"),
-	"/css/404.css":          append(basicStyles, "css/article.css", "css/error.css"),
-	"/css/about.css":        append(basicStyles, "css/article.css", "css/about.css"),
-	"/css/error.css":        append(basicStyles, "css/error.css"),
-	"/css/login.css":        append(basicStyles, "css/login.css"),
-	"/css/register.css":     append(basicStyles, "css/login.css"),
-	"/css/inline.css":       {"css/inline.css"},
-	"/css/simple.css":       {"css/simple.css"},
-	"/css/grid.css":         {"css/grid.css"},
-	"/js/main.js":           {"js/base.js", "js/main.js"},
-	"/robots.txt":           {"robots.txt"},
-	"/favicon.ico":          {"favicon.ico"},
-	"/icons.svg":            {"icons.svg"},
+	"/css/moderate.css":      append(basicStyles, "css/listing.css", "css/content.css", "css/article.css", "css/moderate.css"),
+	"/css/content.css":       append(basicStyles, "css/article.css", "css/listing.css", "css/threaded.css", "css/content.css"),
+	"/css/accounts.css":      append(basicStyles, "css/listing.css", "css/threaded.css", "css/accounts.css"),
+	"/css/listing.css":       append(basicStyles, "css/listing.css", "css/article.css", "css/threaded.css", "css/moderate.css"),
+	"/css/moderation.css":    append(basicStyles, "css/listing.css", "css/article.css", "css/threaded.css", "css/moderation.css"),
+	"/css/user.css":          append(basicStyles, "css/listing.css", "css/article.css", "css/user.css"),
+	"/css/user-message.css":  append(basicStyles, "css/listing.css", "css/article.css", "css/user-message.css"),
+	"/css/new.css":           append(basicStyles, "css/listing.css", "css/article.css"),
+	"/css/search.css":        append(basicStyles, "css/listing.css", "css/article.css", "css/threaded.css", "css/search.css"),
+	"/css/history.css":       append(basicStyles, "css/article.css", "css/history.css"),
+	"/css/404.css":           append(basicStyles, "css/article.css", "css/error.css"),
+	"/css/about.css":         append(basicStyles, "css/article.css", "css/about.css"),
+	"/css/error.css":         append(basicStyles, "css/error.css"),
+	"/css/settings.css":      append(basicStyles, "css/login.css"),
+	"/css/notifications.css": append(basicStyles, "css/notifications.css"),
+	"/css/conversations.css": append(basicStyles, "css/conversations.css"),
+	"/css/group.css":         append(basicStyles, "css/listing.css", "css/article.css", "css/user.css", "css/login.css"),
+	"/css/groups.css":        append(basicStyles, "css/login.css", "css/groups.css"),
+	"/css/login.css":         append(basicStyles, "css/login.css"),
+	"/css/register.css":      append(basicStyles, "css/login.css"),
+	"/css/reset.css":         append(basicStyles, "css/login.css"),
+	"/css/webhooks.css":      append(basicStyles, "css/login.css", "css/webhooks.css"),
+	"/css/inline.css":        {"css/inline.css"},
+	"/css/simple.css":        {"css/simple.css"},
+	"/css/grid.css":          {"css/grid.css"},
+	"/js/main.js":            {"js/base.js", "js/main.js"},
+	"/robots.txt":            {"robots.txt"},
+	"/favicon.ico":           {"favicon.ico"},
+	"/icons.svg":             {"icons.svg"},
 }
 
-func (h *handler) ItemRoutes(extra ...func(http.Handler) http.Handler) func(chi.Router) {
+func (h *handler) ItemRoutes(csrf func(http.Handler) http.Handler) func(chi.Router) {
 	return func(r chi.Router) {
-		r.Use(extra...)
 		r.Use(ContentModelMw, ItemChecks, LoadSingleObjectMw, SingleItemModelMw)
-		r.With(Deps(Votes, Replies, Authors), LoadSingleItemMw, SortByScore).
-			Get("/", h.HandleShow)
-		r.With(h.ValidateLoggedIn(h.v.RedirectToErrors), LoadSingleItemMw).Post("/", h.HandleSubmit)
+		// the size of the submissions is limited before the CSRF validation loads their form
+		r.With(h.v.LimitRequestBodyMw, csrf, h.ValidateLoggedIn(h.v.RedirectToErrors), LoadSingleItemMw).
+			Post("/", h.HandleSubmit)
+		r.With(h.v.LimitRequestBodyMw, csrf, h.ValidateLoggedIn(h.v.RedirectToErrors), h.ValidateItemAuthor("edit"), LoadSingleItemMw).
+			Post("/edit", h.HandleSubmit)
 
-		r.Group(func(r chi.Router) {
-			r.Use(h.ValidateLoggedIn(h.v.RedirectToErrors))
-			r.Get("/yay", h.HandleVoting)
-			r.Get("/nay", h.HandleVoting)
-
-			//r.Get("/bad", h.ShowReport)
-			r.With(Deps(Votes, Authors), LoadSingleItemMw, ReportContentModelMw).Get("/bad", h.HandleShow)
-			r.Post("/bad", h.ReportItem)
-			r.With(Deps(Votes, Authors), LoadSingleItemMw, BlockContentModelMw).Get("/block", h.HandleShow)
-			r.Post("/block", h.BlockItem)
+		r.With(csrf).Group(func(r chi.Router) {
+			r.With(h.ActivityPubMw, Deps(Votes, Replies, Authors), LoadSingleItemMw, h.v.SortThread).
+				Get("/", h.HandleShow)
+			r.With(Deps(Authors), LoadSingleItemMw, HistoryModelMw).Get("/history", h.HandleShow)
 
 			r.Group(func(r chi.Router) {
-				r.With(h.ValidateItemAuthor("edit"), LoadSingleItemMw, EditContentModelMw).Get("/edit", h.HandleShow)
-				r.With(h.ValidateItemAuthor("edit"), LoadSingleItemMw).Post("/edit", h.HandleSubmit)
-				r.With(h.ValidateItemAuthor("delete")).Get("/rm", h.HandleDelete)
+				r.Use(h.ValidateLoggedIn(h.v.RedirectToErrors))
+				r.Get("/yay", h.HandleVoting)
+				r.Get("/nay", h.HandleVoting)
+				r.Post("/"+actionSave, h.HandleBookmark)
+				r.Post("/"+actionUnsave, h.HandleBookmark)
+				r.With(LoadSingleItemMw).Post("/poll", h.HandlePollVote)
+
+				//r.Get("/bad", h.ShowReport)
+				r.With(Deps(Votes, Authors), LoadSingleItemMw, ReportContentModelMw).Get("/bad", h.HandleShow)
+				r.Post("/bad", h.ReportItem)
+				r.With(Deps(Votes, Authors), LoadSingleItemMw, BlockContentModelMw).Get("/block", h.HandleShow)
+				r.Post("/block", h.BlockItem)
+				r.With(h.LoadGroupMw).Post("/g/{name}/rm", h.HandleGroupRemove)
+
+				r.Group(func(r chi.Router) {
+					r.With(h.ValidateItemAuthor("edit"), LoadSingleItemMw, EditContentModelMw).Get("/edit", h.HandleShow)
+					r.With(h.ValidateItemAuthor("delete")).Get("/rm", h.HandleDelete)
+				})
 			})
 		})
 	}
@@ -78,6 +97,7 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 	return func(r chi.Router) {
 		r.Use(lw.Middlewares(h.logger)...)
 		r.Use(middleware.GetHead)
+		r.Use(FeedMw)
 
 		r.Group(func(r chi.Router) {
 			r.Use(OutOfOrderMw(h.v))
@@ -96,9 +116,15 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 			usersEnabledOrInvitesFn := func(_ *http.Request) (bool, string) {
 				return c.UserInvitesEnabled || c.UserCreatingEnabled, "Unable to create account"
 			}
+			mailEnabledFn := func(_ *http.Request) (bool, string) {
+				return c.MailEnabled(), "Password resets are not available"
+			}
+			r.With(h.v.LimitRequestBodyMw, csrf, h.v.RedirectWithFailMessage(submissionsEnabledFn)).
+				Post("/submit", h.HandleSubmit)
 			r.With(csrf).Group(func(r chi.Router) {
 				r.With(AddModelMw, h.v.RedirectWithFailMessage(submissionsEnabledFn)).Get("/submit", h.HandleShow)
-				r.With(h.v.RedirectWithFailMessage(submissionsEnabledFn)).Post("/submit", h.HandleSubmit)
+				r.With(h.v.RedirectWithFailMessage(submissionsEnabledFn), h.ValidateLoggedIn(h.JSONErrors), h.PreviewRateLimitMw).
+					Get("/submit/preview", h.HandleLinkPreview)
 				r.Route("/register", func(r chi.Router) {
 					r.Group(func(r chi.Router) {
 						r.With(h.v.RedirectWithFailMessage(usersEnabledFn), ModelMw(&registerModel{Title: "Register new account"})).
@@ -108,6 +134,32 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 					})
 					r.With(h.v.RedirectWithFailMessage(usersEnabledOrInvitesFn)).Post("/", h.HandleRegister)
 				})
+				r.With(h.ValidateLoggedIn(h.v.RedirectToErrors)).Route("/settings", func(r chi.Router) {
+					r.With(SettingsModelMw).Get("/", h.HandleShow)
+					r.Post("/", h.HandleSettings)
+					r.Route("/webhooks", func(r chi.Router) {
+						r.With(WebhooksModelMw).Get("/", h.HandleShow)
+						r.Post("/", h.HandleWebhookAdd)
+						r.Post("/{id}/delete", h.HandleWebhookRemove)
+					})
+				})
+				r.Route("/g", func(r chi.Router) {
+					r.With(GroupsModelMw).Get("/", h.HandleShow)
+					r.With(h.ValidateLoggedIn(h.v.RedirectToErrors)).Post("/", h.HandleGroupCreate)
+					r.With(h.LoadGroupMw).Route("/{name}", func(r chi.Router) {
+						r.With(ListingModelMw, Deps(Authors, Votes), LanguagePreferencesMw, GroupChecks, LoadMw, SortByDate, h.Feed).
+							Get("/", h.HandleShow)
+						r.With(h.ValidateLoggedIn(h.v.RedirectToErrors)).Post("/", h.HandleGroupUpdate)
+					})
+				})
+				r.With(h.ValidateLoggedIn(h.v.RedirectToErrors)).Route("/conversations", func(r chi.Router) {
+					r.With(ConversationsModelMw).Get("/", h.HandleShow)
+					r.Post("/", h.HandleConversationsRead)
+				})
+				r.With(h.v.RedirectWithFailMessage(mailEnabledFn)).Route("/reset", func(r chi.Router) {
+					r.With(ModelMw(&resetModel{Title: "Reset password"})).Get("/", h.HandleShow)
+					r.Post("/", h.HandlePasswordResetRequest)
+				})
 				r.With(h.NeedsSessions).Group(func(r chi.Router) {
 					r.With(ModelMw(&loginModel{Title: "Authentication", Provider: fedboxProvider})).Get("/login", h.HandleShow)
 					r.Post("/login", h.HandleLogin)
@@ -119,23 +171,35 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 			r.With(h.LoadAuthorMw, LoadMw).Get("/~{handle}.pub", h.ShowPublicKey)
 
 			r.With(h.LoadAuthorMw).Route("/~{handle}", func(r chi.Router) {
-				r.With(AccountListingModelMw, AuthorChecks, Deps(Authors, Votes), LoadMw).
+				r.With(h.ActivityPubMw, csrf, AccountListingModelMw, AuthorChecks, Deps(Authors, Votes), LoadMw, h.Feed).
 					Get("/", h.HandleShow)
 
 				r.With(csrf).Route("/changepw/{hash}", func(r chi.Router) {
 					r.With(ModelMw(&registerModel{Title: "Change password"}), LoadInvitedMw).Get("/", h.HandleShow)
 					r.Post("/", h.HandleChangePassword)
 				})
+				r.With(h.v.RedirectWithFailMessage(mailEnabledFn)).Get("/confirm/{token}", h.HandleEmailConfirmation)
+				r.With(h.v.RedirectWithFailMessage(mailEnabledFn), csrf, h.ValidatePasswordReset).
+					Route("/reset/{token}", func(r chi.Router) {
+						r.Get("/", h.HandleShow)
+						r.Post("/", h.HandlePasswordReset)
+					})
+				r.With(h.ValidateLoggedIn(h.v.RedirectToErrors), h.ValidateAccountOwner(h.v.RedirectToErrors),
+					csrf, ListingModelMw, Deps(Authors, Votes), LoadSavedMw).Get("/saved", h.HandleShow)
+				r.With(h.ValidateLoggedIn(h.v.RedirectToErrors), h.ValidateAccountOwner(h.v.RedirectToErrors), csrf).
+					Route("/notifications", func(r chi.Router) {
+						r.With(NotificationsModelMw).Get("/", h.HandleShow)
+						r.Post("/", h.HandleNotificationsRead)
+					})
+
 				r.Group(func(r chi.Router) {
 					r.Use(h.ValidateLoggedIn(h.v.RedirectToErrors))
 					r.Get("/follow", h.FollowAccount)
 					r.With(h.NeedsSessions, h.ValidateLoggedIn(h.v.RedirectToErrors)).Post("/invite", h.HandleCreateInvitation)
 
+					r.With(h.v.LimitRequestBodyMw, csrf, MessageUserContentModelMw).Post("/message", h.HandleSubmit)
 					r.With(csrf, MessageUserContentModelMw).Group(func(r chi.Router) {
-						r.Route("/message", func(r chi.Router) {
-							r.Get("/", h.HandleShow)
-							r.Post("/", h.HandleSubmit)
-						})
+						r.Get("/message", h.HandleShow)
 
 						r.With(BlockAccountModelMw).Get("/block", h.HandleShow)
 						r.Post("/block", h.BlockAccount)
@@ -150,26 +214,37 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 
 			// @todo(marius) :link_generation:
 			r.With(ContentModelMw, ItemChecks, LoadSingleObjectMw).Get("/i/{hash}", h.HandleItemRedirect)
+			r.Get("/media/{hash}", h.HandleAttachment)
 
 			r.With(h.NeedsSessions).Get("/logout", h.HandleLogout)
 
-			r.With(ListingModelMw, Deps(Authors, Votes)).Group(func(r chi.Router) {
+			r.With(csrf, ListingModelMw, Deps(Authors, Votes), LanguagePreferencesMw).Group(func(r chi.Router) {
 				// todo(marius) :link_generation:
-				r.With(DefaultChecks, LoadMw, SortByScore).Get("/", h.HandleShow)
+				r.With(DefaultChecks, LoadRankedMw, SortByDefault, h.Feed).Get("/", h.HandleShow)
 
 				r.With(DomainChecksMw, LoadMw, middleware.StripSlashes, SortByDate).Get("/d", h.HandleShow)
 
-				r.With(DomainChecksMw, LoadMw, SortByDate).Get("/d/{domain}", h.HandleShow)
+				r.With(DomainChecksMw, LoadMw, SortByDate, h.Feed).Get("/d/{domain}", h.HandleShow)
+				r.With(TopWindowMw, DomainChecksMw, LoadTopMw, SortByTop, h.Feed).
+					Get("/d/{domain}/top/{window}", h.HandleShow)
+
+				r.With(SearchMw).Get("/search", h.HandleShow)
+
+				r.With(TopWindowMw, TopLevelChecks, LoadTopMw, SortByTop, h.Feed).Get("/top", h.HandleShow)
+				r.With(TopWindowMw, TopLevelChecks, LoadTopMw, SortByTop, h.Feed).
+					Get("/top/{window}", h.HandleShow)
 
-				r.With(TagChecks, LoadMw, Deps(Moderations), h.ModerationListing, SortByDate).
+				r.With(TagChecks, LoadMw, Deps(Moderations), h.ModerationListing, SortByDate, h.Feed).
 					Get("/t/{tag}", h.HandleShow)
+				r.With(TopWindowMw, TagChecks, LoadTopMw, SortByTop, h.Feed).
+					Get("/t/{tag}/top/{window}", h.HandleShow)
 
 				selfID := h.storage.fedbox.Service().ID
-				r.With(SelfChecks(selfID), LoadMw, SortByScore).Get("/self", h.HandleShow)
-				r.With(FederatedChecks(selfID), LoadMw, SortByScore).Get("/federated", h.HandleShow)
+				r.With(SelfChecks(selfID), LoadMw, SortByScore, h.Feed).Get("/self", h.HandleShow)
+				r.With(FederatedChecks(selfID), LoadMw, SortByScore, h.Feed).Get("/federated", h.HandleShow)
 
 				r.With(h.NeedsSessions, h.ValidateLoggedIn(h.v.RedirectToErrors), Deps(Follows),
-					FollowedChecks, LoadMw, SortByDate).Get("/followed", h.HandleShow)
+					FollowedChecks, LoadMw, SortByDate, h.Feed).Get("/followed", h.HandleShow)
 
 				r.Route("/moderation", func(r chi.Router) {
 					r.With(ModelMw(&listingModel{tpl: "moderation", sortFn: ByDate}), Deps(Moderations, Follows),
@@ -185,6 +260,7 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 			})
 
 			r.Post("/follow", h.HandleFollowInstanceRequest)
+			r.Get("/authorize_interaction", h.HandleAuthorizeInteraction)
 			r.Get("/about", h.HandleAbout)
 			r.Route("/auth", func(r chi.Router) {
 
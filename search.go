@@ -0,0 +1,405 @@
+package brutalinks
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const (
+	searchTypeComment = "comment"
+	searchTypePost    = "post"
+)
+
+// searchQuery is the parsed form of the text users search for
+type searchQuery struct {
+	terms   []string
+	phrases []string
+	author  string
+	tag     string
+	domain  string
+	typ     string
+	since   time.Time
+	until   time.Time
+}
+
+func (q searchQuery) IsEmpty() bool {
+	return len(q.terms) == 0 && len(q.phrases) == 0 && q.author == "" && q.tag == "" &&
+		q.domain == "" && q.typ == "" && q.since.IsZero() && q.until.IsZero()
+}
+
+// words returns all the words that need to be present in the matching items
+func (q searchQuery) words() []string {
+	words := append([]string{}, q.terms...)
+	for _, p := range q.phrases {
+		words = append(words, strings.Fields(p)...)
+	}
+	return words
+}
+
+// parseSearchQuery splits q in words and "quoted phrases", and loads the qualifiers:
+// author:handle, tag:name, domain:example.com, type:comment or type:post, and the date ranges
+// after:2006-01-02, before:2006-01-02 and date:2006-01..2006-03, where the dates can be a year, a month or a day.
+func parseSearchQuery(q string) searchQuery {
+	s := searchQuery{}
+	for {
+		q = strings.TrimSpace(q)
+		if q == "" {
+			break
+		}
+		if q[0] == '"' {
+			var phrase string
+			if end := strings.IndexByte(q[1:], '"'); end >= 0 {
+				phrase, q = q[1:end+1], q[end+2:]
+			} else {
+				phrase, q = q[1:], ""
+			}
+			if words := searchTokens(phrase); len(words) > 0 {
+				s.phrases = append(s.phrases, strings.Join(words, " "))
+			}
+			continue
+		}
+		tok := q
+		if i := strings.IndexFunc(q, unicode.IsSpace); i > 0 {
+			tok, q = q[:i], q[i:]
+		} else {
+			q = ""
+		}
+		if key, val, ok := strings.Cut(tok, ":"); ok && s.qualifier(strings.ToLower(key), val) {
+			continue
+		}
+		s.terms = append(s.terms, searchTokens(tok)...)
+	}
+	return s
+}
+
+func (q *searchQuery) qualifier(key, val string) bool {
+	if val == "" {
+		return false
+	}
+	val = strings.ToLower(val)
+	switch key {
+	case "author":
+		q.author = strings.TrimLeft(val, "~@")
+	case "tag":
+		q.tag = strings.TrimLeft(val, "#")
+	case "domain":
+		q.domain = strings.TrimPrefix(val, "www.")
+	case "type":
+		if val != searchTypeComment && val != searchTypePost {
+			return false
+		}
+		q.typ = val
+	case "after", "since":
+		start, _, ok := parseSearchDate(val)
+		if !ok {
+			return false
+		}
+		q.since = start
+	case "before", "until":
+		start, _, ok := parseSearchDate(val)
+		if !ok {
+			return false
+		}
+		q.until = start
+	case "date":
+		from, to, _ := strings.Cut(val, "..")
+		if from == "" && to == "" {
+			return false
+		}
+		if to == "" && !strings.Contains(val, "..") {
+			to = from
+		}
+		if from != "" {
+			start, _, ok := parseSearchDate(from)
+			if !ok {
+				return false
+			}
+			q.since = start
+		}
+		if to != "" {
+			_, end, ok := parseSearchDate(to)
+			if !ok {
+				return false
+			}
+			q.until = end
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// parseSearchDate returns the interval covered by the year, month or day in s
+func parseSearchDate(s string) (time.Time, time.Time, bool) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, t.AddDate(0, 0, 1), true
+	}
+	if t, err := time.Parse("2006-01", s); err == nil {
+		return t, t.AddDate(0, 1, 0), true
+	}
+	if t, err := time.Parse("2006", s); err == nil {
+		return t, t.AddDate(1, 0, 0), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// searchTokens returns the lower case words in s
+func searchTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+type searchDoc struct {
+	author    string
+	tags      []string
+	domain    string
+	comment   bool
+	published time.Time
+	// text contains the words of the title and content, separated by a space
+	text string
+}
+
+func searchDocFromItem(it Item) searchDoc {
+	doc := searchDoc{published: it.SubmittedAt, comment: !it.IsTop()}
+	if it.SubmittedBy != nil {
+		doc.author = strings.ToLower(it.SubmittedBy.Handle)
+	}
+	if it.HasMetadata() {
+		for _, t := range it.Metadata.Tags {
+			doc.tags = append(doc.tags, strings.ToLower(strings.TrimLeft(t.Name, "#")))
+		}
+	}
+	words := searchTokens(it.Title)
+	if it.IsLink() {
+		if u, err := url.Parse(it.Data); err == nil {
+			doc.domain = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		}
+	} else {
+		words = append(words, searchTokens(bluemonday.StrictPolicy().Sanitize(it.Data))...)
+	}
+	doc.text = strings.Join(words, " ")
+	return doc
+}
+
+func (d searchDoc) matches(q searchQuery) bool {
+	if q.author != "" && d.author != q.author && !strings.HasPrefix(d.author, q.author+"@") {
+		return false
+	}
+	if q.tag != "" && !stringInSlice(d.tags)(q.tag) {
+		return false
+	}
+	if q.domain != "" && d.domain != q.domain && !strings.HasSuffix(d.domain, "."+q.domain) {
+		return false
+	}
+	if (q.typ == searchTypeComment && !d.comment) || (q.typ == searchTypePost && d.comment) {
+		return false
+	}
+	if !q.since.IsZero() && d.published.Before(q.since) {
+		return false
+	}
+	if !q.until.IsZero() && !d.published.Before(q.until) {
+		return false
+	}
+	for _, p := range q.phrases {
+		if !strings.Contains(" "+d.text+" ", " "+p+" ") {
+			return false
+		}
+	}
+	return true
+}
+
+// searchIndex is an inverted index of the words in the title and content of the newest items we've seen
+type searchIndex struct {
+	m     sync.RWMutex
+	size  int
+	docs  map[vocab.IRI]searchDoc
+	terms map[string]map[vocab.IRI]struct{}
+}
+
+// searchIndexNew returns an index holding at most size items, or an unbounded one if size is not greater than zero
+func searchIndexNew(size int) *searchIndex {
+	return &searchIndex{
+		size:  size,
+		docs:  make(map[vocab.IRI]searchDoc),
+		terms: make(map[string]map[vocab.IRI]struct{}),
+	}
+}
+
+// backfill indexes the newest public items in storage, so the search covers what was published
+// before the application started.
+func (s *searchIndex) backfill(r *repository) {
+	if s == nil || r == nil {
+		return
+	}
+	checks := filters.Checks{filters.HasType(ValidContentTypes...), filters.Recipients(vocab.PublicNS)}
+	if s.size > 0 {
+		checks = append(checks, filters.WithMaxCount(s.size))
+	}
+	res, err := r.b.Search(checks...)
+	if err != nil {
+		r.errFn(log.Ctx{"err": err.Error()})("unable to load the items for the search index")
+		return
+	}
+	items := make(ItemCollection, 0, len(res))
+	for _, li := range res {
+		it, ok := li.(vocab.Item)
+		if !ok || vocab.IsNil(it) {
+			continue
+		}
+		i := Item{}
+		if err := i.FromActivityPub(it); err == nil {
+			items = append(items, i)
+		}
+	}
+	if items, err = r.loadItemsAuthors(context.Background(), items...); err != nil {
+		r.errFn(log.Ctx{"err": err.Error()})("unable to load the authors for the search index")
+	}
+	s.Add(items...)
+}
+
+// Add indexes the items, replacing the previous versions we had of them
+func (s *searchIndex) Add(items ...Item) {
+	if s == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, it := range items {
+		if vocab.IsNil(it.Pub) {
+			continue
+		}
+		iri := it.Pub.GetLink()
+		s.remove(iri)
+		if it.Deleted() || it.Private() || isPollAnswer(it) {
+			continue
+		}
+		doc := searchDocFromItem(it)
+		s.docs[iri] = doc
+		for _, w := range strings.Fields(doc.text) {
+			if _, ok := s.terms[w]; !ok {
+				s.terms[w] = make(map[vocab.IRI]struct{})
+			}
+			s.terms[w][iri] = struct{}{}
+		}
+	}
+	s.evict()
+}
+
+// evict drops the oldest items once the index holds more than its size. It goes down to nine tenths
+// of the size, so the following additions don't need to do it again.
+func (s *searchIndex) evict() {
+	if s.size <= 0 || len(s.docs) <= s.size {
+		return
+	}
+	iris := make(vocab.IRIs, 0, len(s.docs))
+	for iri := range s.docs {
+		iris = append(iris, iri)
+	}
+	sort.Slice(iris, func(i, j int) bool {
+		return s.docs[iris[i]].published.Before(s.docs[iris[j]].published)
+	})
+	for _, iri := range iris[:len(iris)-s.size*9/10] {
+		s.remove(iri)
+	}
+}
+
+func (s *searchIndex) remove(iri vocab.IRI) {
+	doc, ok := s.docs[iri]
+	if !ok {
+		return
+	}
+	for _, w := range strings.Fields(doc.text) {
+		delete(s.terms[w], iri)
+		if len(s.terms[w]) == 0 {
+			delete(s.terms, w)
+		}
+	}
+	delete(s.docs, iri)
+}
+
+// Search returns the IRIs of the items matching q, newest first
+func (s *searchIndex) Search(q searchQuery) vocab.IRIs {
+	if s == nil || q.IsEmpty() {
+		return nil
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	var candidates map[vocab.IRI]struct{}
+	for _, w := range q.words() {
+		next := make(map[vocab.IRI]struct{})
+		for iri := range s.terms[w] {
+			if _, ok := candidates[iri]; candidates == nil || ok {
+				next[iri] = struct{}{}
+			}
+		}
+		if candidates = next; len(candidates) == 0 {
+			return nil
+		}
+	}
+
+	result := make(vocab.IRIs, 0)
+	match := func(iri vocab.IRI) {
+		if doc, ok := s.docs[iri]; ok && doc.matches(q) {
+			result = append(result, iri)
+		}
+	}
+	if candidates == nil {
+		for iri := range s.docs {
+			match(iri)
+		}
+	} else {
+		for iri := range candidates {
+			match(iri)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return s.docs[result[i]].published.After(s.docs[result[j]].published)
+	})
+	return result
+}
+
+// SearchMw loads the items matching the "q" parameter of the request from the search index
+func SearchMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if m := ContextListingModel(r.Context()); m != nil {
+			m.tpl = "search"
+			m.Title = "Search"
+			if query != "" {
+				m.Title = htmlf(`Search results for "%s"`, template.HTMLEscapeString(query))
+			}
+		}
+		repo := ContextRepository(r.Context())
+		iris := repo.search.Search(parseSearchQuery(query))
+		page, prev, nxt, _ := pageIRIs(iris, r.URL.Query().Get(keyAfter), r.URL.Query().Get(keyBefore), MaxContentItems)
+
+		d := ContextDependentLoads(r.Context())
+		if d == nil {
+			d = &deps{}
+		}
+		c, err := repo.loadIRIs(r.Context(), *d, page)
+		if err != nil {
+			ctxtErr(next, w, r, err)
+			return
+		}
+		c.after, c.before = nxt, prev
+		c.items = reparentRenderables(c.items)
+
+		ctx := context.WithValue(r.Context(), CursorCtxtKey, &c)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
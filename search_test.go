@@ -0,0 +1,156 @@
+package brutalinks
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/google/uuid"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		want searchQuery
+	}{
+		{
+			name: "empty",
+			q:    "  ",
+			want: searchQuery{},
+		},
+		{
+			name: "words",
+			q:    "Hello, World",
+			want: searchQuery{terms: []string{"hello", "world"}},
+		},
+		{
+			name: "phrase",
+			q:    `go "the  Quick fox" jumps`,
+			want: searchQuery{terms: []string{"go", "jumps"}, phrases: []string{"the quick fox"}},
+		},
+		{
+			name: "unterminated phrase",
+			q:    `"lazy dog`,
+			want: searchQuery{phrases: []string{"lazy dog"}},
+		},
+		{
+			name: "qualifiers",
+			q:    "author:~Marius tag:#Go domain:www.Example.com type:comment",
+			want: searchQuery{author: "marius", tag: "go", domain: "example.com", typ: searchTypeComment},
+		},
+		{
+			name: "invalid qualifiers are searched as words",
+			q:    "type:image after:yesterday",
+			want: searchQuery{terms: []string{"type", "image", "after", "yesterday"}},
+		},
+		{
+			name: "date range",
+			q:    "date:2023-01..2023-03",
+			want: searchQuery{
+				since: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+				until: time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "single date",
+			q:    "date:2023-05-06",
+			want: searchQuery{
+				since: time.Date(2023, 5, 6, 0, 0, 0, 0, time.UTC),
+				until: time.Date(2023, 5, 7, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "after and before",
+			q:    "after:2022 before:2023-02-01",
+			want: searchQuery{
+				since: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				until: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSearchQuery(tt.q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSearchQuery(%q) = %#v, want %#v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	now := time.Now().UTC()
+	jdoe := &Account{Handle: "jdoe"}
+	item := func(i int, title, content string, age time.Duration) Item {
+		return Item{
+			Hash:        Hash(uuid.New()),
+			Title:       title,
+			Data:        content,
+			SubmittedBy: jdoe,
+			SubmittedAt: now.Add(-age),
+			Pub:         &vocab.Object{ID: vocab.IRI(fmt.Sprintf("https://brutalinks.git/objects/%d", i))},
+		}
+	}
+	older := item(1, "Go generics", "type parameters in practice", 2*time.Hour)
+	newer := item(2, "Rust traits", "generics and traits", time.Hour)
+	deleted := item(3, "Deleted generics", "", time.Minute)
+	deleted.Delete()
+	// the answer to a poll only has the name of the option it chose
+	answer := item(4, "generics", "", time.Minute)
+	answer.Parent = &newer
+
+	idx := searchIndexNew(0)
+	idx.Add(older, newer, deleted, answer)
+
+	tests := []struct {
+		query string
+		want  vocab.IRIs
+	}{
+		{query: "generics", want: vocab.IRIs{newer.Pub.GetLink(), older.Pub.GetLink()}},
+		{query: "go generics", want: vocab.IRIs{older.Pub.GetLink()}},
+		{query: `"type parameters"`, want: vocab.IRIs{older.Pub.GetLink()}},
+		{query: "author:jdoe traits", want: vocab.IRIs{newer.Pub.GetLink()}},
+		{query: "author:alice generics"},
+		{query: "missing"},
+		{query: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := idx.Search(parseSearchQuery(tt.query)); !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("updated item", func(t *testing.T) {
+		changed := older
+		changed.Title = "Go iterators"
+		idx.Add(changed)
+		if got := idx.Search(parseSearchQuery("go generics")); len(got) != 0 {
+			t.Errorf("Search() still returns the previous version of the item: %v", got)
+		}
+	})
+}
+
+func TestSearchIndexSize(t *testing.T) {
+	now := time.Now().UTC()
+	idx := searchIndexNew(10)
+	for i := 0; i < 11; i++ {
+		idx.Add(Item{
+			Hash:        Hash(uuid.New()),
+			Title:       "item",
+			SubmittedAt: now.Add(time.Duration(i) * time.Minute),
+			Pub:         &vocab.Object{ID: vocab.IRI(fmt.Sprintf("https://brutalinks.git/objects/%d", i))},
+		})
+	}
+	got := idx.Search(parseSearchQuery("item"))
+	if len(got) != 9 {
+		t.Fatalf("Search() returned %d items from an index of size 10, want 9 after dropping the oldest", len(got))
+	}
+	if got[0] != "https://brutalinks.git/objects/10" || got[8] != "https://brutalinks.git/objects/2" {
+		t.Errorf("Search() kept the wrong items: %v", got)
+	}
+}
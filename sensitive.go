@@ -0,0 +1,228 @@
+package brutalinks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const (
+	// sensitiveLoadTimeout is how long we wait for the document of a remote object, when loading its sensitive flag
+	sensitiveLoadTimeout = 5 * time.Second
+	// sensitiveLoadWorkers is how many remote documents we load at the same time
+	sensitiveLoadWorkers = 4
+	// sensitiveRetryInterval is how long we wait before loading again a remote document which failed to load
+	sensitiveRetryInterval = time.Hour
+	// sensitiveMaxDocumentSize is the largest remote document we read
+	sensitiveMaxDocumentSize = 1 << 20
+)
+
+// sensitiveStore keeps the "sensitive" property of the objects, which Mastodon and the software compatible with it
+// use for hiding the content of an object behind its summary.
+// The property is not part of the ActivityStreams vocabulary and the storage drops it when decoding the objects,
+// so we keep it in a "sensitive.json" file: for the local objects when they are saved, and for the remote ones
+// after loading their original document once.
+type sensitiveStore struct {
+	m      sync.RWMutex
+	path   string
+	flags  map[vocab.IRI]bool
+	failed map[vocab.IRI]time.Time
+	c      *http.Client
+	ua     string
+}
+
+// sensitiveStoreNew returns a store saving the flags in a "sensitive.json" file next to the storage at path
+func sensitiveStoreNew(path, ua string) *sensitiveStore {
+	dialer := &net.Dialer{Timeout: sensitiveLoadTimeout, Control: publicAddressOnly}
+	s := &sensitiveStore{
+		path:   filepath.Join(storageDir(path), "sensitive.json"),
+		flags:  make(map[vocab.IRI]bool),
+		failed: make(map[vocab.IRI]time.Time),
+		c: &http.Client{
+			Timeout:   sensitiveLoadTimeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: sensitiveLoadTimeout},
+		},
+		ua: ua,
+	}
+	_ = loadJSONFile(s.path, &s.flags)
+	return s
+}
+
+// Get returns the sensitive flag of the object with iri, and if we know it
+func (s *sensitiveStore) Get(iri vocab.IRI) (bool, bool) {
+	if s == nil {
+		return false, false
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	sensitive, ok := s.flags[iri]
+	return sensitive, ok
+}
+
+// Set stores the sensitive flags of the objects with the IRIs in flags
+func (s *sensitiveStore) Set(flags map[vocab.IRI]bool) error {
+	if s == nil {
+		return errors.NotImplementedf("sensitive flags are not available")
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for iri, sensitive := range flags {
+		s.flags[iri] = sensitive
+		delete(s.failed, iri)
+	}
+	return saveJSONFile(s.path, s.flags)
+}
+
+// retry returns false if loading the document of the object with iri failed recently
+func (s *sensitiveStore) retry(iri vocab.IRI, now time.Time) bool {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	failedAt, ok := s.failed[iri]
+	return !ok || now.Sub(failedAt) > sensitiveRetryInterval
+}
+
+// Load loads the original document of the remote object with iri, and returns its sensitive flag
+func (s *sensitiveStore) Load(ctx context.Context, iri vocab.IRI) (bool, error) {
+	sensitive, err := s.load(ctx, iri)
+	if err != nil {
+		s.m.Lock()
+		s.failed[iri] = time.Now()
+		s.m.Unlock()
+	}
+	return sensitive, err
+}
+
+func (s *sensitiveStore) load(ctx context.Context, iri vocab.IRI) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, iri.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", MimeTypeActivityJSON)
+	req.Header.Set("User-Agent", s.ua)
+	resp, err := s.c.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return false, errors.Newf("unable to load %s: %s", iri, resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, sensitiveMaxDocumentSize))
+	if err != nil {
+		return false, err
+	}
+	return documentSensitive(raw)
+}
+
+// documentSensitive returns the value of the "sensitive" property of the raw JSON document of an object
+func documentSensitive(raw []byte) (bool, error) {
+	doc := struct {
+		Sensitive bool `json:"sensitive"`
+	}{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return false, err
+	}
+	return doc.Sensitive, nil
+}
+
+// applySensitive marks it as sensitive, and uses the summary of its object as its content warning
+func applySensitive(it *Item, sensitive bool) {
+	if it.Metadata == nil {
+		it.Metadata = &ItemMetadata{}
+	}
+	it.Metadata.Sensitive = sensitive
+	it.Metadata.ContentWarning = ""
+	if !sensitive {
+		return
+	}
+	_ = vocab.OnObject(it.AP(), func(o *vocab.Object) error {
+		if len(o.Summary) > 0 {
+			it.Metadata.ContentWarning = bluemonday.StrictPolicy().Sanitize(o.Summary.First().String())
+		}
+		return nil
+	})
+}
+
+// loadItemsSensitive sets the sensitive flag of items from the store.
+// The flags of the remote objects we don't know yet are loaded from their original documents, and stored.
+func (r *repository) loadItemsSensitive(ctx context.Context, items ...Item) ItemCollection {
+	if r.sensitive == nil {
+		return items
+	}
+	now := time.Now()
+	unknown := make(vocab.IRIs, 0)
+	for k := range items {
+		ob := items[k].AP()
+		if vocab.IsNil(ob) || items[k].Deleted() {
+			continue
+		}
+		iri := ob.GetLink()
+		if sensitive, ok := r.sensitive.Get(iri); ok {
+			applySensitive(&items[k], sensitive)
+			continue
+		}
+		if !HostIsLocal(iri.String()) && r.sensitive.retry(iri, now) {
+			_ = unknown.Append(iri)
+		}
+	}
+	if len(unknown) == 0 {
+		return items
+	}
+
+	loaded := make(map[vocab.IRI]bool, len(unknown))
+	m := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	queue := make(chan vocab.IRI)
+	for i := 0; i < sensitiveLoadWorkers && i < len(unknown); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for iri := range queue {
+				sensitive, err := r.sensitive.Load(ctx, iri)
+				if err != nil {
+					r.errFn(log.Ctx{"err": err.Error(), "iri": iri})("unable to load the sensitive flag")
+					continue
+				}
+				m.Lock()
+				loaded[iri] = sensitive
+				m.Unlock()
+			}
+		}()
+	}
+	for _, iri := range unknown {
+		queue <- iri
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := r.sensitive.Set(loaded); err != nil {
+		r.errFn(log.Ctx{"err": err.Error()})("unable to save the sensitive flags")
+	}
+	for k := range items {
+		ob := items[k].AP()
+		if vocab.IsNil(ob) {
+			continue
+		}
+		if sensitive, ok := loaded[ob.GetLink()]; ok {
+			applySensitive(&items[k], sensitive)
+		}
+	}
+	return items
+}
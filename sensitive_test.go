@@ -0,0 +1,116 @@
+package brutalinks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+)
+
+func TestDocumentSensitive(t *testing.T) {
+	tests := map[string]struct {
+		raw     string
+		want    bool
+		wantErr bool
+	}{
+		"sensitive without summary": {raw: `{"id":"https://mastodon.example/notes/1","type":"Note","sensitive":true}`, want: true},
+		"summary without sensitive": {raw: `{"id":"https://mastodon.example/notes/2","type":"Note","summary":"spoilers"}`, want: false},
+		"not sensitive":             {raw: `{"id":"https://mastodon.example/notes/3","type":"Note","sensitive":false}`, want: false},
+		"invalid document":          {raw: `<html></html>`, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := documentSensitive([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("documentSensitive() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("documentSensitive() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySensitive(t *testing.T) {
+	summary := vocab.DefaultNaturalLanguage("spoilers")
+	tests := map[string]struct {
+		ob        *vocab.Object
+		sensitive bool
+		wantCW    string
+	}{
+		"sensitive with summary": {
+			ob:        &vocab.Object{ID: "https://mastodon.example/notes/1", Type: vocab.NoteType, Summary: summary},
+			sensitive: true,
+			wantCW:    "spoilers",
+		},
+		"sensitive without summary": {
+			ob:        &vocab.Object{ID: "https://mastodon.example/notes/2", Type: vocab.NoteType},
+			sensitive: true,
+		},
+		"summary of an object which is not sensitive": {
+			ob: &vocab.Object{ID: "https://blog.example/articles/1", Type: vocab.ArticleType, Summary: summary},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			it := Item{Pub: tt.ob}
+			applySensitive(&it, tt.sensitive)
+			if it.Metadata.Sensitive != tt.sensitive {
+				t.Errorf("applySensitive() sensitive = %t, want %t", it.Metadata.Sensitive, tt.sensitive)
+			}
+			if it.Metadata.ContentWarning != tt.wantCW {
+				t.Errorf("applySensitive() content warning = %q, want %q", it.Metadata.ContentWarning, tt.wantCW)
+			}
+		})
+	}
+}
+
+func TestSensitiveStore(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/notes/1":
+			_, _ = w.Write([]byte(`{"type":"Note","sensitive":true}`))
+		case "/notes/gone":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	path := t.TempDir()
+	s := sensitiveStoreNew(path, "brutalinks-test")
+	s.c = srv.Client()
+
+	sensitive, err := s.Load(context.Background(), vocab.IRI(srv.URL+"/notes/1"))
+	if err != nil || !sensitive {
+		t.Errorf("Load() = %t, %v, want the sensitive flag of the document", sensitive, err)
+	}
+	if sensitive, err = s.Load(context.Background(), vocab.IRI(srv.URL+"/notes/gone")); err != nil || sensitive {
+		t.Errorf("Load() = %t, %v, want a deleted object not to be sensitive", sensitive, err)
+	}
+	failing := vocab.IRI(srv.URL + "/notes/error")
+	if _, err = s.Load(context.Background(), failing); err == nil {
+		t.Errorf("Load() expected an error for a failing server")
+	}
+	if s.retry(failing, time.Now()) {
+		t.Errorf("retry() = true right after loading the document failed")
+	}
+	if !s.retry(failing, time.Now().Add(sensitiveRetryInterval+time.Second)) {
+		t.Errorf("retry() = false after the retry interval")
+	}
+
+	iri := vocab.IRI("https://fedbox.git/objects/1")
+	if err = s.Set(map[vocab.IRI]bool{iri: true}); err != nil {
+		t.Fatalf("Set() error = %s", err)
+	}
+	if sensitive, ok := sensitiveStoreNew(path, "").Get(iri); !ok || !sensitive {
+		t.Errorf("Get() = %t, %t after reloading the store, want the saved flag", sensitive, ok)
+	}
+	if _, ok := s.Get("https://fedbox.git/objects/2"); ok {
+		t.Errorf("Get() returned a flag for an unknown object")
+	}
+}
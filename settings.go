@@ -0,0 +1,251 @@
+package brutalinks
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	"github.com/go-ap/errors"
+)
+
+// AccountSettings are the preferences of a local account
+type AccountSettings struct {
+	// ExpandContentWarnings shows the items with a content warning without the need to reveal them
+	ExpandContentWarnings bool `json:"expandContentWarnings,omitempty"`
+	// Languages are the languages the account prefers to read, the listings show the items in them first
+	Languages []string `json:"languages,omitempty"`
+	// HideOtherLanguages removes from the listings the items that are not in one of the preferred languages
+	HideOtherLanguages bool `json:"hideOtherLanguages,omitempty"`
+	// NotificationsReadAt is when the account last marked its notifications as read
+	NotificationsReadAt time.Time `json:"notificationsReadAt,omitempty"`
+	// ConversationsReadAt is when the account last marked its private conversations as read
+	ConversationsReadAt time.Time `json:"conversationsReadAt,omitempty"`
+	// Email is the address where the account receives the emails it chose
+	Email string `json:"email,omitempty"`
+	// EmailConfirmed is true after the account visited the link we emailed to its address
+	EmailConfirmed bool `json:"emailConfirmed,omitempty"`
+	// EmailConfirmation is the hash of the token in the link for confirming the address
+	EmailConfirmation string `json:"emailConfirmation,omitempty"`
+	// Emails are the kinds of emails the account wants to receive
+	Emails []string `json:"emails,omitempty"`
+	// Digest is how often the account receives the digest emails: daily, weekly, or never when it's empty
+	Digest string `json:"digest,omitempty"`
+	// DigestSentAt is when the last digest was sent to the account
+	DigestSentAt time.Time `json:"digestSentAt,omitempty"`
+	// PasswordReset is the hash of the token sent in the last password reset email
+	PasswordReset string `json:"passwordReset,omitempty"`
+	// PasswordResetExpires is when the password reset token stops being valid
+	PasswordResetExpires time.Time `json:"passwordResetExpires,omitempty"`
+}
+
+// settingsStore keeps the settings of the local accounts in JSON files, one for each account
+type settingsStore struct {
+	m     sync.RWMutex
+	path  string
+	cache map[Hash]AccountSettings
+}
+
+// settingsStoreNew returns a store saving the settings in a "settings" folder next to the storage at path
+func settingsStoreNew(path string) *settingsStore {
+	return &settingsStore{
+		path:  filepath.Join(storageDir(path), "settings"),
+		cache: make(map[Hash]AccountSettings),
+	}
+}
+
+func (s *settingsStore) file(h Hash) string {
+	return filepath.Join(s.path, h.String()+".json")
+}
+
+// Load returns the settings of a, or the default ones if the account didn't save any
+func (s *settingsStore) Load(a *Account) (AccountSettings, error) {
+	st := AccountSettings{}
+	if s == nil || !a.IsLogged() {
+		return st, nil
+	}
+	s.m.RLock()
+	st, ok := s.cache[a.Hash]
+	s.m.RUnlock()
+	if ok {
+		return st, nil
+	}
+
+	if err := loadJSONFile(s.file(a.Hash), &st); err != nil {
+		return st, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	// the settings could have been updated while we were loading them
+	if cached, ok := s.cache[a.Hash]; ok {
+		return cached, nil
+	}
+	s.cache[a.Hash] = st
+	return st, nil
+}
+
+// Save stores the settings of a
+func (s *settingsStore) Save(a *Account, st AccountSettings) error {
+	if s == nil {
+		return errors.NotImplementedf("settings are not available")
+	}
+	if !a.IsLogged() {
+		return errors.Unauthorizedf("invalid account")
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := saveJSONFile(s.file(a.Hash), st); err != nil {
+		return err
+	}
+	s.cache[a.Hash] = st
+	return nil
+}
+
+// Update changes the settings of a with fn while holding the lock, so it doesn't overwrite what was saved since
+// the caller loaded them. The settings are saved only if fn returns true.
+func (s *settingsStore) Update(a *Account, fn func(*AccountSettings) bool) (AccountSettings, error) {
+	st := AccountSettings{}
+	if s == nil {
+		return st, errors.NotImplementedf("settings are not available")
+	}
+	if !a.IsLogged() {
+		return st, errors.Unauthorizedf("invalid account")
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	st, ok := s.cache[a.Hash]
+	if !ok {
+		if err := loadJSONFile(s.file(a.Hash), &st); err != nil {
+			return st, err
+		}
+	}
+	if !fn(&st) {
+		return st, nil
+	}
+	if err := saveJSONFile(s.file(a.Hash), st); err != nil {
+		return st, err
+	}
+	s.cache[a.Hash] = st
+	return st, nil
+}
+
+// Hashes returns the hashes of the accounts which saved their settings
+func (s *settingsStore) Hashes() ([]Hash, error) {
+	if s == nil {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	hashes := make([]Hash, 0, len(entries))
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok {
+			continue
+		}
+		if h := HashFromString(name); h.IsValid() {
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes, nil
+}
+
+// accountSettings returns the settings of the a account, using the repository from the request
+func accountSettings(r *http.Request, a *Account) AccountSettings {
+	repo := ContextRepository(r.Context())
+	if repo == nil {
+		return AccountSettings{}
+	}
+	st, err := repo.settings.Load(a)
+	if err != nil {
+		repo.errFn(log.Ctx{"err": err.Error(), "account": a.Handle})("unable to load account settings")
+	}
+	return st
+}
+
+type settingsModel struct {
+	Title    template.HTML
+	Settings AccountSettings
+}
+
+func (m *settingsModel) SetTitle(s string) {
+	m.Title = template.HTML(s)
+}
+
+func (settingsModel) Template() string {
+	return "settings"
+}
+
+func (*settingsModel) SetCursor(c *Cursor) {}
+
+// SettingsModelMw loads the settings of the logged account
+func SettingsModelMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := &settingsModel{
+			Title:    "Settings",
+			Settings: accountSettings(r, loggedAccount(r)),
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ModelCtxtKey, m)))
+	})
+}
+
+// HandleSettings saves the settings of the logged account
+func (h *handler) HandleSettings(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	addr := ""
+	if email := strings.TrimSpace(r.PostFormValue("email")); email != "" && h.conf.MailEnabled() {
+		var err error
+		if addr, err = validEmail(email); err != nil {
+			h.v.addFlashMessage(Error, w, r, "The email address is not valid.")
+			h.v.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+	}
+	// the settings which are not in the form, like the tokens we emailed, are kept as they were saved
+	confirm := ""
+	st, err := h.storage.settings.Update(acc, func(st *AccountSettings) bool {
+		st.ExpandContentWarnings = r.PostFormValue("expand-cw") != ""
+		st.Languages = languagesFromRequest(r.PostForm["lang"])
+		st.HideOtherLanguages = r.PostFormValue("hide-other-languages") != "" && len(st.Languages) > 0
+		if !h.conf.MailEnabled() {
+			return true
+		}
+		if addr != st.Email {
+			st.Email, st.EmailConfirmed, st.EmailConfirmation = addr, false, ""
+			if addr != "" {
+				confirm = newEmailConfirmation(st)
+			}
+		}
+		st.Emails = emailsFromRequest(r.PostForm["emails"])
+		st.Digest = ""
+		if d := r.PostFormValue("digest"); digestIntervals[d] > 0 {
+			st.Digest = d
+		}
+		return true
+	})
+	if err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to save account settings")
+		h.v.addFlashMessage(Error, w, r, "Unable to save the settings.")
+	} else if confirm != "" {
+		if err = h.storage.SendEmailConfirmation(acc, st, confirm); err != nil {
+			h.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to send email confirmation")
+			h.v.addFlashMessage(Warning, w, r, "The settings have been saved, but we were unable to email the confirmation link.")
+		} else {
+			h.v.addFlashMessage(Success, w, r, "The settings have been saved. Visit the link we emailed you to confirm the address.")
+		}
+	} else {
+		h.v.addFlashMessage(Success, w, r, "The settings have been saved.")
+	}
+	h.v.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
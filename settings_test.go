@@ -0,0 +1,57 @@
+package brutalinks
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSettingsStoreUpdate(t *testing.T) {
+	path := t.TempDir()
+	s := settingsStoreNew(path)
+	acc := &Account{Hash: Hash(uuid.New()), Handle: "jdoe"}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = s.Update(acc, func(st *AccountSettings) bool {
+			st.DigestSentAt = now
+			return true
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = s.Update(acc, func(st *AccountSettings) bool {
+			st.NotificationsReadAt = now
+			return true
+		})
+	}()
+	wg.Wait()
+
+	// a new store loads the settings from the file
+	st, err := settingsStoreNew(path).Load(acc)
+	if err != nil {
+		t.Fatalf("Load() error = %s", err)
+	}
+	if !st.DigestSentAt.Equal(now) || !st.NotificationsReadAt.Equal(now) {
+		t.Errorf("Update() lost one of the concurrent changes: %+v", st)
+	}
+
+	_, err = s.Update(acc, func(st *AccountSettings) bool {
+		st.Email = "jdoe@example.com"
+		return false
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %s", err)
+	}
+	if st, _ = s.Load(acc); st.Email != "" {
+		t.Errorf("Update() saved the settings when the change was refused")
+	}
+	if _, err = s.Update(&AnonymousAccount, func(*AccountSettings) bool { return true }); err == nil {
+		t.Errorf("Update() expected an error for an account which is not logged in")
+	}
+}
@@ -88,6 +88,7 @@ func ViewInit(c appConfig, l log.Logger) (*view, error) {
 			"replaceTags":       replaceTags,
 			"outputTag":         renderTag,
 			"AccountLocalLink":  AccountLocalLink,
+			"GroupLink":         GroupLink,
 			"ShowAccountHandle": ShowAccountHandle,
 			"PermaLink":         PermaLink,
 			"ParentLink":        parentLink,
@@ -108,6 +109,8 @@ func ViewInit(c appConfig, l log.Logger) (*view, error) {
 			"NextPageLink":      nextPageLink,
 			"PrevPageLink":      prevPageLink,
 			"CanPaginate":       canPaginate,
+			"HasFeeds":          hasFeeds,
+			"Sortable":          sortable,
 			"Config":            func() config.Configuration { return *v.c },
 			"Version":           func() string { return v.c.Version },
 			"Name":              appName,
@@ -130,6 +133,8 @@ func ViewInit(c appConfig, l log.Logger) (*view, error) {
 			"GetDomainLinks":    GetDomainLinks,
 			"invitationLink":    GetInviteLink(v),
 			"accountJSON":       renderableMarshalJSON(v.errFn()),
+			"ContentLanguages":  func() []ContentLanguage { return contentLanguages },
+			"LanguageName":      LanguageName,
 			//"ScoreFmt":          func(i int64) string { return humanize.FormatInteger("#\u202F###", int(i)) },
 			//"NumberFmt":         func(i int64) string { return humanize.FormatInteger("#\u202F###", int(i)) },
 		}},
@@ -275,12 +280,21 @@ func (v *view) RenderTemplate(r *http.Request, w http.ResponseWriter, name strin
 		"AccountIsBlocked":      func(a *Account) bool { return AccountIsBlocked(accountFromRequest(), a) },
 		"AccountIsReported":     func(a *Account) bool { return AccountIsReported(accountFromRequest(), a) },
 		"ItemReported":          func(i *Item) bool { return ItemIsReported(accountFromRequest(), i) },
+		"ItemSaved":             savedItems(acc),
+		"ModeratedGroups":       moderatedGroups(ContextRepository(r.Context()), acc),
+		"AccountSettings":       func() AccountSettings { return accountSettings(r, accountFromRequest()) },
+		"UnreadNotifications":   func() int { return unreadNotifications(r, accountFromRequest()) },
 		// Model related functions
 		"showChildren": showChildren(m),
 		"ShowText":     showText(m),
 		"ShowTitle":    showTitle(m),
 		"Sort":         sortModel(m),
 		"PageID":       v.GetCurrentPageID(m, r),
+		"FeedLink":     func(typ string) string { return feedLink(r, typ) },
+		"NextPageLink": func(p vocab.IRI) template.HTML { return pageLinkWithQuery(r, nextPageLink(p)) },
+		"PrevPageLink": func(p vocab.IRI) template.HTML { return pageLinkWithQuery(r, prevPageLink(p)) },
+		"SortLink":     func(name string) template.HTML { return sortLink(r, name) },
+		"TopLink":      func(window string) string { return topLink(r, window) },
 	}
 
 	if !isError {
@@ -562,7 +576,7 @@ func CurrentTab(r *http.Request) func(h headerEl) bool {
 }
 
 func headerMenu(r *http.Request) []headerEl {
-	sections := []string{"/self", "/federated", "/followed", "submit"}
+	sections := []string{"/self", "/federated", "/g", "/followed", "submit"}
 	ret := make([]headerEl, 0)
 	for _, s := range sections {
 		el := headerEl{
@@ -575,6 +589,8 @@ func headerMenu(r *http.Request) []headerEl {
 			el.Icon = []string{"home"}
 		case "/federated":
 			el.Icon = []string{"activitypub"}
+		case "/g":
+			el.Icon = []string{"users"}
 		case "/followed":
 			el.Icon = []string{"star"}
 			el.Auth = true
@@ -936,6 +952,51 @@ func prevPageLink(p vocab.IRI) template.HTML {
 	return ""
 }
 
+// pageLinkWithQuery keeps the ranking and the search query chosen by the user when moving between pages
+func pageLinkWithQuery(r *http.Request, link template.HTML) template.HTML {
+	if link == "" {
+		return link
+	}
+	q := url.Values{}
+	for _, k := range []string{"q", "sort"} {
+		if v := r.URL.Query().Get(k); v != "" {
+			q.Set(k, v)
+		}
+	}
+	if len(q) == 0 {
+		return link
+	}
+	return link + template.HTML("&"+q.Encode())
+}
+
+func sortLink(r *http.Request, name string) template.HTML {
+	q := r.URL.Query()
+	q.Set("sort", name)
+	// the pagination cursors belong to the previous order
+	q.Del(keyAfter)
+	q.Del(keyBefore)
+	return template.HTML(r.URL.Path + "?" + q.Encode())
+}
+
+// topLink returns the path of the top listing for the time window corresponding to the current page
+func topLink(r *http.Request, window string) string {
+	p := strings.TrimSuffix(r.URL.Path, "/top")
+	if i := strings.LastIndex(p, "/top/"); i >= 0 {
+		p = p[:i]
+	}
+	return strings.TrimRight(p, "/") + "/top/" + window
+}
+
+func sortable(m any) bool {
+	switch mm := m.(type) {
+	case *listingModel:
+		return mm.sortName != ""
+	case *contentModel:
+		return mm.sortName != "" && mm.tpl == "content"
+	}
+	return false
+}
+
 func canPaginate(m interface{}) bool {
 	_, ok := m.(Paginator)
 	return ok
@@ -1280,8 +1341,8 @@ func GetDomainLinks(i Item) Links {
 	domain := domainLink{Name: template.HTML(puny.ToUnicode(u.Host)), Href: "/" + template.HTMLAttr(u.Host)}
 	maybeUser := pathEl[0]
 	var pathLink domainLink
-	switch u.Host {
-	case redditDomain, "www." + redditDomain, "old." + redditDomain:
+	switch strings.TrimPrefix(canonicalHost(u.Host), "www.") {
+	case redditDomain:
 		if len(pathEl) >= 2 {
 			subreddit := path.Join(pathEl[:2]...)
 			if redditValidSubreddit(subreddit) {
@@ -1291,28 +1352,28 @@ func GetDomainLinks(i Item) Links {
 				}
 			}
 		}
-	case twitterDomain, "www." + twitterDomain:
+	case twitterDomain:
 		if twitterValidUser(maybeUser) {
 			pathLink = domainLink{
 				Name: template.HTML(maybeUser),
 				Href: template.HTMLAttr("/" + url.PathEscape(path.Join(u.Host, maybeUser))),
 			}
 		}
-	case gitlabDomain, "www." + gitlabDomain:
+	case gitlabDomain:
 		if gitlabValidUser(maybeUser) {
 			pathLink = domainLink{
 				Name: template.HTML(maybeUser),
 				Href: template.HTMLAttr("/" + url.PathEscape(path.Join(u.Host, maybeUser))),
 			}
 		}
-	case githubDomain, "www." + githubDomain:
+	case githubDomain:
 		if githubValidUser(maybeUser) {
 			pathLink = domainLink{
 				Name: template.HTML(maybeUser),
 				Href: template.HTMLAttr("/" + url.PathEscape(path.Join(u.Host, maybeUser))),
 			}
 		}
-	case twitchDomain, "www." + twitchDomain:
+	case twitchDomain:
 		if twitchValidUser(maybeUser) {
 			pathLink = domainLink{
 				Name: template.HTML(maybeUser),
@@ -1344,18 +1405,24 @@ func GetDomainLinks(i Item) Links {
 	return Links{domain, pathLink}
 }
 
+// invitationMessage returns the subject and the body of the message inviting someone to register the invitee account
+func invitationMessage(hostName string, invitee *Account) (string, string) {
+	u := fmt.Sprintf("%s/register/%s", Instance.BaseURL.String(), invitee.Hash)
+	handle := invitee.CreatedBy.Handle
+	// @todo(marius): :link_generation:
+	bodyFmt := "Hello,\n\nThis is an invitation to join %s.\n\nTo accept this invitation and create an account, visit the URL below: %s\n\n/%s"
+	return fmt.Sprintf("You are invited to join %s", hostName), fmt.Sprintf(bodyFmt, Instance.BaseURL.String(), u, handle)
+}
+
 func GetInviteLink(v *view) func(invitee *Account) template.HTMLAttr {
 	return func(invitee *Account) template.HTMLAttr {
-		u := fmt.Sprintf("%s/register/%s", Instance.BaseURL.String(), invitee.Hash)
-		handle := invitee.CreatedBy.Handle
-		// @todo(marius): :link_generation:
-		bodyFmt := "Hello,\n\nThis is an invitation to join %s.\n\nTo accept this invitation and create an account, visit the URL below: %s\n\n/%s"
+		subject, body := invitationMessage(v.c.HostName, invitee)
 		mailContent := struct {
 			Subject string `qstring:"subject"`
 			Body    string `qstring:"body"`
 		}{
-			Subject: fmt.Sprintf("You are invited to join %s", v.c.HostName),
-			Body:    fmt.Sprintf(bodyFmt, Instance.BaseURL.String(), u, handle),
+			Subject: subject,
+			Body:    body,
 		}
 		q, _ := qstring.Marshal(&mailContent)
 		// NOTE(marius): acceptable to hardcode replacing '+' to '%20' as we don't have any standalone ones in the message
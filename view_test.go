@@ -0,0 +1,30 @@
+package brutalinks
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSortLink(t *testing.T) {
+	tests := []struct {
+		url  string
+		name string
+		want template.HTML
+	}{
+		{url: "/", name: SortNew, want: "/?sort=new"},
+		{url: "/?sort=hot", name: SortTop, want: "/?sort=top"},
+		{url: "/search?q=go&lang=de", name: SortWilson, want: "/search?lang=de&q=go&sort=wilson"},
+		{url: "/~jdoe?after=abc&sort=hot", name: SortNew, want: "/~jdoe?sort=new"},
+		{url: "/t/music?before=abc&lang=en", name: SortActive, want: "/t/music?lang=en&sort=active"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if got := sortLink(r, tt.name); got != tt.want {
+				t.Errorf("sortLink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
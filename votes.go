@@ -24,6 +24,8 @@ type VoteCollection []Vote
 type VoteMetadata struct {
 	IRI         string `json:"-"`
 	OriginalIRI string `json:"-"`
+	// AnnouncedBy is the IRI of the actor which announced the vote, for the votes received through a group
+	AnnouncedBy string `json:"-"`
 }
 
 type Vote struct {
@@ -115,6 +117,28 @@ func (v VoteCollection) First() (*Vote, error) {
 	return nil, errors.Errorf("empty %T", v)
 }
 
+// Ups returns the number of positive votes
+func (v VoteCollection) Ups() int {
+	ups := 0
+	for _, vot := range v {
+		if vot.Weight > 0 {
+			ups++
+		}
+	}
+	return ups
+}
+
+// Downs returns the number of negative votes
+func (v VoteCollection) Downs() int {
+	downs := 0
+	for _, vot := range v {
+		if vot.Weight < 0 {
+			downs++
+		}
+	}
+	return downs
+}
+
 // Score
 func (v VoteCollection) Score() int {
 	score := 0
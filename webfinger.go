@@ -6,11 +6,17 @@ import (
 	"fmt"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"path"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"git.sr.ht/~mariusor/brutalinks/internal/assets"
 	log "git.sr.ht/~mariusor/lw"
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
 	"github.com/go-ap/filters"
 	"github.com/writeas/go-nodeinfo"
 )
@@ -29,57 +35,146 @@ type node struct {
 }
 
 type NodeInfoResolver struct {
-	users    int
-	comments int
-	posts    int
+	sync.RWMutex
+	r              *repository
+	stop           chan struct{}
+	stopped        sync.Once
+	users          int
+	activeMonth    int
+	activeHalfYear int
+	domains        map[string]struct{}
+	comments       int
+	posts          int
 }
 
 var (
 	actorsFilter = filters.HasType(ValidActorTypes...)
 	postsFilter  = filters.All(
 		filters.HasType(ValidContentTypes...),
-		filters.Not(filters.NilInReplyTo),
+		filters.NilInReplyTo,
 	)
-	allFilter = filters.HasType(ValidContentTypes...)
+	allFilter      = filters.HasType(ValidContentTypes...)
+	activityFilter = filters.HasType(append(ValidContentManagementTypes, ValidAppreciationTypes...)...)
 )
 
-func NodeInfoResolverNew(r *repository) NodeInfoResolver {
-	n := NodeInfoResolver{}
+const (
+	activeMonth    = 30 * 24 * time.Hour
+	activeHalfYear = 180 * 24 * time.Hour
+)
+
+// NodeInfoResolverNew loads the instance statistics and, if interval is greater than zero,
+// keeps updating them in the background until Stop is called.
+func NodeInfoResolverNew(r *repository, interval time.Duration) *NodeInfoResolver {
+	n := &NodeInfoResolver{r: r, domains: make(map[string]struct{})}
 	if r == nil {
 		return n
 	}
+	n.load(time.Now().UTC())
+	if interval > 0 {
+		n.stop = make(chan struct{})
+		go n.refresh(interval)
+	}
+	return n
+}
 
-	loadFn := func(f filters.Check, fn func(int) error) error {
-		res, err := r.b.Search(f)
-		if err != nil {
-			return err
+func (n *NodeInfoResolver) refresh(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			n.load(now.UTC())
+		case <-n.stop:
+			return
 		}
-		return fn(len(res))
-	}
-
-	_ = loadFn(actorsFilter, func(cnt int) error {
-		n.users = cnt
-		return nil
-	})
-	_ = loadFn(postsFilter, func(cnt int) error {
-		n.posts = cnt
-		return nil
-	})
-	_ = loadFn(allFilter, func(cnt int) error {
-		n.comments = cnt - n.posts
-		return nil
-	})
-	return n
+	}
+}
+
+// Stop ends the background refresh of the statistics
+func (n *NodeInfoResolver) Stop() {
+	if n == nil || n.stop == nil {
+		return
+	}
+	n.stopped.Do(func() { close(n.stop) })
+}
+
+func searchItems(r *repository, f filters.Check) vocab.ItemCollection {
+	res, err := r.b.Search(f)
+	if err != nil {
+		r.errFn(log.Ctx{"err": err.Error()})("unable to load node info statistics")
+	}
+	col := make(vocab.ItemCollection, 0, len(res))
+	for _, li := range res {
+		if it, ok := li.(vocab.Item); ok {
+			col = append(col, it)
+		}
+	}
+	return col
+}
+
+// activeSince returns the number of local actors that published an activity after each of the times in since
+func activeSince(activities vocab.ItemCollection, since ...time.Time) []int {
+	active := make([]map[vocab.IRI]struct{}, len(since))
+	for i := range active {
+		active[i] = make(map[vocab.IRI]struct{})
+	}
+	for _, it := range activities {
+		_ = vocab.OnActivity(it, func(a *vocab.Activity) error {
+			if vocab.IsNil(a.Actor) || !HostIsLocal(a.Actor.GetLink().String()) {
+				return nil
+			}
+			for i, s := range since {
+				if a.Published.After(s) {
+					active[i][a.Actor.GetLink()] = struct{}{}
+				}
+			}
+			return nil
+		})
+	}
+	counts := make([]int, len(active))
+	for i, a := range active {
+		counts[i] = len(a)
+	}
+	return counts
+}
+
+// load counts the actors and the objects of the instance, and the active users from the activities of the last half year.
+// The totals are recounted on every load, so the objects that were deleted since the previous one are not included.
+func (n *NodeInfoResolver) load(now time.Time) {
+	actors := searchItems(n.r, actorsFilter)
+	posts := searchItems(n.r, postsFilter)
+	all := searchItems(n.r, allFilter)
+	activities := searchItems(n.r, filters.All(activityFilter, publishedAfter(now.Add(-activeHalfYear))))
+
+	active := activeSince(activities, now.Add(-activeMonth), now.Add(-activeHalfYear))
+
+	domains := make(map[string]struct{})
+	for _, a := range actors {
+		domains[host(a.GetLink().String())] = struct{}{}
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	n.domains = domains
+	n.users = len(actors)
+	n.posts = len(posts)
+	n.comments = len(all) - len(posts)
+	n.activeMonth = active[0]
+	n.activeHalfYear = active[1]
 }
 
-func (n NodeInfoResolver) IsOpenRegistration() (bool, error) {
+func (n *NodeInfoResolver) IsOpenRegistration() (bool, error) {
 	return Instance.Conf.UserCreatingEnabled, nil
 }
 
-func (n NodeInfoResolver) Usage() (nodeinfo.Usage, error) {
+func (n *NodeInfoResolver) Usage() (nodeinfo.Usage, error) {
+	n.RLock()
+	defer n.RUnlock()
 	u := nodeinfo.Usage{
 		Users: nodeinfo.UsageUsers{
-			Total: n.users,
+			Total:          n.users,
+			ActiveMonth:    n.activeMonth,
+			ActiveHalfYear: n.activeHalfYear,
 		},
 		LocalComments: n.comments,
 		LocalPosts:    n.posts,
@@ -87,6 +182,24 @@ func (n NodeInfoResolver) Usage() (nodeinfo.Usage, error) {
 	return u, nil
 }
 
+// Stats returns the instance statistics in the format used by the about page
+func (n *NodeInfoResolver) Stats() Stats {
+	if n == nil {
+		return Stats{}
+	}
+	n.RLock()
+	defer n.RUnlock()
+	return Stats{
+		DomainCount:    len(n.domains),
+		UserCount:      uint(n.users),
+		ActiveMonth:    uint(n.activeMonth),
+		ActiveHalfYear: uint(n.activeHalfYear),
+		PostCount:      uint(n.posts),
+		CommentCount:   uint(n.comments),
+		StatusCount:    uint(n.posts + n.comments),
+	}
+}
+
 const (
 	softwareName = "brutalinks"
 	sourceURL    = "https://git.sr.ht/~mariusor/brutalinks"
@@ -131,8 +244,8 @@ func (h handler) HandleHostMeta(w http.ResponseWriter, r *http.Request) {
 		Links: []link{
 			{
 				Rel:      "lrdd",
-				Type:     "application/xrd+json",
-				Template: fmt.Sprintf("%s/.well-known/node?resource={uri}", h.conf.BaseURL),
+				Type:     "application/jrd+json",
+				Template: fmt.Sprintf("%s/.well-known/webfinger?resource={uri}", h.conf.BaseURL),
 			},
 		},
 	}
@@ -145,6 +258,143 @@ func (h handler) HandleHostMeta(w http.ResponseWriter, r *http.Request) {
 
 const selfName = "self"
 
+const (
+	relProfilePage = "http://webfinger.net/rel/profile-page"
+	relSubscribe   = "http://ostatus.org/schema/1.0/subscribe"
+)
+
+// webfingerResource parses a WebFinger resource, which can be an "acct:handle@host" URI, the URL of
+// an account page, or the actor's IRI. It returns the handle of the local account it references, or
+// the IRI of the actor, and true when the resource references the instance's Service actor.
+func webfingerResource(res string, hostName string) (string, vocab.IRI, bool) {
+	if u, err := url.Parse(res); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		if !strings.EqualFold(u.Host, hostName) || !strings.HasPrefix(u.Path, "/~") {
+			return "", vocab.IRI(res), false
+		}
+		res = strings.TrimPrefix(u.Path, "/~") + "@" + u.Host
+	}
+	res = strings.TrimPrefix(strings.TrimPrefix(res, "acct:"), "@")
+	handle, host := splitRemoteHandle(res)
+	if handle == "" || !strings.EqualFold(host, hostName) {
+		return "", "", false
+	}
+	if handle == selfName || strings.EqualFold(handle, hostName) {
+		return "", "", true
+	}
+	return handle, "", false
+}
+
+// webfingerCheck returns the filter for loading the actor referenced by a WebFinger resource.
+// The second return value is true when the resource references the instance's Service actor.
+func webfingerCheck(res string, hostName string) (filters.Check, bool) {
+	handle, iri, isService := webfingerResource(res, hostName)
+	switch {
+	case isService:
+		return nil, true
+	case iri != "":
+		return filters.All(actorsFilter, filters.SameIRI(iri)), false
+	case handle != "":
+		return AccountByHandleCheck(handle), false
+	}
+	return nil, false
+}
+
+// webfingerNode returns the WebFinger document of the acc account.
+// The profile page of the instance's Service actor is the front page of the instance.
+func webfingerNode(acc *Account, isService bool, baseURL, hostName string) node {
+	iri := acc.AP().GetLink().String()
+	profile := baseURL + AccountLocalLink(acc)
+	if isService {
+		profile = baseURL + "/"
+	}
+	return node{
+		Subject: fmt.Sprintf("acct:%s@%s", acc.Handle, hostName),
+		Aliases: []string{iri, profile},
+		Links: []link{
+			{Rel: "self", Type: MimeTypeActivityJSON, Href: iri},
+			{Rel: relProfilePage, Type: MimeTypeHTML, Href: profile},
+			{Rel: relSubscribe, Template: fmt.Sprintf("%s/authorize_interaction?uri={uri}", baseURL)},
+		},
+	}
+}
+
+// HandleWebFinger serves /.well-known/webfinger
+func (h handler) HandleWebFinger(w http.ResponseWriter, r *http.Request) {
+	res := r.URL.Query().Get("resource")
+	if res == "" {
+		errors.HandleError(errors.BadRequestf("missing resource parameter")).ServeHTTP(w, r)
+		return
+	}
+
+	check, isService := webfingerCheck(res, h.conf.HostName)
+	service := h.storage.fedbox.Service()
+
+	var acc Account
+	if isService {
+		if err := acc.FromActivityPub(service); err != nil {
+			errors.HandleError(errors.NotFoundf("resource %q", res)).ServeHTTP(w, r)
+			return
+		}
+	} else {
+		if check == nil {
+			errors.HandleError(errors.NotFoundf("resource %q", res)).ServeHTTP(w, r)
+			return
+		}
+		accounts, err := h.storage.accountsFromRemote(r.Context(), check)
+		if err != nil {
+			h.errFn(log.Ctx{"err": err.Error(), "resource": res})("unable to load account")
+		}
+		found := false
+		for _, a := range accounts {
+			if a.IsValid() && a.IsLocal() {
+				acc = a
+				found = true
+				break
+			}
+		}
+		if !found {
+			errors.HandleError(errors.NotFoundf("resource %q", res)).ServeHTTP(w, r)
+			return
+		}
+		isService = !vocab.IsNil(service) && acc.AP().GetLink().Equals(service.GetLink(), false)
+	}
+	if isService && acc.Handle == "" {
+		acc.Handle = h.conf.HostName
+	}
+
+	dat, _ := json.Marshal(webfingerNode(&acc, isService, h.conf.BaseURL, h.conf.HostName))
+
+	w.Header().Set("Content-Type", "application/jrd+json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(dat)
+}
+
+// HandleAuthorizeInteraction is the target of the OStatus subscribe template,
+// it redirects to the page of the account the remote user wants to interact with.
+func (h *handler) HandleAuthorizeInteraction(w http.ResponseWriter, r *http.Request) {
+	uri := strings.TrimPrefix(strings.TrimPrefix(r.URL.Query().Get("uri"), "acct:"), "@")
+	if uri == "" {
+		h.v.HandleErrors(w, r, errors.BadRequestf("missing uri parameter"))
+		return
+	}
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		h.v.Redirect(w, r, "/~"+uri, http.StatusSeeOther)
+		return
+	}
+	accounts, _ := h.storage.accountsFromRemote(r.Context(), filters.All(actorsFilter, filters.SameIRI(vocab.IRI(uri))))
+	if len(accounts) > 0 && accounts[0].IsValid() {
+		h.v.Redirect(w, r, AccountLocalLink(&accounts[0]), http.StatusSeeOther)
+		return
+	}
+	if strings.EqualFold(u.Host, h.conf.HostName) {
+		h.v.Redirect(w, r, u.Path, http.StatusSeeOther)
+		return
+	}
+	h.v.HandleErrors(w, r, errors.NotFoundf("account %q", uri))
+}
+
 func (a Application) NodeInfo() WebInfo {
 	// Name formats the name of the current Application
 	inf := WebInfo{
@@ -0,0 +1,138 @@
+package brutalinks
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/brutalinks/internal/config"
+	vocab "github.com/go-ap/activitypub"
+)
+
+func TestWebfingerResource(t *testing.T) {
+	tests := []struct {
+		res       string
+		handle    string
+		iri       vocab.IRI
+		isService bool
+	}{
+		{res: "acct:jdoe@brutalinks.git", handle: "jdoe"},
+		{res: "@jdoe@brutalinks.git", handle: "jdoe"},
+		{res: "jdoe@BRUTALINKS.git", handle: "jdoe"},
+		{res: "https://brutalinks.git/~jdoe", handle: "jdoe"},
+		{res: "acct:jdoe@example.com"},
+		{res: "acct:jdoe"},
+		{res: "acct:self@brutalinks.git", isService: true},
+		{res: "acct:brutalinks.git@brutalinks.git", isService: true},
+		{res: "https://brutalinks.git/actors/jdoe", iri: "https://brutalinks.git/actors/jdoe"},
+		{res: "https://example.com/~jdoe", iri: "https://example.com/~jdoe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.res, func(t *testing.T) {
+			handle, iri, isService := webfingerResource(tt.res, "brutalinks.git")
+			if handle != tt.handle || iri != tt.iri || isService != tt.isService {
+				t.Errorf("webfingerResource() = %q, %q, %t, want %q, %q, %t", handle, iri, isService, tt.handle, tt.iri, tt.isService)
+			}
+		})
+	}
+}
+
+func TestWebfingerNode(t *testing.T) {
+	const baseURL = "https://brutalinks.git"
+	tests := []struct {
+		name        string
+		acc         Account
+		isService   bool
+		wantSubject string
+		wantProfile string
+	}{
+		{
+			name:        "account",
+			acc:         Account{Handle: "jdoe", Pub: vocab.IRI("https://fedbox.git/actors/jdoe")},
+			wantSubject: "acct:jdoe@brutalinks.git",
+			wantProfile: baseURL + "/~jdoe",
+		},
+		{
+			name:        "instance",
+			acc:         Account{Handle: "brutalinks", Pub: vocab.IRI("https://fedbox.git")},
+			isService:   true,
+			wantSubject: "acct:brutalinks@brutalinks.git",
+			wantProfile: baseURL + "/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := webfingerNode(&tt.acc, tt.isService, baseURL, "brutalinks.git")
+			if got.Subject != tt.wantSubject {
+				t.Errorf("webfingerNode() subject = %q, want %q", got.Subject, tt.wantSubject)
+			}
+			links := make(map[string]link)
+			for _, l := range got.Links {
+				links[l.Rel] = l
+			}
+			if self := links["self"]; self.Href != tt.acc.Pub.GetLink().String() || self.Type != MimeTypeActivityJSON {
+				t.Errorf("webfingerNode() invalid self link %+v", self)
+			}
+			if profile := links[relProfilePage]; profile.Href != tt.wantProfile {
+				t.Errorf("webfingerNode() profile page = %q, want %q", profile.Href, tt.wantProfile)
+			}
+			if sub := links[relSubscribe]; sub.Template != baseURL+"/authorize_interaction?uri={uri}" {
+				t.Errorf("webfingerNode() invalid subscribe template %q", sub.Template)
+			}
+		})
+	}
+}
+
+func TestActiveSince(t *testing.T) {
+	Instance = new(Application)
+	Instance.Conf = &config.Configuration{HostName: "brutalinks.git"}
+
+	now := time.Now().UTC()
+	activity := func(actor vocab.IRI, typ vocab.ActivityVocabularyType, age time.Duration) vocab.Item {
+		return &vocab.Activity{Type: typ, Actor: actor, Published: now.Add(-age)}
+	}
+	const (
+		jdoe   = vocab.IRI("https://brutalinks.git/actors/jdoe")
+		alice  = vocab.IRI("https://brutalinks.git/actors/alice")
+		bob    = vocab.IRI("https://brutalinks.git/actors/bob")
+		remote = vocab.IRI("https://example.com/actors/jdoe")
+	)
+	activities := vocab.ItemCollection{
+		activity(jdoe, vocab.CreateType, time.Hour),
+		activity(jdoe, vocab.LikeType, 2*time.Hour),
+		activity(alice, vocab.LikeType, 60*24*time.Hour),
+		activity(bob, vocab.CreateType, 200*24*time.Hour),
+		activity(remote, vocab.CreateType, time.Hour),
+		&vocab.Object{ID: "https://brutalinks.git/objects/1", AttributedTo: bob, Published: now},
+	}
+	got := activeSince(activities, now.Add(-activeMonth), now.Add(-activeHalfYear))
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("activeSince() = %v, want [1 2]", got)
+	}
+}
+
+func TestNodeInfoResolverStop(t *testing.T) {
+	n := &NodeInfoResolver{stop: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		n.refresh(time.Hour)
+		close(done)
+	}()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.Stop()
+		}()
+	}
+	wg.Wait()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("NodeInfoResolver.Stop() did not end the refresh")
+	}
+	n.Stop()
+	(*NodeInfoResolver)(nil).Stop()
+}
@@ -0,0 +1,683 @@
+package brutalinks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "git.sr.ht/~mariusor/lw"
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	EventSubmission = "submission"
+	EventReply      = "reply"
+	EventVote       = "vote"
+	EventReport     = "report"
+	EventFollow     = "follow"
+	EventModeration = "moderation"
+
+	// WebhookMaxAttempts is the number of times we try to deliver an event before giving up
+	WebhookMaxAttempts = 5
+	// WebhookLogSize is the number of deliveries we keep in the log of a webhook
+	WebhookLogSize = 20
+	// WebhookTimeout is how long we wait for a webhook to reply
+	WebhookTimeout = 10 * time.Second
+	// WebhookMaxPerAccount is the number of webhooks a regular account can register
+	WebhookMaxPerAccount = 5
+
+	// webhookWorkers is the number of deliveries we make at the same time
+	webhookWorkers = 4
+	// webhookQueueSize is the number of deliveries waiting for a worker, after which new ones are dropped
+	webhookQueueSize = 500
+	// webhookLogSaveInterval is how often we save the delivery logs of the webhooks
+	webhookLogSaveInterval = 10 * time.Second
+
+	webhookSignatureHeader = "X-Brutalinks-Signature"
+	webhookTimestampHeader = "X-Brutalinks-Timestamp"
+	webhookEventHeader     = "X-Brutalinks-Event"
+	webhookDeliveryHeader  = "X-Brutalinks-Delivery"
+)
+
+// WebhookEvents are the events the webhooks can subscribe to
+var WebhookEvents = []string{EventSubmission, EventReply, EventVote, EventReport, EventFollow, EventModeration}
+
+// AccountWebhookEvents are the events the webhooks of the regular accounts can subscribe to,
+// the reports and the moderation actions are available only to the webhooks of the operators.
+var AccountWebhookEvents = []string{EventSubmission, EventReply, EventVote, EventFollow}
+
+// webhookBackoff returns how long we wait before the next delivery attempt
+var webhookBackoff = func(attempt int) time.Duration {
+	return 30 * time.Second << (2 * (attempt - 1))
+}
+
+// Webhook is a URL which receives the events of the instance, or the ones concerning the account that registered it
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	// Tag limits the submission events to the items with the tag
+	Tag string `json:"tag,omitempty"`
+	// Owner is the hash of the account which registered the webhook, it's empty for the instance webhooks
+	Owner      string            `json:"owner,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	Deliveries []WebhookDelivery `json:"deliveries,omitempty"`
+}
+
+// WebhookDelivery is an attempt to deliver an event to a webhook
+type WebhookDelivery struct {
+	ID      string    `json:"id"`
+	Event   string    `json:"event"`
+	At      time.Time `json:"at"`
+	Attempt int       `json:"attempt"`
+	Status  int       `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+func (d WebhookDelivery) Succeeded() bool {
+	return d.Error == "" && d.Status >= http.StatusOK && d.Status < http.StatusMultipleChoices
+}
+
+// IsInstance returns true for the webhooks receiving all the events of the instance
+func (w Webhook) IsInstance() bool {
+	return w.Owner == ""
+}
+
+// Subscribes returns true if the webhook receives the event type
+func (w Webhook) Subscribes(typ string) bool {
+	return slices.Contains(w.Events, typ)
+}
+
+// matches returns true if the e event needs to be delivered to the webhook
+func (w Webhook) matches(e Event) bool {
+	if e.private || !w.Subscribes(e.Type) {
+		return false
+	}
+	if e.Type == EventSubmission && w.Tag != "" && !slices.ContainsFunc(e.tags, func(t string) bool {
+		return strings.EqualFold(t, w.Tag)
+	}) {
+		return false
+	}
+	if w.IsInstance() {
+		return true
+	}
+	if !slices.Contains(AccountWebhookEvents, e.Type) {
+		return false
+	}
+	// submissions are public, everything else goes only to the webhooks of the accounts concerned
+	return e.Type == EventSubmission || slices.Contains(e.concerns, w.Owner)
+}
+
+// webhookEventsFromRequest returns the valid events from the ones submitted in the webhook form
+func webhookEventsFromRequest(events []string, instance bool) []string {
+	valid := AccountWebhookEvents
+	if instance {
+		valid = WebhookEvents
+	}
+	result := make([]string, 0, len(events))
+	for _, e := range events {
+		if slices.Contains(valid, e) && !slices.Contains(result, e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func randomHex(n int) string {
+	raw := make([]byte, n)
+	_, _ = rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+// webhookSignature returns the HMAC-SHA256 of the timestamp and the payload, with the secret of the webhook.
+// The receivers can compute it in the same way, to check that the payload comes from us.
+func webhookSignature(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookStore keeps the webhooks and their delivery logs in a JSON file.
+// The delivery logs are saved periodically by the dispatcher, the changes to the webhooks are saved immediately.
+type webhookStore struct {
+	m     sync.RWMutex
+	path  string
+	hooks []Webhook
+	dirty bool
+}
+
+// webhookStoreNew returns a store saving the webhooks in a "webhooks.json" file next to the storage at path
+func webhookStoreNew(path string) *webhookStore {
+	s := &webhookStore{path: filepath.Join(storageDir(path), "webhooks.json")}
+	_ = loadJSONFile(s.path, &s.hooks)
+	return s
+}
+
+// save needs to be called with the lock held
+func (s *webhookStore) save() error {
+	if err := saveJSONFile(s.path, s.hooks); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// flush saves the delivery logs changed since the previous save
+func (s *webhookStore) flush() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// List returns the webhooks of the account with the owner hash, or all of them when owner is nil
+func (s *webhookStore) List(owner *string) []Webhook {
+	if s == nil {
+		return nil
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	hooks := make([]Webhook, 0)
+	for _, w := range s.hooks {
+		if owner == nil || w.Owner == *owner {
+			hooks = append(hooks, w)
+		}
+	}
+	return hooks
+}
+
+// Add saves a new webhook, generating its ID and its secret.
+// Regular accounts can have at most WebhookMaxPerAccount webhooks.
+func (s *webhookStore) Add(w Webhook) (Webhook, error) {
+	if s == nil {
+		return w, errors.NotImplementedf("webhooks are not available")
+	}
+	w.ID = randomHex(8)
+	w.Secret = randomHex(24)
+	w.CreatedAt = time.Now().UTC()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !w.IsInstance() {
+		count := 0
+		for _, h := range s.hooks {
+			if h.Owner == w.Owner {
+				count++
+			}
+		}
+		if count >= WebhookMaxPerAccount {
+			return w, errors.Forbiddenf("you can register at most %d webhooks", WebhookMaxPerAccount)
+		}
+	}
+	s.hooks = append(s.hooks, w)
+	return w, s.save()
+}
+
+// Remove deletes the webhook with id. Only operators can remove the webhooks of other accounts.
+func (s *webhookStore) Remove(id string, by *Account) error {
+	if s == nil {
+		return errors.NotImplementedf("webhooks are not available")
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for i, w := range s.hooks {
+		if w.ID != id {
+			continue
+		}
+		if w.Owner != by.Hash.String() && !by.IsOperator() {
+			return errors.Forbiddenf("webhook %s belongs to another account", id)
+		}
+		s.hooks = append(s.hooks[:i], s.hooks[i+1:]...)
+		return s.save()
+	}
+	return errors.NotFoundf("webhook %s not found", id)
+}
+
+// logDelivery appends d to the log of the webhook with id, keeping only the latest WebhookLogSize entries.
+// The log is saved by the next flush.
+func (s *webhookStore) logDelivery(id string, d WebhookDelivery) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for i, w := range s.hooks {
+		if w.ID != id {
+			continue
+		}
+		deliveries := append([]WebhookDelivery{d}, w.Deliveries...)
+		if len(deliveries) > WebhookLogSize {
+			deliveries = deliveries[:WebhookLogSize]
+		}
+		s.hooks[i].Deliveries = deliveries
+		s.dirty = true
+		return
+	}
+}
+
+func webhookClient(control func(string, string, syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: WebhookTimeout, Control: control}
+	tr := &http.Transport{DialContext: dialer.DialContext}
+	if control == nil {
+		// a proxy would dial the webhook address in our place, bypassing the control of the addresses
+		tr.Proxy = http.ProxyFromEnvironment
+	}
+	return &http.Client{
+		Timeout:   WebhookTimeout,
+		Transport: tr,
+		// a redirect could point to an address we don't allow, so we treat them as failures
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type webhookJob struct {
+	hook     Webhook
+	event    string
+	delivery string
+	payload  []byte
+	attempt  int
+}
+
+// webhookDispatcher delivers the events to the webhooks in the background, using webhookWorkers workers, until Stop is called.
+// The failed deliveries are retried with an increasing delay, for WebhookMaxAttempts times.
+type webhookDispatcher struct {
+	store    *webhookStore
+	instance *http.Client
+	accounts *http.Client
+	jobs     chan webhookJob
+	stop     chan struct{}
+	stopped  sync.Once
+	errFn    CtxLogFn
+}
+
+func webhookDispatcherNew(store *webhookStore, errFn CtxLogFn) *webhookDispatcher {
+	d := &webhookDispatcher{
+		store:    store,
+		instance: webhookClient(nil),
+		accounts: webhookClient(publicAddressOnly),
+		jobs:     make(chan webhookJob, webhookQueueSize),
+		stop:     make(chan struct{}),
+		errFn:    errFn,
+	}
+	for i := 0; i < webhookWorkers; i++ {
+		go d.run()
+	}
+	go d.saveLogs(webhookLogSaveInterval)
+	return d
+}
+
+func (d *webhookDispatcher) run() {
+	for {
+		select {
+		case job := <-d.jobs:
+			d.deliver(job)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// saveLogs saves the delivery logs every interval, and one last time when the dispatcher stops
+func (d *webhookDispatcher) saveLogs(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-d.stop:
+			d.flush()
+			return
+		}
+		d.flush()
+	}
+}
+
+func (d *webhookDispatcher) flush() {
+	if err := d.store.flush(); err != nil {
+		d.errFn(log.Ctx{"err": err.Error()})("unable to save webhook deliveries")
+	}
+}
+
+// Stop ends the background deliveries, the pending ones are lost
+func (d *webhookDispatcher) Stop() {
+	if d == nil {
+		return
+	}
+	// pending retries can still try to enqueue after this, so the channel needs to stay in place
+	d.stopped.Do(func() { close(d.stop) })
+}
+
+func (d *webhookDispatcher) enqueue(job webhookJob) {
+	select {
+	case d.jobs <- job:
+	case <-d.stop:
+	default:
+		d.errFn(log.Ctx{"webhook": job.hook.ID, "event": job.event})("webhook queue is full, dropping delivery")
+	}
+}
+
+// Emit sends the e event to the webhooks that subscribe to it
+func (d *webhookDispatcher) Emit(e Event) {
+	if d == nil {
+		return
+	}
+	var payload []byte
+	for _, w := range d.store.List(nil) {
+		if !w.matches(e) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(e); err != nil {
+				d.errFn(log.Ctx{"err": err.Error(), "event": e.Type})("unable to encode webhook event")
+				return
+			}
+		}
+		d.enqueue(webhookJob{hook: w, event: e.Type, delivery: e.ID, payload: payload, attempt: 1})
+	}
+}
+
+func (d *webhookDispatcher) deliver(job webhookJob) {
+	dl := WebhookDelivery{ID: job.delivery, Event: job.event, At: time.Now().UTC(), Attempt: job.attempt}
+	if status, err := d.post(job); err != nil {
+		dl.Error = err.Error()
+	} else {
+		dl.Status = status
+		if !dl.Succeeded() {
+			dl.Error = http.StatusText(status)
+		}
+	}
+	d.store.logDelivery(job.hook.ID, dl)
+	if dl.Succeeded() || job.attempt >= WebhookMaxAttempts {
+		return
+	}
+	job.attempt++
+	time.AfterFunc(webhookBackoff(job.attempt-1), func() {
+		d.enqueue(job)
+	})
+}
+
+func (d *webhookDispatcher) post(job webhookJob) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, job.hook.URL, bytes.NewReader(job.payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, job.event)
+	req.Header.Set(webhookDeliveryHeader, job.delivery)
+	req.Header.Set(webhookTimestampHeader, ts)
+	req.Header.Set(webhookSignatureHeader, webhookSignature(job.hook.Secret, ts, job.payload))
+
+	cl := d.accounts
+	if job.hook.IsInstance() {
+		cl = d.instance
+	}
+	res, err := cl.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	return res.StatusCode, nil
+}
+
+// EventAccount is an account, as it appears in the webhook payloads
+type EventAccount struct {
+	Handle string `json:"handle"`
+	URL    string `json:"url"`
+}
+
+// EventItem is an item, as it appears in the webhook payloads
+type EventItem struct {
+	URL       string        `json:"url"`
+	Title     string        `json:"title,omitempty"`
+	Content   string        `json:"content,omitempty"`
+	Tags      []string      `json:"tags,omitempty"`
+	InReplyTo string        `json:"inReplyTo,omitempty"`
+	Author    *EventAccount `json:"author,omitempty"`
+}
+
+// Event is the payload we POST to the webhooks
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Published time.Time `json:"published"`
+	Instance  string    `json:"instance"`
+	// Action details the event: the accept or reject of a follow request, or the type of a moderation action
+	Action  string        `json:"action,omitempty"`
+	Actor   *EventAccount `json:"actor,omitempty"`
+	Item    *EventItem    `json:"item,omitempty"`
+	Account *EventAccount `json:"account,omitempty"`
+	Weight  int           `json:"weight,omitempty"`
+	Reason  string        `json:"reason,omitempty"`
+
+	tags     []string
+	concerns []string
+	private  bool
+}
+
+func eventAccount(a *Account) *EventAccount {
+	if a == nil || !a.IsValid() {
+		return nil
+	}
+	return &EventAccount{Handle: a.Handle, URL: absoluteURL(AccountPermaLink(a))}
+}
+
+func eventItem(it *Item) *EventItem {
+	if it == nil {
+		return nil
+	}
+	e := &EventItem{URL: absoluteURL(ItemPermaLink(it)), Title: it.Title, Author: eventAccount(it.SubmittedBy)}
+	if !it.IsLink() {
+		e.Content = it.Data
+	}
+	if it.HasMetadata() {
+		for _, t := range it.Metadata.Tags {
+			e.Tags = append(e.Tags, t.Name)
+		}
+	}
+	if p, ok := it.Parent.(*Item); ok && p != nil {
+		e.InReplyTo = absoluteURL(ItemPermaLink(p))
+	}
+	return e
+}
+
+func absoluteURL(l string) string {
+	if len(l) > 0 && l[0] == '/' {
+		return Instance.BaseURL.String() + l
+	}
+	return l
+}
+
+func eventNew(typ string, actor *Account) Event {
+	e := Event{
+		ID:        randomHex(16),
+		Type:      typ,
+		Published: time.Now().UTC(),
+		Instance:  Instance.BaseURL.String(),
+		Actor:     eventAccount(actor),
+	}
+	return e
+}
+
+func (e *Event) concern(a *Account) {
+	if a != nil && a.IsLogged() {
+		e.concerns = append(e.concerns, a.Hash.String())
+	}
+}
+
+func reasonText(reason *Item) string {
+	if reason == nil {
+		return ""
+	}
+	return reason.Data
+}
+
+// itemCreatedEvent returns the submission event for top level items, and the reply event for the replies to parent
+func itemCreatedEvent(it Item, parent Renderable) Event {
+	e := eventNew(EventSubmission, it.SubmittedBy)
+	e.Item = eventItem(&it)
+	e.tags = e.Item.Tags
+	e.private = it.Private()
+	if parent == nil {
+		return e
+	}
+	e.Type = EventReply
+	if p, ok := parent.(*Item); ok && p != nil {
+		e.Item.InReplyTo = absoluteURL(ItemPermaLink(p))
+		e.concern(p.SubmittedBy)
+	}
+	return e
+}
+
+func voteEvent(v Vote) Event {
+	e := eventNew(EventVote, v.SubmittedBy)
+	e.Item = eventItem(v.Item)
+	e.Weight = v.Weight
+	e.private = v.Item.Private()
+	if v.Item != nil {
+		e.concern(v.Item.SubmittedBy)
+	}
+	return e
+}
+
+func reportEvent(er *Account, it *Item, ed *Account, reason *Item) Event {
+	e := eventNew(EventReport, er)
+	e.Item = eventItem(it)
+	e.private = it.Private()
+	e.Account = eventAccount(ed)
+	e.Reason = reasonText(reason)
+	return e
+}
+
+func moderationEvent(action string, er *Account, it *Item, ed *Account, reason *Item) Event {
+	e := eventNew(EventModeration, er)
+	e.Action = action
+	e.Item = eventItem(it)
+	e.private = it.Private()
+	e.Account = eventAccount(ed)
+	e.Reason = reasonText(reason)
+	return e
+}
+
+// followEvent returns the event for a follow request, or for its accept or reject, from the actor to the account
+func followEvent(action string, actor, account *Account, reason *Item) Event {
+	e := eventNew(EventFollow, actor)
+	e.Action = action
+	e.Account = eventAccount(account)
+	e.Reason = reasonText(reason)
+	e.concern(actor)
+	e.concern(account)
+	return e
+}
+
+// webhooksModel is the page where an account manages its webhooks
+type webhooksModel struct {
+	Title    template.HTML
+	Webhooks []Webhook
+	Events   []string
+	// Instance is true for operators, who can set up webhooks receiving all the events of the instance
+	Instance bool
+}
+
+func (m *webhooksModel) SetTitle(s string) {
+	m.Title = template.HTML(s)
+}
+
+func (webhooksModel) Template() string {
+	return "webhooks"
+}
+
+func (*webhooksModel) SetCursor(c *Cursor) {}
+
+// WebhooksModelMw loads the webhooks of the logged account, and for operators, all the webhooks of the instance
+func WebhooksModelMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acc := loggedAccount(r)
+		repo := ContextRepository(r.Context())
+		m := &webhooksModel{Title: "Webhooks", Events: AccountWebhookEvents}
+		if acc.IsOperator() {
+			m.Instance = true
+			m.Events = WebhookEvents
+			m.Webhooks = repo.webhooks.List(nil)
+		} else {
+			owner := acc.Hash.String()
+			m.Webhooks = repo.webhooks.List(&owner)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ModelCtxtKey, m)))
+	})
+}
+
+// webhookFromRequest loads a new webhook of the logged account from the form
+func webhookFromRequest(r *http.Request, acc *Account) (Webhook, error) {
+	hook := Webhook{Owner: acc.Hash.String()}
+	u, err := url.Parse(strings.TrimSpace(r.PostFormValue("url")))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return hook, errors.BadRequestf("the webhook needs an http, or https, URL")
+	}
+	hook.URL = u.String()
+	instance := acc.IsOperator() && r.PostFormValue("instance") != ""
+	if instance {
+		hook.Owner = ""
+	}
+	if hook.Events = webhookEventsFromRequest(r.PostForm["event"], instance); len(hook.Events) == 0 {
+		return hook, errors.BadRequestf("the webhook needs at least one event")
+	}
+	if tag := strings.Trim(strings.TrimSpace(r.PostFormValue("tag")), "#"); tag != "" {
+		hook.Tag = "#" + tag
+	}
+	return hook, nil
+}
+
+// HandleWebhookAdd saves a new webhook for the logged account
+func (h *handler) HandleWebhookAdd(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	back := "/settings/webhooks"
+
+	hook, err := webhookFromRequest(r, acc)
+	if err != nil {
+		h.v.addFlashMessage(Error, w, r, err.Error())
+		h.v.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if _, err = h.storage.webhooks.Add(hook); errors.IsForbidden(err) {
+		h.v.addFlashMessage(Error, w, r, err.Error())
+	} else if err != nil {
+		h.errFn(log.Ctx{"err": err.Error(), "account": acc.Handle})("unable to save webhook")
+		h.v.addFlashMessage(Error, w, r, "Unable to save the webhook.")
+	} else {
+		h.v.addFlashMessage(Success, w, r, "The webhook has been added, you can find its signing secret below.")
+	}
+	h.v.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// HandleWebhookRemove serves the POST /settings/webhooks/{id}/delete requests
+func (h *handler) HandleWebhookRemove(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	if err := h.storage.webhooks.Remove(chi.URLParam(r, "id"), acc); err != nil {
+		h.v.addFlashMessage(Error, w, r, "Unable to remove the webhook.")
+	} else {
+		h.v.addFlashMessage(Success, w, r, "The webhook has been removed.")
+	}
+	h.v.Redirect(w, r, "/settings/webhooks", http.StatusSeeOther)
+}
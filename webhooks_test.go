@@ -0,0 +1,239 @@
+package brutalinks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-ap/errors"
+)
+
+func TestWebhook_matches(t *testing.T) {
+	owner := "4f449c81-1dbb-11ee-beef-5a83926a0fbf"
+	tests := []struct {
+		name string
+		hook Webhook
+		e    Event
+		want bool
+	}{
+		{
+			name: "not subscribed",
+			hook: Webhook{Events: []string{EventReply}},
+			e:    Event{Type: EventSubmission},
+			want: false,
+		},
+		{
+			name: "instance submission",
+			hook: Webhook{Events: []string{EventSubmission}},
+			e:    Event{Type: EventSubmission},
+			want: true,
+		},
+		{
+			name: "submission with tag",
+			hook: Webhook{Events: []string{EventSubmission}, Tag: "#golang"},
+			e:    Event{Type: EventSubmission, tags: []string{"#GoLang"}},
+			want: true,
+		},
+		{
+			name: "submission without tag",
+			hook: Webhook{Events: []string{EventSubmission}, Tag: "#golang"},
+			e:    Event{Type: EventSubmission, tags: []string{"#rust"}},
+			want: false,
+		},
+		{
+			name: "account reply",
+			hook: Webhook{Events: []string{EventReply}, Owner: owner},
+			e:    Event{Type: EventReply, concerns: []string{owner}},
+			want: true,
+		},
+		{
+			name: "reply for another account",
+			hook: Webhook{Events: []string{EventReply}, Owner: owner},
+			e:    Event{Type: EventReply},
+			want: false,
+		},
+		{
+			name: "account report",
+			hook: Webhook{Events: []string{EventReport}, Owner: owner},
+			e:    Event{Type: EventReport, concerns: []string{owner}},
+			want: false,
+		},
+		{
+			name: "private item",
+			hook: Webhook{Events: []string{EventSubmission, EventReply}},
+			e:    Event{Type: EventSubmission, private: true},
+			want: false,
+		},
+		{
+			name: "private reply",
+			hook: Webhook{Events: []string{EventReply}, Owner: owner},
+			e:    Event{Type: EventReply, concerns: []string{owner}, private: true},
+			want: false,
+		},
+		{
+			name: "instance report",
+			hook: Webhook{Events: []string{EventReport}},
+			e:    Event{Type: EventReport},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hook.matches(tt.e); got != tt.want {
+				t.Errorf("matches() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemCreatedEventPrivate(t *testing.T) {
+	Instance = new(Application)
+	Instance.BaseURL = url.URL{Scheme: "https", Host: "brutalinks.git"}
+
+	hook := Webhook{Events: []string{EventSubmission, EventReply}}
+	if !hook.matches(itemCreatedEvent(Item{Title: "public"}, nil)) {
+		t.Errorf("matches() refused a public submission")
+	}
+	private := Item{Title: "private", Flags: FlagsPrivate}
+	if hook.matches(itemCreatedEvent(private, nil)) {
+		t.Errorf("matches() accepted a private submission")
+	}
+	if hook.matches(itemCreatedEvent(private, &Item{Title: "parent"})) {
+		t.Errorf("matches() accepted a private reply")
+	}
+}
+
+func TestItemEventsPrivate(t *testing.T) {
+	Instance = new(Application)
+	Instance.BaseURL = url.URL{Scheme: "https", Host: "brutalinks.git"}
+
+	hook := Webhook{Events: WebhookEvents}
+	public := &Item{Title: "public", Data: "public content"}
+	private := &Item{Title: "private", Data: "private content", Flags: FlagsPrivate}
+	jdoe := &Account{Handle: "jdoe"}
+	tests := map[string]func(it *Item) Event{
+		"vote": func(it *Item) Event {
+			return voteEvent(Vote{SubmittedBy: jdoe, Item: it, Weight: 1})
+		},
+		"report": func(it *Item) Event {
+			return reportEvent(jdoe, it, nil, nil)
+		},
+		"moderation": func(it *Item) Event {
+			return moderationEvent("block", jdoe, it, nil, nil)
+		},
+	}
+	for name, event := range tests {
+		t.Run(name, func(t *testing.T) {
+			if !hook.matches(event(public)) {
+				t.Errorf("matches() refused the %s event on a public item", name)
+			}
+			if hook.matches(event(private)) {
+				t.Errorf("matches() accepted the %s event on a private item", name)
+			}
+		})
+	}
+}
+
+func TestWebhookDispatcher_Emit(t *testing.T) {
+	oldBackoff := webhookBackoff
+	webhookBackoff = func(int) time.Duration { return 10 * time.Millisecond }
+	defer func() { webhookBackoff = oldBackoff }()
+
+	var calls int32
+	signatures := make(chan bool, WebhookMaxAttempts)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sig := r.Header.Get(webhookSignatureHeader)
+		signatures <- sig == webhookSignature("secret", r.Header.Get(webhookTimestampHeader), body)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	store := webhookStoreNew(t.TempDir())
+	store.hooks = []Webhook{{ID: "test", URL: srv.URL, Secret: "secret", Events: []string{EventSubmission}}}
+	d := webhookDispatcherNew(store, defaultCtxLogFn)
+	defer d.Stop()
+
+	d.Emit(Event{ID: "private", Type: EventSubmission, private: true})
+	d.Emit(Event{ID: "event", Type: EventSubmission})
+	for i := 0; i < 2; i++ {
+		select {
+		case valid := <-signatures:
+			if !valid {
+				t.Errorf("invalid signature for attempt %d", i+1)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for attempt %d", i+1)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if hooks := store.List(nil); len(hooks[0].Deliveries) == 2 {
+			latest, first := hooks[0].Deliveries[0], hooks[0].Deliveries[1]
+			if latest.ID != "event" || first.ID != "event" {
+				t.Errorf("the private event should not have been delivered, got deliveries %q and %q", first.ID, latest.ID)
+			}
+			if first.Succeeded() || first.Status != http.StatusServiceUnavailable {
+				t.Errorf("first delivery should have failed with %d, got %d", http.StatusServiceUnavailable, first.Status)
+			}
+			if !latest.Succeeded() || latest.Attempt != 2 {
+				t.Errorf("second delivery should have succeeded, got status %d, attempt %d", latest.Status, latest.Attempt)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("the deliveries have not been logged")
+}
+
+func TestWebhookStore_Add(t *testing.T) {
+	store := webhookStoreNew(t.TempDir())
+	for i := 0; i < WebhookMaxPerAccount; i++ {
+		if _, err := store.Add(Webhook{URL: "https://example.com", Owner: "jdoe"}); err != nil {
+			t.Fatalf("Add() error = %s", err)
+		}
+	}
+	if _, err := store.Add(Webhook{URL: "https://example.com", Owner: "jdoe"}); !errors.IsForbidden(err) {
+		t.Errorf("Add() error = %v, want the webhooks of the account to be limited", err)
+	}
+	if _, err := store.Add(Webhook{URL: "https://example.com", Owner: "alice"}); err != nil {
+		t.Errorf("Add() error = %s for another account", err)
+	}
+	if _, err := store.Add(Webhook{URL: "https://example.com"}); err != nil {
+		t.Errorf("Add() error = %s for an instance webhook", err)
+	}
+}
+
+func TestWebhookStore_flush(t *testing.T) {
+	path := t.TempDir()
+	store := webhookStoreNew(path)
+	hook, err := store.Add(Webhook{URL: "https://example.com", Owner: "jdoe"})
+	if err != nil {
+		t.Fatalf("Add() error = %s", err)
+	}
+	store.logDelivery(hook.ID, WebhookDelivery{ID: "event", Status: http.StatusNoContent})
+	if hooks := webhookStoreNew(path).List(nil); len(hooks[0].Deliveries) != 0 {
+		t.Errorf("logDelivery() saved the log before the flush")
+	}
+	if err = store.flush(); err != nil {
+		t.Fatalf("flush() error = %s", err)
+	}
+	if hooks := webhookStoreNew(path).List(nil); len(hooks[0].Deliveries) != 1 {
+		t.Errorf("flush() did not save the delivery log")
+	}
+}
+
+func TestWebhookClient(t *testing.T) {
+	if tr := webhookClient(publicAddressOnly).Transport.(*http.Transport); tr.Proxy != nil {
+		t.Errorf("the client of the account webhooks must not use a proxy")
+	}
+}